@@ -0,0 +1,399 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+)
+
+// Analyzer collects the statistics of a stream of JSON documents without requiring an external system.
+// The created DataSet contains the same statistics as the JODA analysis.
+type Analyzer struct {
+	// The number of analyzed documents
+	count uint64
+	// The statistics of all paths seen so far
+	paths map[string]*pathStatistics
+	// The maximum length of collected string prefixes
+	MaxPrefixLength int
+	// The maximum number of distinct prefixes collected for a single prefix length
+	MaxDistinctPrefixes int
+}
+
+// Creates a new Analyzer with the same prefix settings as the JODA analysis
+func New() *Analyzer {
+	return &Analyzer{
+		paths:               make(map[string]*pathStatistics),
+		MaxPrefixLength:     10,
+		MaxDistinctPrefixes: 1000,
+	}
+}
+
+// Add analyzes a single decoded JSON document.
+// The elements of arrays are analyzed at the element path (e.g. "/tags/*"), each element counts as one value.
+func (a *Analyzer) Add(doc interface{}) {
+	a.count++
+	a.addValue("", doc)
+}
+
+func (a *Analyzer) addValue(path string, value interface{}) {
+	stats, ok := a.paths[path]
+	if !ok {
+		stats = &pathStatistics{prefixLimit: a.MaxPrefixLength}
+		a.paths[path] = stats
+	}
+	stats.count++
+
+	switch v := value.(type) {
+	case nil:
+		stats.nullCount++
+	case bool:
+		stats.boolCount++
+		if v {
+			stats.trueCount++
+		} else {
+			stats.falseCount++
+		}
+	case string:
+		stats.addString(v, a.MaxDistinctPrefixes)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			stats.addInt(i)
+		} else if f, err := v.Float64(); err == nil {
+			stats.addFloat(f)
+		}
+	case float64:
+		// Documents decoded without json.Number do not distinguish integers
+		if v == math.Trunc(v) && v >= math.MinInt64 && v <= math.MaxInt64 {
+			stats.addInt(int64(v))
+		} else {
+			stats.addFloat(v)
+		}
+	case map[string]interface{}:
+		stats.addObject(uint64(len(v)))
+		for key, child := range v {
+			a.addValue(fmt.Sprintf("%s/%s", path, key), child)
+		}
+	case []interface{}:
+		stats.addArray(uint64(len(v)))
+		for _, element := range v {
+			a.addValue(dataset.ElementPath(path), element)
+		}
+	}
+}
+
+// DataSet returns the collected statistics as a dataset with the given name
+func (a *Analyzer) DataSet(name string) dataset.DataSet {
+	paths := make(map[string]*dataset.DataPath, len(a.paths))
+	for path, stats := range a.paths {
+		paths[path] = stats.dataPath(path, a.MaxDistinctPrefixes)
+	}
+	count := a.count
+	return dataset.DataSet{
+		Name:          name,
+		Count:         &count,
+		ExpectedCount: count,
+		Paths:         paths,
+		DerivedFrom:   nil,
+	}
+}
+
+// pathStatistics accumulates the statistics of a single path
+type pathStatistics struct {
+	count       uint64
+	nullCount   uint64
+	boolCount   uint64
+	trueCount   uint64
+	falseCount  uint64
+	strCount    uint64
+	intCount    uint64
+	floatCount  uint64
+	objectCount uint64
+	arrayCount  uint64
+
+	minStr     *string
+	maxStr     *string
+	minInt     *int64
+	maxInt     *int64
+	minFloat   *float64
+	maxFloat   *float64
+	minMembers *uint64
+	maxMembers *uint64
+	minSize    *uint64
+	maxSize    *uint64
+	// Number of characters of the string values
+	minLength   *uint64
+	maxLength   *uint64
+	totalLength uint64
+
+	// Frequencies of string and integer values
+	strValues frequencyCounter
+	intValues frequencyCounter
+	// Number of string values containing each n-gram
+	ngramValues frequencyCounter
+	// Sketches of the distinct string, integer and numeric values
+	strSketch    *dataset.HyperLogLog
+	intSketch    *dataset.HyperLogLog
+	numberSketch *dataset.HyperLogLog
+	// Samples of the integer and all numeric values
+	intSample    sample
+	numberSample sample
+	// Detection of timestamps among the string and number values
+	temporal dataset.TemporalAnalysis
+
+	// Distinct prefixes per prefix length (index 0 = length 1)
+	prefixes []map[string]struct{}
+	// Prefix lengths above this limit are not collected anymore
+	prefixLimit int
+}
+
+func (s *pathStatistics) addString(str string, maxDistinctPrefixes int) {
+	s.strCount++
+	if s.minStr == nil || str < *s.minStr {
+		tmp := str
+		s.minStr = &tmp
+	}
+	if s.maxStr == nil || str > *s.maxStr {
+		tmp := str
+		s.maxStr = &tmp
+	}
+	s.strValues.add(str)
+	s.temporal.AddString(str, 1)
+	length := uint64(utf8.RuneCountInString(str))
+	s.totalLength += length
+	if s.minLength == nil || length < *s.minLength {
+		s.minLength = &length
+	}
+	if s.maxLength == nil || length > *s.maxLength {
+		tmp := length
+		s.maxLength = &tmp
+	}
+	for _, ngram := range dataset.NGrams(str) {
+		s.ngramValues.add(ngram)
+	}
+	if s.strSketch == nil {
+		s.strSketch = dataset.NewHyperLogLog()
+	}
+	s.strSketch.AddString(str)
+
+	runes := []rune(str)
+	for length := 1; length <= s.prefixLimit; length++ {
+		if len(s.prefixes) < length {
+			s.prefixes = append(s.prefixes, make(map[string]struct{}))
+		}
+		prefix := runes
+		if len(prefix) > length {
+			prefix = prefix[:length]
+		}
+		s.prefixes[length-1][string(prefix)] = struct{}{}
+		// Longer prefixes can only be more diverse, stop collecting them
+		if len(s.prefixes[length-1]) > maxDistinctPrefixes {
+			s.prefixLimit = length
+			s.prefixes = s.prefixes[:length]
+		}
+	}
+}
+
+func (s *pathStatistics) addInt(i int64) {
+	s.intCount++
+	if s.minInt == nil || i < *s.minInt {
+		s.minInt = &i
+	}
+	if s.maxInt == nil || i > *s.maxInt {
+		tmp := i
+		s.maxInt = &tmp
+	}
+	s.intValues.add(strconv.FormatInt(i, 10))
+	s.intSample.add(float64(i))
+	if s.intSketch == nil {
+		s.intSketch = dataset.NewHyperLogLog()
+	}
+	s.intSketch.AddInt(i)
+	s.addNumber(float64(i))
+}
+
+func (s *pathStatistics) addFloat(f float64) {
+	s.floatCount++
+	s.addNumber(f)
+}
+
+func (s *pathStatistics) addNumber(f float64) {
+	s.numberSample.add(f)
+	s.temporal.AddNumber(f, 1)
+	if s.numberSketch == nil {
+		s.numberSketch = dataset.NewHyperLogLog()
+	}
+	s.numberSketch.AddFloat(f)
+	if s.minFloat == nil || f < *s.minFloat {
+		s.minFloat = &f
+	}
+	if s.maxFloat == nil || f > *s.maxFloat {
+		tmp := f
+		s.maxFloat = &tmp
+	}
+}
+
+func (s *pathStatistics) addObject(members uint64) {
+	s.objectCount++
+	if s.minMembers == nil || members < *s.minMembers {
+		s.minMembers = &members
+	}
+	if s.maxMembers == nil || members > *s.maxMembers {
+		tmp := members
+		s.maxMembers = &tmp
+	}
+}
+
+func (s *pathStatistics) addArray(size uint64) {
+	s.arrayCount++
+	if s.minSize == nil || size < *s.minSize {
+		s.minSize = &size
+	}
+	if s.maxSize == nil || size > *s.maxSize {
+		tmp := size
+		s.maxSize = &tmp
+	}
+}
+
+// Chooses the prefix list the same way the JODA string analysis does:
+// The prefix length is increased until too many prefixes exist or no new prefixes are found.
+func (s *pathStatistics) prefixList(maxDistinctPrefixes int) []string {
+	var prefix_list []string
+	for length := 1; length <= len(s.prefixes); length++ {
+		var tmp_list []string
+		for prefix := range s.prefixes[length-1] {
+			tmp_list = append(tmp_list, prefix)
+		}
+		sort.Strings(tmp_list)
+		done := len(tmp_list) > maxDistinctPrefixes || len(tmp_list) == len(prefix_list)
+		prefix_list = tmp_list
+		if done {
+			break
+		}
+	}
+	return prefix_list
+}
+
+func (s *pathStatistics) dataPath(path string, maxDistinctPrefixes int) *dataset.DataPath {
+	// Copy values to prevent sharing pointers between the analyzer and the dataset
+	count := s.count
+	str_count := s.strCount
+	int_count := s.intCount
+	num_count := s.intCount + s.floatCount
+	bool_count := s.boolCount
+	false_count := s.falseCount
+	true_count := s.trueCount
+	null_count := s.nullCount
+	object_count := s.objectCount
+	array_count := s.arrayCount
+
+	str_type := dataset.StringType{
+		Count: &str_count,
+		Min:   copyString(s.minStr),
+		Max:   copyString(s.maxStr),
+	}
+	str_type.Unique, str_type.Sketch = sketchStatistics(s.strSketch)
+	if str_count > 0 {
+		avg_length := float64(s.totalLength) / float64(str_count)
+		str_type.MinLength = copyUint(s.minLength)
+		str_type.MaxLength = copyUint(s.maxLength)
+		str_type.AvgLength = &avg_length
+		str_type.Prefixes = s.prefixList(maxDistinctPrefixes)
+		for _, value := range s.strValues.mostCommon(dataset.MaxMostCommon) {
+			str_type.MostCommon = append(str_type.MostCommon, dataset.StringFrequency{Value: value.value, Count: value.count})
+		}
+		for _, ngram := range s.ngramValues.mostCommon(dataset.MaxNGrams) {
+			str_type.NGrams = append(str_type.NGrams, dataset.StringFrequency{Value: ngram.value, Count: ngram.count})
+		}
+	}
+	int_type := dataset.IntType{
+		Count: &int_count,
+		Min:   copyInt(s.minInt),
+		Max:   copyInt(s.maxInt),
+	}
+	for _, value := range s.intValues.mostCommon(dataset.MaxMostCommon) {
+		i, _ := strconv.ParseInt(value.value, 10, 64)
+		int_type.MostCommon = append(int_type.MostCommon, dataset.IntFrequency{Value: i, Count: value.count})
+	}
+	int_type.Unique, int_type.Sketch = sketchStatistics(s.intSketch)
+	if int_count > 0 {
+		int_type.Histogram = dataset.NewHistogram(s.intSample.values, dataset.HistogramBuckets).Scale(int_count)
+	}
+	float_type := dataset.FloatType{
+		Count: &num_count,
+		Min:   copyFloat(s.minFloat),
+		Max:   copyFloat(s.maxFloat),
+	}
+	float_type.Unique, float_type.Sketch = sketchStatistics(s.numberSketch)
+	if num_count > 0 {
+		float_type.Histogram = dataset.NewHistogram(s.numberSample.values, dataset.HistogramBuckets).Scale(num_count)
+	}
+
+	return &dataset.DataPath{
+		Path:       path,
+		Stringtype: &str_type,
+		Floattype:  &float_type,
+		Inttype:    &int_type,
+		Booltype:   &dataset.BooleanType{Count: &bool_count, FalseCount: &false_count, TrueCount: &true_count},
+		Nulltype:   &dataset.NullType{Count: &null_count},
+		Objecttype: &dataset.ObjectType{
+			Count:      &object_count,
+			MinMembers: copyUint(s.minMembers),
+			MaxMembers: copyUint(s.maxMembers),
+		},
+		Arraytype: &dataset.ArrayType{
+			Count:   &array_count,
+			MinSize: copyUint(s.minSize),
+			MaxSize: copyUint(s.maxSize),
+		},
+		Temporaltype: s.temporal.TemporalType(),
+		Count:        &count,
+	}
+}
+
+// Returns the estimated number of distinct values and a copy of the sketch
+func sketchStatistics(sketch *dataset.HyperLogLog) (*uint64, *dataset.HyperLogLog) {
+	if sketch == nil {
+		return nil, nil
+	}
+	unique := sketch.Estimate()
+	registers := make([]byte, len(sketch.Registers))
+	copy(registers, sketch.Registers)
+	return &unique, &dataset.HyperLogLog{Registers: registers}
+}
+
+func copyString(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func copyInt(v *int64) *int64 {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func copyUint(v *uint64) *uint64 {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func copyFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
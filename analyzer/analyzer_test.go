@@ -0,0 +1,210 @@
+package analyzer
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+)
+
+// Analyzes the line-separated JSON documents
+func analyze(t *testing.T, lines ...string) dataset.DataSet {
+	t.Helper()
+	a := New()
+	err := ReadDocuments(strings.NewReader(strings.Join(lines, "\n")), func(doc interface{}) error {
+		a.Add(doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not read documents: %v", err)
+	}
+	return a.DataSet("test")
+}
+
+func TestAnalyzerCounts(t *testing.T) {
+	ds := analyze(t,
+		`{"name": "a", "age": 1, "score": 1.5, "active": true, "tags": ["x", "y"], "address": {"city": "b"}}`,
+		`{"name": "b", "age": 2, "score": 2, "active": false, "tags": [], "address": null}`,
+		`{"name": "a", "age": "3", "active": true}`,
+	)
+	if *ds.Count != 3 || ds.ExpectedCount != 3 {
+		t.Errorf("dataset count = %d, %d, want 3", *ds.Count, ds.ExpectedCount)
+	}
+	tests := []struct {
+		path    string
+		count   uint64
+		strings uint64
+		ints    uint64
+		numbers uint64
+		bools   uint64
+		nulls   uint64
+		objects uint64
+		arrays  uint64
+	}{
+		{"", 3, 0, 0, 0, 0, 0, 3, 0},
+		{"/name", 3, 3, 0, 0, 0, 0, 0, 0},
+		{"/age", 3, 1, 2, 2, 0, 0, 0, 0},
+		{"/score", 2, 0, 1, 2, 0, 0, 0, 0},
+		{"/active", 3, 0, 0, 0, 3, 0, 0, 0},
+		{"/tags", 2, 0, 0, 0, 0, 0, 0, 2},
+		{"/tags/*", 2, 2, 0, 0, 0, 0, 0, 0},
+		{"/address", 2, 0, 0, 0, 0, 1, 1, 0},
+		{"/address/city", 1, 1, 0, 0, 0, 0, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			p, ok := ds.Paths[test.path]
+			if !ok {
+				t.Fatalf("path %q not analyzed", test.path)
+			}
+			got := []uint64{*p.Count, *p.Stringtype.Count, *p.Inttype.Count, *p.Floattype.Count, *p.Booltype.Count, *p.Nulltype.Count, *p.Objecttype.Count, *p.Arraytype.Count}
+			want := []uint64{test.count, test.strings, test.ints, test.numbers, test.bools, test.nulls, test.objects, test.arrays}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("counts of %q = %v, want %v", test.path, got, want)
+			}
+		})
+	}
+	if active := ds.Paths["/active"].Booltype; *active.TrueCount != 2 || *active.FalseCount != 1 {
+		t.Errorf("boolean counts = %d true, %d false, want 2, 1", *active.TrueCount, *active.FalseCount)
+	}
+	if tags := ds.Paths["/tags"].Arraytype; *tags.MinSize != 0 || *tags.MaxSize != 2 {
+		t.Errorf("array sizes = [%d, %d], want [0, 2]", *tags.MinSize, *tags.MaxSize)
+	}
+	if root := ds.Paths[""].Objecttype; *root.MinMembers != 3 || *root.MaxMembers != 6 {
+		t.Errorf("object members = [%d, %d], want [3, 6]", *root.MinMembers, *root.MaxMembers)
+	}
+}
+
+func TestAnalyzerValues(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, `{"id": `+strconv.Itoa(i)+`, "kind": "k`+strconv.Itoa(i%3)+`", "text": "`+strings.Repeat("a", i%10+1)+`"}`)
+	}
+	ds := analyze(t, lines...)
+
+	id := ds.Paths["/id"]
+	if *id.Inttype.Min != 1 || *id.Inttype.Max != 100 || *id.Floattype.Min != 1 || *id.Floattype.Max != 100 {
+		t.Errorf("id range = [%d, %d], [%v, %v], want [1, 100]", *id.Inttype.Min, *id.Inttype.Max, *id.Floattype.Min, *id.Floattype.Max)
+	}
+	if *id.Inttype.Unique != 100 || *id.Floattype.Unique != 100 {
+		t.Errorf("distinct ids = %d, %d, want 100", *id.Inttype.Unique, *id.Floattype.Unique)
+	}
+	if id.Inttype.Histogram.Total() != 100 || id.Floattype.Histogram.Total() != 100 {
+		t.Errorf("id histograms contain %d, %d values, want 100", id.Inttype.Histogram.Total(), id.Floattype.Histogram.Total())
+	}
+	if id.Stringtype.Unique != nil || id.Stringtype.Sketch != nil {
+		t.Errorf("path without strings has string statistics")
+	}
+
+	kind := ds.Paths["/kind"].Stringtype
+	want := []dataset.StringFrequency{{Value: "k1", Count: 34}, {Value: "k0", Count: 33}, {Value: "k2", Count: 33}}
+	if !reflect.DeepEqual(kind.MostCommon, want) {
+		t.Errorf("most common kinds = %v, want %v", kind.MostCommon, want)
+	}
+	if *kind.Unique != 3 || *kind.Min != "k0" || *kind.Max != "k2" {
+		t.Errorf("kinds = %d distinct in [%s, %s], want 3 in [k0, k2]", *kind.Unique, *kind.Min, *kind.Max)
+	}
+	if !reflect.DeepEqual(kind.Prefixes, []string{"k0", "k1", "k2"}) {
+		t.Errorf("kind prefixes = %v, want [k0 k1 k2]", kind.Prefixes)
+	}
+
+	text := ds.Paths["/text"].Stringtype
+	if *text.MinLength != 1 || *text.MaxLength != 10 || *text.AvgLength != 5.5 {
+		t.Errorf("text lengths = [%d, %d] with average %v, want [1, 10] with average 5.5", *text.MinLength, *text.MaxLength, *text.AvgLength)
+	}
+}
+
+func TestAnalyzerSketches(t *testing.T) {
+	ds := analyze(t, `{"a": "x"}`, `{"a": "y"}`, `{"a": "x"}`)
+	sketch := ds.Paths["/a"].Stringtype.Sketch
+	if sketch == nil || sketch.Estimate() != 2 {
+		t.Fatalf("sketch = %v, want an estimate of 2", sketch)
+	}
+	// The sketch of the dataset must not change with the analyzer
+	a := New()
+	a.Add(map[string]interface{}{"a": "x"})
+	first := a.DataSet("first")
+	a.Add(map[string]interface{}{"a": "y"})
+	if got := first.Paths["/a"].Stringtype.Sketch.Estimate(); got != 1 {
+		t.Errorf("sketch of the first dataset estimates %d values after adding more documents, want 1", got)
+	}
+}
+
+func TestAnalyzerTemporal(t *testing.T) {
+	ds := analyze(t, `{"day": "2021-03-04", "name": "x"}`, `{"day": "2021-01-01", "name": "2021-01-01"}`)
+	day := ds.Paths["/day"].Temporaltype
+	if day == nil || day.Format != dataset.FormatDate || day.Granularity != dataset.GranularityDay {
+		t.Errorf("temporal type of dates = %v, want format date", day)
+	}
+	if name := ds.Paths["/name"].Temporaltype; name != nil {
+		t.Errorf("temporal type of mixed strings = %v, want nil", name)
+	}
+}
+
+func TestPrefixList(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      []string
+		maxDistinct int
+		want        []string
+	}{
+		{"no strings", nil, 10, nil},
+		{"until no new prefixes", []string{"ab", "ac", "b"}, 10, []string{"ab", "ac", "b"}},
+		{"too many prefixes", []string{"ab", "ac", "ba", "bb"}, 2, []string{"ab", "ac", "ba", "bb"}},
+		{"first length exceeds", []string{"a", "b", "c"}, 2, []string{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &pathStatistics{prefixLimit: 10}
+			for _, value := range test.values {
+				s.addString(value, test.maxDistinct)
+			}
+			if got := s.prefixList(test.maxDistinct); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("prefixList() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFrequencyCounter(t *testing.T) {
+	c := &frequencyCounter{}
+	for _, value := range []string{"b", "a", "c", "a", "b", "a"} {
+		c.add(value)
+	}
+	want := []valueCount{{"a", 3}, {"b", 2}}
+	if got := c.mostCommon(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("mostCommon(2) = %v, want %v", got, want)
+	}
+	// Rare values are dropped when too many values are tracked
+	for i := 0; i < maxTrackedValues; i++ {
+		c.add(strconv.Itoa(i))
+	}
+	if len(c.counts) > maxTrackedValues {
+		t.Errorf("frequencyCounter tracks %d values, want at most %d", len(c.counts), maxTrackedValues)
+	}
+	if got := c.mostCommon(1); got[0].value != "a" {
+		t.Errorf("mostCommon(1) = %v, want a", got)
+	}
+}
+
+func TestSample(t *testing.T) {
+	s := &sample{}
+	for i := 0; i < 3*maxSampleSize; i++ {
+		s.add(float64(i))
+	}
+	if len(s.values) != maxSampleSize || s.seen != 3*maxSampleSize {
+		t.Errorf("sample contains %d of %d values, want %d of %d", len(s.values), s.seen, maxSampleSize, 3*maxSampleSize)
+	}
+	late := 0
+	for _, value := range s.values {
+		if value >= maxSampleSize {
+			late++
+		}
+	}
+	// About two thirds of a uniform sample are replaced by later values
+	if late < maxSampleSize/2 || late > maxSampleSize*4/5 {
+		t.Errorf("sample contains %d values added after it was full, want about %d", late, maxSampleSize*2/3)
+	}
+}
@@ -0,0 +1,84 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+)
+
+// ReadDocuments decodes a stream of line-separated JSON documents and passes each document to the handler.
+// Numbers are decoded as json.Number to distinguish integers from floats.
+func ReadDocuments(r io.Reader, handler func(doc interface{}) error) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := handler(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadFile decodes all documents of a line-separated JSON file and passes each document to the handler
+func ReadFile(filename string, handler func(doc interface{}) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ReadDocuments(f, handler); err != nil {
+		return fmt.Errorf("could not parse file %s: %v", filename, err)
+	}
+	return nil
+}
+
+// AnalyzeFiles analyzes one or more line-separated JSON files as a single dataset
+func AnalyzeFiles(name string, filenames ...string) (dataset.DataSet, error) {
+	analyzer := New()
+	for _, filename := range filenames {
+		err := ReadFile(filename, func(doc interface{}) error {
+			analyzer.Add(doc)
+			return nil
+		})
+		if err != nil {
+			return dataset.DataSet{}, err
+		}
+	}
+	return analyzer.DataSet(name), nil
+}
+
+// DatasetName returns the name of the dataset stored in the given file, which is the file name without extension
+func DatasetName(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// GetDatasets analyzes each given file as a separate dataset.
+// The datasets are named after their files.
+func GetDatasets(filenames []string) ([]dataset.DataSet, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("file provider requires at least one file")
+	}
+
+	var datasets []dataset.DataSet
+	for _, filename := range filenames {
+		dataset, err := AnalyzeFiles(DatasetName(filename), filename)
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, dataset)
+	}
+	return datasets, nil
+}
@@ -0,0 +1,52 @@
+package analyzer
+
+import "sort"
+
+// The maximum number of distinct values tracked per path before rare values are dropped
+const maxTrackedValues = 10000
+
+// frequencyCounter counts the occurrences of values with bounded memory (lossy counting).
+// If too many distinct values are tracked, the rarest values are dropped.
+// The counts of the remaining values may hence be underestimated by at most the current threshold.
+type frequencyCounter struct {
+	counts    map[string]uint64
+	threshold uint64
+}
+
+type valueCount struct {
+	value string
+	count uint64
+}
+
+func (c *frequencyCounter) add(value string) {
+	if c.counts == nil {
+		c.counts = make(map[string]uint64)
+	}
+	c.counts[value]++
+	for len(c.counts) > maxTrackedValues {
+		c.threshold++
+		for key, count := range c.counts {
+			if count <= c.threshold {
+				delete(c.counts, key)
+			}
+		}
+	}
+}
+
+// Returns the n most common values, ordered by descending count
+func (c *frequencyCounter) mostCommon(n int) []valueCount {
+	values := make([]valueCount, 0, len(c.counts))
+	for value, count := range c.counts {
+		values = append(values, valueCount{value: value, count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].count != values[j].count {
+			return values[i].count > values[j].count
+		}
+		return values[i].value < values[j].value
+	})
+	if len(values) > n {
+		values = values[:n]
+	}
+	return values
+}
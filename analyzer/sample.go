@@ -0,0 +1,28 @@
+package analyzer
+
+import "math/rand"
+
+// The maximum number of values kept in a sample
+const maxSampleSize = 10000
+
+// sample is a uniform reservoir sample of a stream of numbers.
+// The sample uses a fixed seed, so analyzing the same data always creates the same statistics.
+type sample struct {
+	values []float64
+	seen   uint64
+	rng    *rand.Rand
+}
+
+func (s *sample) add(value float64) {
+	s.seen++
+	if len(s.values) < maxSampleSize {
+		s.values = append(s.values, value)
+		return
+	}
+	if s.rng == nil {
+		s.rng = rand.New(rand.NewSource(1))
+	}
+	if i := s.rng.Int63n(int64(s.seen)); i < maxSampleSize {
+		s.values[i] = value
+	}
+}
@@ -3,17 +3,20 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/JODA-Explore/BETZE/analyzer"
+	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/urfave/cli/v2"
 )
 
 func fetch_datasets_command() *cli.Command {
 	return &cli.Command{
 		Name:      "fetch-dataset",
-		Usage:     "Fetches dataset(s) from the given source.",
+		Usage:     "Fetches dataset(s) from the given source. The FILE provider analyzes the given line-separated JSON files, one dataset per file.",
 		ArgsUsage: fmt.Sprintf("<provider %s> <sources ...>", dataset_providers),
 		Flags: []cli.Flag{
 			joda_flag(),
@@ -33,37 +36,133 @@ func fetch_datasets(c *cli.Context) error {
 	for i := 1; i < c.NArg(); i++ {
 		sources = append(sources, c.Args().Get(i))
 	}
+	var datasets []dataset.DataSet
+	var err error
 	switch strings.ToLower(c.Args().Get(0)) {
 	case "":
 		e := missingArgError{arg: "provider"}
 		return &e
 	case "joda":
 		joda_con := joda_connect(c.String(joda_host_opt))
-		datasets, err := joda_con.GetDatasets(sources)
+		datasets, err = joda_con.GetDatasets(sources)
 		if err != nil {
 			return fmt.Errorf("could not get datasets from JODA: %v", err)
 		}
-		b, err := json.Marshal(datasets)
+	case "file":
+		datasets, err = analyzer.GetDatasets(sources)
 		if err != nil {
-			return fmt.Errorf("could not convert dataset to JSON: %v", err)
+			return fmt.Errorf("could not analyze files: %v", err)
 		}
-		if filename := c.String("file"); len(filename) > 0 {
-			f, err := os.Create(filename)
-			if err != nil {
-				return fmt.Errorf("could not create file: %v", err)
-			}
-			defer f.Close()
-			f.Write(b)
-			f.Sync()
-		} else {
-			fmt.Println(string(b))
-		}
-		fmt.Printf("Fetched %d dataset(s) in %v\n", len(datasets), time.Since(overall_start_time))
 	default:
 		exp := dataset_providers
 		e := unknownArgValueError{arg: "provider", val: c.Args().Get(0), expected: &exp}
 		return &e
 	}
 
+	err = write_datasets(c.String("file"), datasets)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fetched %d dataset(s) in %v\n", len(datasets), time.Since(overall_start_time))
+
+	return nil
+}
+
+func merge_datasets_command() *cli.Command {
+	return &cli.Command{
+		Name:      "merge-datasets",
+		Usage:     "Merges all datasets of the given dataset files (e.g. separately analyzed shards) into a single dataset.",
+		ArgsUsage: "<dataset.json ...>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "file",
+				Usage: "A file to which the merged dataset should be written",
+				Value: "datasets.json",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "The name of the merged dataset (default: name of the first dataset)",
+			},
+		},
+		Action: merge_datasets,
+	}
+}
+
+func merge_datasets(c *cli.Context) error {
+	if c.NArg() == 0 {
+		e := missingArgError{arg: "dataset"}
+		return &e
+	}
+
+	var merged *dataset.DataSet
+	num_datasets := 0
+	for _, filename := range c.Args().Slice() {
+		datasets, err := read_datasets(filename)
+		if err != nil {
+			return err
+		}
+		for i := range datasets {
+			num_datasets++
+			if merged == nil {
+				merged = &datasets[i]
+			} else {
+				merged.Merge(datasets[i])
+			}
+		}
+	}
+	if merged == nil {
+		return fmt.Errorf("no datasets found in the given files")
+	}
+	if name := c.String("name"); len(name) > 0 {
+		merged.Name = name
+	}
+
+	err := write_datasets(c.String("file"), []dataset.DataSet{*merged})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d dataset(s) into '%s'\n", num_datasets, merged.Name)
+
+	return nil
+}
+
+// Reads a list of datasets from a JSON file
+func read_datasets(filename string) ([]dataset.DataSet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: \"%v\"", err)
+	}
+	defer f.Close()
+	byteValue, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: \"%v\"", err)
+	}
+
+	var datasets []dataset.DataSet
+
+	err = json.Unmarshal(byteValue, &datasets)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse dataset file: \"%v\"", err)
+	}
+	return datasets, nil
+}
+
+// Writes the datasets as JSON to the file, or to stdout if no file is given
+func write_datasets(filename string, datasets []dataset.DataSet) error {
+	b, err := json.Marshal(datasets)
+	if err != nil {
+		return fmt.Errorf("could not convert dataset to JSON: %v", err)
+	}
+	if len(filename) > 0 {
+		f, err := os.Create(filename)
+		if err != nil {
+			return fmt.Errorf("could not create file: %v", err)
+		}
+		defer f.Close()
+		f.Write(b)
+		f.Sync()
+	} else {
+		fmt.Println(string(b))
+	}
 	return nil
 }
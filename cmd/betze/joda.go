@@ -3,7 +3,10 @@ package main
 import (
 	"log"
 
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/generator"
 	"github.com/JODA-Explore/BETZE/languages/joda"
+	"github.com/JODA-Explore/BETZE/query"
 )
 
 func joda_connect(host string) *joda.JodaConnection {
@@ -18,3 +21,41 @@ func joda_connect(host string) *joda.JodaConnection {
 	}
 	return nil
 }
+
+// Returns copies of the datasets without the timestamps JODA can not compare or bucket, they are used as plain numbers and strings instead
+func without_joda_temporal(datasets []dataset.DataSet) []dataset.DataSet {
+	stripped := make([]dataset.DataSet, len(datasets))
+	for i, d := range datasets {
+		stripped[i] = strip_joda_temporal(d)
+	}
+	return stripped
+}
+
+// Returns a copy of the dataset without the timestamps JODA can not compare or bucket.
+// The statistics of the paths are shared with the original dataset, only the changed paths are copied.
+func strip_joda_temporal(d dataset.DataSet) dataset.DataSet {
+	paths := make(map[string]*dataset.DataPath, len(d.Paths))
+	for name, path := range d.Paths {
+		if path != nil && path.Temporaltype != nil && !joda.SupportsTemporal(path.Temporaltype.Format) {
+			stripped := *path
+			stripped.Temporaltype = nil
+			path = &stripped
+		}
+		paths[name] = path
+	}
+	d.Paths = paths
+	return d
+}
+
+// Validator removing the timestamps JODA can not handle from the analyzed datasets
+type joda_temporal_validator struct {
+	generator.Validator
+}
+
+func (v joda_temporal_validator) Analyze(q query.Query) (dataset.DataSet, error) {
+	d, err := v.Validator.Analyze(q)
+	if err != nil {
+		return d, err
+	}
+	return strip_joda_temporal(d), nil
+}
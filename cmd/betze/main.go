@@ -32,7 +32,7 @@ func (e *unknownArgValueError) Error() string {
 
 const (
 	joda_host_opt     = "joda-host"
-	dataset_providers = "{JODA}"
+	dataset_providers = "{JODA, FILE}"
 )
 
 func initialize_cli(c *cli.Context) error {
@@ -67,6 +67,7 @@ func main() {
 		EnableBashCompletion: true,
 		Commands: []*cli.Command{
 			fetch_datasets_command(),
+			merge_datasets_command(),
 			generate_queries_command(),
 			translate_queries_command(),
 		},
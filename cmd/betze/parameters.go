@@ -31,6 +31,46 @@ func aggregate_probability_flag() *cli.Float64Flag {
 	}
 }
 
+func multi_aggregation_probability_flag() *cli.Float64Flag {
+	return &cli.Float64Flag{
+		Name:  "multi-aggregation-probability",
+		Value: 0.2,
+		Usage: "The probability to compute another aggregation in an aggregated query, repeated for up to 4 aggregations. Only used if --aggregate is set, as queries are only aggregated then",
+	}
+}
+
+func unwind_probability_flag() *cli.Float64Flag {
+	return &cli.Float64Flag{
+		Name:  "unwind-probability",
+		Value: 0.1,
+		Usage: "The probability to unwind an array of an original dataset into one document per element before filtering",
+	}
+}
+
+func join_probability_flag() *cli.Float64Flag {
+	return &cli.Float64Flag{
+		Name:  "join-probability",
+		Value: 0.1,
+		Usage: "The probability to join another original dataset with an original dataset on paths with overlapping values before filtering",
+	}
+}
+
+func projection_probability_flag() *cli.Float64Flag {
+	return &cli.Float64Flag{
+		Name:  "projection-probability",
+		Value: 0.2,
+		Usage: "The probability to project the documents of an unaggregated query to a subset of their paths. With --aggregate, only queries left unaggregated by --aggregation-probability are projected",
+	}
+}
+
+func order_probability_flag() *cli.Float64Flag {
+	return &cli.Float64Flag{
+		Name:  "order-probability",
+		Value: 0.2,
+		Usage: "The probability to order the result of a query and limit it to the first results. Not used with --intermediate-sets, as the intermediate sets would be limited",
+	}
+}
+
 func intermediate_flag() *cli.BoolFlag {
 	return &cli.BoolFlag{
 		Name:  "intermediate-sets",
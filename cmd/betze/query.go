@@ -1,17 +1,15 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/evaluator"
 	"github.com/JODA-Explore/BETZE/generator"
-	"github.com/JODA-Explore/BETZE/query"
+	"github.com/JODA-Explore/BETZE/languages/joda"
 
 	"github.com/urfave/cli/v2"
 )
@@ -46,6 +44,11 @@ func generate_queries_command() *cli.Command {
 			Usage:       "The probability to randomly jump to another node",
 			DefaultText: "0.1",
 		},
+		&cli.Float64Flag{
+			Name:  "negation-probability",
+			Value: 0.1,
+			Usage: "The probability to negate a predicate if this moves its selectivity into the desired range",
+		},
 		&cli.Int64Flag{
 			Name:        "num_queries",
 			Value:       -1,
@@ -55,6 +58,11 @@ func generate_queries_command() *cli.Command {
 		intermediate_flag(),
 		aggregate_flag(),
 		aggregate_probability_flag(),
+		multi_aggregation_probability_flag(),
+		unwind_probability_flag(),
+		join_probability_flag(),
+		projection_probability_flag(),
+		order_probability_flag(),
 		&cli.StringSliceFlag{
 			Name:    "include-aggregation",
 			Aliases: []string{"a"},
@@ -88,6 +96,10 @@ func generate_queries_command() *cli.Command {
 			Value: "betze.json",
 		},
 		joda_flag(),
+		&cli.StringSliceFlag{
+			Name:  "validation-file",
+			Usage: "Line-separated JSON files of the datasets (one file per dataset, named after the file). If provided and no JODA host is given, the generated queries are verified in memory.",
+		},
 	}
 
 	// For each language add the corresponding file flag
@@ -116,21 +128,9 @@ func generate_queries(c *cli.Context) error {
 
 	// Parse dataset file
 	dataset_file := c.Args().Get(0)
-	f, err := os.Open(dataset_file)
+	datasets, err := read_datasets(dataset_file)
 	if err != nil {
-		return fmt.Errorf("could not open file: \"%v\"", err)
-	}
-	defer f.Close()
-	byteValue, err := ioutil.ReadAll(f)
-	if err != nil {
-		return fmt.Errorf("could not read file: \"%v\"", err)
-	}
-
-	var datasets []dataset.DataSet
-
-	err = json.Unmarshal(byteValue, &datasets)
-	if err != nil {
-		return fmt.Errorf("could not parse dataset file: \"%v\"", err)
+		return err
 	}
 
 	if !is_preset(c.String("preset")) {
@@ -229,18 +229,39 @@ func generate_queries(c *cli.Context) error {
 	if c.Bool("aggregate") {
 		query_generator.Aggregations = aggregationRepo.GetChosen()
 	}
+	// Intermediate sets would only contain the limited results
+	if !c.Bool("intermediate-sets") {
+		query_generator.OrderProb = c.Float64("order-probability")
+	}
+	query_generator.UnwindProb = c.Float64("unwind-probability")
+	query_generator.JoinProb = c.Float64("join-probability")
+	query_generator.ProjectionProb = c.Float64("projection-probability")
 	query_generator.AggregationProb = c.Float64("aggregation-probability")
+	query_generator.MultiAggregationProb = c.Float64("multi-aggregation-probability")
+	query_generator.NegationProb = c.Float64("negation-probability")
 	query_generator.WeightedPaths = c.Bool("weighted-paths")
 
-	var queries []query.Query
+	var validator generator.Validator
 	joda_con := joda_connect(c.String(joda_host_opt))
 	if joda_con != nil {
-		queries, err = query_generator.GenerateQuerySetWithJoda(datasets, num_queries, *joda_con)
+		// JODA could not check the selectivity of predicates on timestamps it can not compare
+		datasets = without_joda_temporal(datasets)
+		// JODA can not create multiple documents from one document, so unwinding and joining queries could not be validated
+		query_generator.UnwindProb = 0
+		query_generator.JoinProb = 0
+		validator = joda_temporal_validator{Validator: joda.Validator{Connection: joda_con}}
+	} else if files := c.StringSlice("validation-file"); len(files) > 0 {
+		memory_validator := evaluator.NewValidator()
+		err = memory_validator.LoadFiles(files)
 		if err != nil {
-			return err
+			return fmt.Errorf("could not load validation files: %v", err)
 		}
-	} else {
-		queries = query_generator.GenerateQuerySet(datasets, num_queries)
+		validator = memory_validator
+	}
+
+	queries, err := query_generator.GenerateQuerySet(datasets, num_queries, validator)
+	if err != nil {
+		return err
 	}
 
 	//Common header for all query files
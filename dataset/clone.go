@@ -0,0 +1,177 @@
+package dataset
+
+import "time"
+
+// Returns a deep copy of the path, so merged paths do not share statistics with the paths they were merged from
+func (p *DataPath) clone() *DataPath {
+	return &DataPath{
+		Path:         p.Path,
+		Stringtype:   p.Stringtype.clone(),
+		Floattype:    p.Floattype.clone(),
+		Inttype:      p.Inttype.clone(),
+		Booltype:     p.Booltype.clone(),
+		Nulltype:     p.Nulltype.clone(),
+		Objecttype:   p.Objecttype.clone(),
+		Arraytype:    p.Arraytype.clone(),
+		Temporaltype: p.Temporaltype.clone(),
+		Count:        cloneUint(p.Count),
+	}
+}
+
+func (t *StringType) clone() *StringType {
+	if t == nil {
+		return nil
+	}
+	return &StringType{
+		Count:      cloneUint(t.Count),
+		Min:        cloneString(t.Min),
+		Max:        cloneString(t.Max),
+		Unique:     cloneUint(t.Unique),
+		Sketch:     t.Sketch.clone(),
+		Prefixes:   append([]string(nil), t.Prefixes...),
+		MostCommon: append([]StringFrequency(nil), t.MostCommon...),
+		NGrams:     append([]StringFrequency(nil), t.NGrams...),
+		MinLength:  cloneUint(t.MinLength),
+		MaxLength:  cloneUint(t.MaxLength),
+		AvgLength:  cloneFloat(t.AvgLength),
+	}
+}
+
+func (t *FloatType) clone() *FloatType {
+	if t == nil {
+		return nil
+	}
+	return &FloatType{
+		Count:     cloneUint(t.Count),
+		Min:       cloneFloat(t.Min),
+		Max:       cloneFloat(t.Max),
+		Unique:    cloneUint(t.Unique),
+		Sketch:    t.Sketch.clone(),
+		Histogram: t.Histogram.clone(),
+	}
+}
+
+func (t *IntType) clone() *IntType {
+	if t == nil {
+		return nil
+	}
+	return &IntType{
+		Count:      cloneUint(t.Count),
+		Min:        cloneInt(t.Min),
+		Max:        cloneInt(t.Max),
+		Unique:     cloneUint(t.Unique),
+		Sketch:     t.Sketch.clone(),
+		MostCommon: append([]IntFrequency(nil), t.MostCommon...),
+		Histogram:  t.Histogram.clone(),
+	}
+}
+
+func (t *BooleanType) clone() *BooleanType {
+	if t == nil {
+		return nil
+	}
+	return &BooleanType{
+		Count:      cloneUint(t.Count),
+		FalseCount: cloneUint(t.FalseCount),
+		TrueCount:  cloneUint(t.TrueCount),
+	}
+}
+
+func (t *NullType) clone() *NullType {
+	if t == nil {
+		return nil
+	}
+	return &NullType{Count: cloneUint(t.Count)}
+}
+
+func (t *ObjectType) clone() *ObjectType {
+	if t == nil {
+		return nil
+	}
+	return &ObjectType{
+		Count:      cloneUint(t.Count),
+		MinMembers: cloneUint(t.MinMembers),
+		MaxMembers: cloneUint(t.MaxMembers),
+	}
+}
+
+func (t *ArrayType) clone() *ArrayType {
+	if t == nil {
+		return nil
+	}
+	return &ArrayType{
+		Count:   cloneUint(t.Count),
+		MinSize: cloneUint(t.MinSize),
+		MaxSize: cloneUint(t.MaxSize),
+	}
+}
+
+func (t *TemporalType) clone() *TemporalType {
+	if t == nil {
+		return nil
+	}
+	return &TemporalType{
+		Count:       cloneUint(t.Count),
+		Format:      t.Format,
+		Min:         cloneTime(t.Min),
+		Max:         cloneTime(t.Max),
+		Granularity: t.Granularity,
+	}
+}
+
+func (h *HyperLogLog) clone() *HyperLogLog {
+	if h == nil {
+		return nil
+	}
+	return &HyperLogLog{Registers: append([]byte(nil), h.Registers...)}
+}
+
+func (h *Histogram) clone() *Histogram {
+	if h == nil {
+		return nil
+	}
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+	}
+}
+
+func cloneUint(v *uint64) *uint64 {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func cloneInt(v *int64) *int64 {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func cloneFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func cloneString(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
+
+func cloneTime(v *time.Time) *time.Time {
+	if v == nil {
+		return nil
+	}
+	tmp := *v
+	return &tmp
+}
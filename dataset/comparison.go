@@ -0,0 +1,189 @@
+package dataset
+
+import (
+	"math"
+	"sort"
+)
+
+// The number of points used to approximate a uniform distribution between min and max
+const uniformPoints = 64
+
+// FractionBelow estimates the fraction of numbers at the path smaller than (or equal to, if inclusive) the given value.
+// The histogram is used if it exists, otherwise the numbers are assumed to be distributed uniformly between min and max.
+// If neither is known, false is returned.
+func (l *FloatType) FractionBelow(value float64, inclusive bool) (float64, bool) {
+	if l.Histogram != nil {
+		return l.Histogram.FractionBelow(value, inclusive), true
+	}
+	if l.Min == nil || l.Max == nil {
+		return 0.0, false
+	}
+	switch {
+	case value < *l.Min || (value == *l.Min && !inclusive):
+		return 0.0, true
+	case value > *l.Max || (value == *l.Max && inclusive):
+		return 1.0, true
+	case *l.Min == *l.Max:
+		return 0.0, true
+	default:
+		return (value - *l.Min) / (*l.Max - *l.Min), true
+	}
+}
+
+// Overlaps checks whether the value ranges of both number types overlap.
+// If a range is not known, false is returned.
+func (l *FloatType) Overlaps(r *FloatType) bool {
+	if l.Min == nil || l.Max == nil || r.Min == nil || r.Max == nil {
+		return false
+	}
+	return *l.Min <= *r.Max && *r.Min <= *l.Max
+}
+
+// ComparisonFraction estimates the fraction of value pairs, one value of each type, in which the left value is smaller than (or equal to, if inclusive) the right value.
+// The values of both types are assumed to be independent.
+// If the distribution of a type is not known, false is returned.
+func (l *FloatType) ComparisonFraction(r *FloatType, inclusive bool) (float64, bool) {
+	points := r.points()
+	if len(points) == 0 {
+		return 0.0, false
+	}
+	total := 0.0
+	below := 0.0
+	for _, point := range points {
+		fraction, ok := l.FractionBelow(point.value, inclusive)
+		if !ok {
+			return 0.0, false
+		}
+		below += fraction * point.weight
+		total += point.weight
+	}
+	return below / total, true
+}
+
+// Approximates the numbers of the type with weighted points
+func (l *FloatType) points() []weightedValue {
+	if l.Histogram != nil {
+		return l.Histogram.points()
+	}
+	if l.Min == nil || l.Max == nil {
+		return nil
+	}
+	if *l.Min == *l.Max {
+		return []weightedValue{{value: *l.Min, weight: 1.0}}
+	}
+	points := make([]weightedValue, uniformPoints)
+	for i := range points {
+		step := (float64(i) + 0.5) / uniformPoints
+		points[i] = weightedValue{value: *l.Min + (*l.Max-*l.Min)*step, weight: 1.0}
+	}
+	return points
+}
+
+// Overlaps checks whether the value ranges of both string types overlap.
+// If a range is not known, true is assumed.
+func (l *StringType) Overlaps(r *StringType) bool {
+	if l.Min == nil || l.Max == nil || r.Min == nil || r.Max == nil {
+		return true
+	}
+	return *l.Min <= *r.Max && *r.Min <= *l.Max
+}
+
+// EqualityFraction estimates the fraction of value pairs, one value of each type, in which both values are equal.
+// The most common values of both types are matched with each other.
+// The remaining values are assumed to be distributed uniformly among the distinct values of the type with more distinct values.
+// If neither most common values nor the number of distinct values are known, false is returned.
+func (l *StringType) EqualityFraction(r *StringType) (float64, bool) {
+	if !l.Overlaps(r) {
+		return 0.0, true
+	}
+	// The values are sorted, so the estimation does not depend on the iteration order
+	seen := make(map[string]struct{})
+	var values []string
+	for _, freq := range append(append([]StringFrequency{}, l.MostCommon...), r.MostCommon...) {
+		if _, ok := seen[freq.Value]; !ok {
+			seen[freq.Value] = struct{}{}
+			values = append(values, freq.Value)
+		}
+	}
+	sort.Strings(values)
+
+	var fractions []valueFractions
+	for _, value := range values {
+		l_fraction, l_ok := l.ValueFraction(value)
+		r_fraction, r_ok := r.ValueFraction(value)
+		if l_ok && r_ok {
+			fractions = append(fractions, valueFractions{l: l_fraction, r: r_fraction})
+		}
+	}
+	return equalityFraction(fractions, len(values), l.Unique, r.Unique)
+}
+
+// Overlaps checks whether the value ranges of both integer types overlap.
+// If a range is not known, true is assumed.
+func (l *IntType) Overlaps(r *IntType) bool {
+	if l.Min == nil || l.Max == nil || r.Min == nil || r.Max == nil {
+		return true
+	}
+	return *l.Min <= *r.Max && *r.Min <= *l.Max
+}
+
+// EqualityFraction estimates the fraction of value pairs, one value of each type, in which both values are equal, like StringType.EqualityFraction.
+func (l *IntType) EqualityFraction(r *IntType) (float64, bool) {
+	if !l.Overlaps(r) {
+		return 0.0, true
+	}
+	// The values are sorted, so the estimation does not depend on the iteration order
+	seen := make(map[int64]struct{})
+	var values []int64
+	for _, freq := range append(append([]IntFrequency{}, l.MostCommon...), r.MostCommon...) {
+		if _, ok := seen[freq.Value]; !ok {
+			seen[freq.Value] = struct{}{}
+			values = append(values, freq.Value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	var fractions []valueFractions
+	for _, value := range values {
+		l_fraction, l_ok := l.ValueFraction(value)
+		r_fraction, r_ok := r.ValueFraction(value)
+		if l_ok && r_ok {
+			fractions = append(fractions, valueFractions{l: l_fraction, r: r_fraction})
+		}
+	}
+	return equalityFraction(fractions, len(values), l.Unique, r.Unique)
+}
+
+// The fractions of a common value among the values of both types
+type valueFractions struct {
+	l float64
+	r float64
+}
+
+// Estimates the fraction of equal value pairs from the fractions of the common values known in both types.
+// The remaining values are assumed to be distributed uniformly among the larger number of distinct values, without the common values.
+func equalityFraction(fractions []valueFractions, common int, l_unique *uint64, r_unique *uint64) (float64, bool) {
+	equal := 0.0
+	l_common := 0.0
+	r_common := 0.0
+	for _, fraction := range fractions {
+		equal += fraction.l * fraction.r
+		l_common += fraction.l
+		r_common += fraction.r
+	}
+	known := len(fractions) > 0
+
+	var unique uint64
+	if l_unique != nil {
+		unique = *l_unique
+	}
+	if r_unique != nil && *r_unique > unique {
+		unique = *r_unique
+	}
+	if unique > uint64(common) {
+		remaining := math.Max(1.0-l_common, 0.0) * math.Max(1.0-r_common, 0.0)
+		equal += remaining / float64(unique-uint64(common))
+		known = true
+	}
+	return math.Min(equal, 1.0), known
+}
@@ -0,0 +1,137 @@
+package dataset
+
+import (
+	"math"
+	"testing"
+)
+
+func floatRange(min float64, max float64) *FloatType {
+	return &FloatType{Min: &min, Max: &max}
+}
+
+func TestFloatFractionBelow(t *testing.T) {
+	tests := []struct {
+		name      string
+		t         *FloatType
+		value     float64
+		inclusive bool
+		want      float64
+		ok        bool
+	}{
+		{"unknown range", &FloatType{}, 1, false, 0.0, false},
+		{"minimum", floatRange(0, 10), 0, false, 0.0, true},
+		{"maximum", floatRange(0, 10), 10, true, 1.0, true},
+		{"uniform", floatRange(0, 10), 2.5, false, 0.25, true},
+		{"single value", floatRange(5, 5), 5, false, 0.0, true},
+		{"single value inclusive", floatRange(5, 5), 5, true, 1.0, true},
+		{"histogram", &FloatType{Histogram: NewHistogram(sequence(10), 5)}, 10, true, 1.0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.t.FractionBelow(test.value, test.inclusive)
+			if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("FractionBelow(%v, %v) = %v, %v, want %v, %v", test.value, test.inclusive, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestComparisonFraction(t *testing.T) {
+	tests := []struct {
+		name string
+		l    *FloatType
+		r    *FloatType
+		want float64
+		ok   bool
+	}{
+		{"unknown left", &FloatType{}, floatRange(0, 10), 0.0, false},
+		{"unknown right", floatRange(0, 10), &FloatType{}, 0.0, false},
+		{"same range", floatRange(0, 10), floatRange(0, 10), 0.5, true},
+		{"left smaller", floatRange(0, 10), floatRange(20, 30), 1.0, true},
+		{"left larger", floatRange(20, 30), floatRange(0, 10), 0.0, true},
+		{"half overlap", floatRange(0, 10), floatRange(5, 15), 0.875, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.l.ComparisonFraction(test.r, false)
+			if ok != test.ok || math.Abs(got-test.want) > 0.01 {
+				t.Errorf("ComparisonFraction() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	a, b, c := "a", "b", "c"
+	one, two, three := int64(1), int64(2), int64(3)
+	if !floatRange(0, 10).Overlaps(floatRange(10, 20)) || floatRange(0, 10).Overlaps(floatRange(11, 20)) {
+		t.Errorf("FloatType.Overlaps() does not compare the ranges")
+	}
+	if (&FloatType{}).Overlaps(floatRange(0, 10)) {
+		t.Errorf("FloatType.Overlaps() with unknown range = true, want false")
+	}
+	if !(&StringType{Min: &a, Max: &b}).Overlaps(&StringType{Min: &b, Max: &c}) || (&StringType{Min: &a, Max: &a}).Overlaps(&StringType{Min: &b, Max: &c}) {
+		t.Errorf("StringType.Overlaps() does not compare the ranges")
+	}
+	if !(&StringType{}).Overlaps(&StringType{Min: &b, Max: &c}) {
+		t.Errorf("StringType.Overlaps() with unknown range = false, want true")
+	}
+	if !(&IntType{Min: &one, Max: &two}).Overlaps(&IntType{Min: &two, Max: &three}) || (&IntType{Min: &one, Max: &one}).Overlaps(&IntType{Min: &two, Max: &three}) {
+		t.Errorf("IntType.Overlaps() does not compare the ranges")
+	}
+	if !(&IntType{}).Overlaps(&IntType{Min: &two, Max: &three}) {
+		t.Errorf("IntType.Overlaps() with unknown range = false, want true")
+	}
+}
+
+func TestStringEqualityFraction(t *testing.T) {
+	a, b, z := "a", "b", "z"
+	common := &StringType{Count: uint64Pointer(10), Unique: uint64Pointer(2), MostCommon: []StringFrequency{{"a", 5}, {"b", 5}}}
+	tests := []struct {
+		name string
+		l    *StringType
+		r    *StringType
+		want float64
+		ok   bool
+	}{
+		{"unknown", &StringType{}, &StringType{}, 0.0, false},
+		{"disjoint ranges", &StringType{Min: &a, Max: &b}, &StringType{Min: &z, Max: &z}, 0.0, true},
+		{"most common values", common, common, 0.5, true},
+		{"single most common value", common, &StringType{Count: uint64Pointer(4), MostCommon: []StringFrequency{{"a", 4}}}, 0.5, true},
+		{"uniform", &StringType{Unique: uint64Pointer(10)}, &StringType{Unique: uint64Pointer(5)}, 0.1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.l.EqualityFraction(test.r)
+			if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("EqualityFraction() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestIntEqualityFraction(t *testing.T) {
+	one, two, nine := int64(1), int64(2), int64(9)
+	common := &IntType{Count: uint64Pointer(10), Unique: uint64Pointer(2), MostCommon: []IntFrequency{{1, 5}, {2, 5}}}
+	tests := []struct {
+		name string
+		l    *IntType
+		r    *IntType
+		want float64
+		ok   bool
+	}{
+		{"unknown", &IntType{}, &IntType{}, 0.0, false},
+		{"disjoint ranges", &IntType{Min: &one, Max: &two}, &IntType{Min: &nine, Max: &nine}, 0.0, true},
+		{"most common values", common, common, 0.5, true},
+		{"single most common value", common, &IntType{Count: uint64Pointer(4), MostCommon: []IntFrequency{{1, 4}}}, 0.5, true},
+		{"uniform", &IntType{Unique: uint64Pointer(10)}, &IntType{Unique: uint64Pointer(5)}, 0.1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.l.EqualityFraction(test.r)
+			if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("EqualityFraction() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package dataset
 
 import (
 	"math"
+	"sort"
+	"unicode/utf8"
 
 	"github.com/adam-lavrik/go-imath/i64"
 	"github.com/adam-lavrik/go-imath/u64"
@@ -30,6 +32,33 @@ func (d *DataSet) GetSize() uint64 {
 	return d.ExpectedCount
 }
 
+// Merge merges two DataSets, e.g. separately analyzed shards of the same data, and accumulates their statistics.
+// The name of the left DataSet is kept. The document count is only known if it is known for both DataSets.
+func (l *DataSet) Merge(r DataSet) *DataSet {
+	if l.Count != nil && r.Count != nil {
+		count := *l.Count + *r.Count
+		l.Count = &count
+	} else {
+		l.Count = nil
+	}
+	l.ExpectedCount = l.GetSize() + r.GetSize()
+
+	if l.Paths == nil {
+		l.Paths = make(map[string]*DataPath)
+	}
+	for path, r_path := range r.Paths {
+		if r_path == nil {
+			continue
+		}
+		if l_path, ok := l.Paths[path]; ok && l_path != nil {
+			l_path.Merge(*r_path)
+		} else {
+			l.Paths[path] = r_path.clone()
+		}
+	}
+	return l
+}
+
 // A DataPath represents a single path within a document of a DataSet.
 type DataPath struct {
 	// The Path expression of the Path
@@ -48,16 +77,30 @@ type DataPath struct {
 	Objecttype *ObjectType
 	// Information about the existence and distribution of array values
 	Arraytype *ArrayType
+	// Information about timestamps, if all string or number values of the path are timestamps
+	Temporaltype *TemporalType
 	// Information about the existence of the path
 	Count *uint64
 }
 
 // Merge merges two DataPaths and accumulates their statistics.
 // They have to represent the same path. If not, nil is returned.
+// The statistics of the right DataPath are copied, so it is not changed by later merges.
 func (l *DataPath) Merge(r DataPath) *DataPath {
 	if l.Path != r.Path {
 		return nil
 	}
+	r = *r.clone()
+
+	// A path is only temporal if the values of both paths are timestamps
+	switch {
+	case l.Temporaltype != nil && r.Temporaltype != nil:
+		l.Temporaltype = l.Temporaltype.merge(*r.Temporaltype)
+	case l.Temporaltype == nil && !(l.HasStringCount() || l.HasNumCount()):
+		l.Temporaltype = r.Temporaltype
+	case r.Temporaltype == nil && (r.HasStringCount() || r.HasNumCount()):
+		l.Temporaltype = nil
+	}
 
 	if l.Stringtype == nil {
 		l.Stringtype = r.Stringtype
@@ -82,6 +125,30 @@ func (l *DataPath) Merge(r DataPath) *DataPath {
 	} else if r.Nulltype != nil {
 		l.Nulltype.merge(*r.Nulltype)
 	}
+
+	if l.Inttype == nil {
+		l.Inttype = r.Inttype
+	} else if r.Inttype != nil {
+		l.Inttype.merge(*r.Inttype)
+	}
+
+	if l.Objecttype == nil {
+		l.Objecttype = r.Objecttype
+	} else if r.Objecttype != nil {
+		l.Objecttype.merge(*r.Objecttype)
+	}
+
+	if l.Arraytype == nil {
+		l.Arraytype = r.Arraytype
+	} else if r.Arraytype != nil {
+		l.Arraytype.merge(*r.Arraytype)
+	}
+
+	if l.Count == nil {
+		l.Count = r.Count
+	} else if r.Count != nil {
+		*l.Count += *r.Count
+	}
 	return l
 }
 
@@ -109,25 +176,47 @@ func (l *DataPath) HasBoolCount() bool {
 // The type may be augmented with statistics about the distribution of the data
 type StringType struct {
 	// An optional count of how many documents have the given type at the path
-	Count    *uint64
-	Min      *string
-	Max      *string
-	Unique   *uint64
+	Count  *uint64
+	Min    *string
+	Max    *string
+	Unique *uint64
+	// A sketch of the distinct values, used to merge Unique
+	Sketch   *HyperLogLog
 	Prefixes []string
+	// The most common values, ordered by descending frequency
+	MostCommon []StringFrequency
+	// The most common n-grams, ordered by descending number of values containing them
+	NGrams []StringFrequency
+	// The minimum, maximum and average number of characters of the values
+	MinLength *uint64
+	MaxLength *uint64
+	AvgLength *float64
+}
+
+// ValueFraction estimates the fraction of string values at the path that are equal to the given value.
+// If no most common values are known, false is returned.
+func (l *StringType) ValueFraction(value string) (float64, bool) {
+	counts := make([]uint64, len(l.MostCommon))
+	for i, freq := range l.MostCommon {
+		if freq.Value == value {
+			return valueFraction(l.Count, l.Unique, []uint64{freq.Count}, true)
+		}
+		counts[i] = freq.Count
+	}
+	return valueFraction(l.Count, l.Unique, counts, false)
 }
 
 func (l *StringType) merge(r StringType) *StringType {
+	// The average is weighted with the counts before merging them
+	l.AvgLength = mergeAverage(l.AvgLength, l.Count, r.AvgLength, r.Count)
+
 	if l.Count == nil {
 		l.Count = r.Count
 	} else if r.Count != nil {
 		*l.Count += *r.Count
 	}
 
-	if l.Unique == nil {
-		l.Unique = r.Unique
-	} else if r.Unique != nil {
-		*l.Unique += *r.Unique
-	}
+	l.Unique, l.Sketch = mergeUnique(l.Unique, l.Sketch, r.Unique, r.Sketch)
 
 	if l.Min == nil {
 		l.Min = r.Min
@@ -145,9 +234,65 @@ func (l *StringType) merge(r StringType) *StringType {
 		}
 	}
 
+	if l.MinLength == nil {
+		l.MinLength = r.MinLength
+	} else if r.MinLength != nil {
+		*l.MinLength = u64.Min(*l.MinLength, *r.MinLength)
+	}
+
+	if l.MaxLength == nil {
+		l.MaxLength = r.MaxLength
+	} else if r.MaxLength != nil {
+		*l.MaxLength = u64.Max(*l.MaxLength, *r.MaxLength)
+	}
+
+	l.Prefixes = mergePrefixes(l.Prefixes, r.Prefixes)
+	l.MostCommon = mergeStringFrequencies(l.MostCommon, r.MostCommon, MaxMostCommon)
+	l.NGrams = mergeStringFrequencies(l.NGrams, r.NGrams, MaxNGrams)
+
 	return l
 }
 
+// Returns the sorted union of both prefix lists.
+// The lists may have been collected with different prefix lengths, so the prefixes are cut to the shorter length of both lists.
+func mergePrefixes(l []string, r []string) []string {
+	if len(r) == 0 {
+		return l
+	}
+	if len(l) == 0 {
+		return r
+	}
+	length := prefixLength(l)
+	if r_length := prefixLength(r); r_length < length {
+		length = r_length
+	}
+	set := make(map[string]struct{}, len(l)+len(r))
+	for _, prefix := range append(append([]string{}, l...), r...) {
+		if runes := []rune(prefix); len(runes) > length {
+			prefix = string(runes[:length])
+		}
+		set[prefix] = struct{}{}
+	}
+	merged := make([]string, 0, len(set))
+	for prefix := range set {
+		merged = append(merged, prefix)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// Returns the prefix length a prefix list was collected with, the length of its longest prefix.
+// Shorter prefixes are values shorter than the prefix length.
+func prefixLength(prefixes []string) int {
+	length := 0
+	for _, prefix := range prefixes {
+		if prefix_length := utf8.RuneCountInString(prefix); prefix_length > length {
+			length = prefix_length
+		}
+	}
+	return length
+}
+
 // FloatType represents a possible Float type of a DataPath.
 // The type may be augmented with statistics about the distribution of the data
 type FloatType struct {
@@ -156,6 +301,10 @@ type FloatType struct {
 	Min    *float64
 	Max    *float64
 	Unique *uint64
+	// A sketch of the distinct values, used to merge Unique
+	Sketch *HyperLogLog
+	// The distribution of all numbers at the path
+	Histogram *Histogram
 }
 
 func (l *FloatType) merge(r FloatType) *FloatType {
@@ -165,11 +314,7 @@ func (l *FloatType) merge(r FloatType) *FloatType {
 		*l.Count += *r.Count
 	}
 
-	if l.Unique == nil {
-		l.Unique = r.Unique
-	} else if r.Unique != nil {
-		*l.Unique += *r.Unique
-	}
+	l.Unique, l.Sketch = mergeUnique(l.Unique, l.Sketch, r.Unique, r.Sketch)
 
 	if l.Min == nil {
 		l.Min = r.Min
@@ -183,6 +328,8 @@ func (l *FloatType) merge(r FloatType) *FloatType {
 		*l.Max = math.Max(*l.Max, *r.Max)
 	}
 
+	l.Histogram = mergeHistograms(l.Histogram, r.Histogram)
+
 	return l
 }
 
@@ -194,6 +341,34 @@ type IntType struct {
 	Min    *int64
 	Max    *int64
 	Unique *uint64
+	// A sketch of the distinct values, used to merge Unique
+	Sketch *HyperLogLog
+	// The most common values, ordered by descending frequency
+	MostCommon []IntFrequency
+	// The distribution of the integers at the path
+	Histogram *Histogram
+}
+
+// ValueFraction estimates the fraction of integer values at the path that are equal to the given value.
+// Values that are not among the most common values are estimated with the histogram, if it exists.
+// If neither most common values nor a histogram are known, false is returned.
+func (l *IntType) ValueFraction(value int64) (float64, bool) {
+	counts := make([]uint64, len(l.MostCommon))
+	for i, freq := range l.MostCommon {
+		if freq.Value == value {
+			return valueFraction(l.Count, l.Unique, []uint64{freq.Count}, true)
+		}
+		counts[i] = freq.Count
+	}
+	fraction, ok := valueFraction(l.Count, l.Unique, counts, false)
+	if l.Histogram == nil {
+		return fraction, ok
+	}
+	histogram_fraction := l.Histogram.FractionEqual(float64(value))
+	if ok {
+		return math.Min(fraction, histogram_fraction), true
+	}
+	return histogram_fraction, true
 }
 
 func (l *IntType) merge(r IntType) *IntType {
@@ -203,11 +378,7 @@ func (l *IntType) merge(r IntType) *IntType {
 		*l.Count += *r.Count
 	}
 
-	if l.Unique == nil {
-		l.Unique = r.Unique
-	} else if r.Unique != nil {
-		*l.Unique += *r.Unique
-	}
+	l.Unique, l.Sketch = mergeUnique(l.Unique, l.Sketch, r.Unique, r.Sketch)
 
 	if l.Min == nil {
 		l.Min = r.Min
@@ -221,6 +392,9 @@ func (l *IntType) merge(r IntType) *IntType {
 		*l.Max = i64.Max(*l.Max, *r.Max)
 	}
 
+	l.MostCommon = mergeIntFrequencies(l.MostCommon, r.MostCommon)
+	l.Histogram = mergeHistograms(l.Histogram, r.Histogram)
+
 	return l
 }
 
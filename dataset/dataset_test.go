@@ -0,0 +1,58 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergePrefixes(t *testing.T) {
+	tests := []struct {
+		name string
+		l    []string
+		r    []string
+		want []string
+	}{
+		{"empty right", []string{"a"}, nil, []string{"a"}},
+		{"empty left", nil, []string{"a"}, []string{"a"}},
+		{"same length", []string{"ab", "c"}, []string{"ab", "ba"}, []string{"ab", "ba", "c"}},
+		{"shorter right", []string{"abc", "abd", "b"}, []string{"a", "c"}, []string{"a", "b", "c"}},
+		{"shorter left", []string{"ab", "b"}, []string{"abc", "bcd", "cde"}, []string{"ab", "b", "bc", "cd"}},
+		{"unicode", []string{"äb"}, []string{"äc", "ö"}, []string{"äb", "äc", "ö"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mergePrefixes(test.l, test.r); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("mergePrefixes(%v, %v) = %v, want %v", test.l, test.r, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeCopiesRight(t *testing.T) {
+	count := uint64(2)
+	min := 1.0
+	r := DataSet{Name: "r", Count: &count, Paths: map[string]*DataPath{
+		"/a": {Path: "/a", Count: &count, Floattype: &FloatType{Count: &count, Min: &min, Max: &min}},
+	}}
+	l := &DataSet{Name: "l", Count: &count, Paths: map[string]*DataPath{
+		"/b": {Path: "/b"},
+	}}
+	l.Merge(r)
+	l.Merge(r)
+	if *l.Count != 6 || *l.Paths["/a"].Count != 4 || *l.Paths["/a"].Floattype.Count != 4 {
+		t.Errorf("merged counts = %d, %d, %d, want 6, 4, 4", *l.Count, *l.Paths["/a"].Count, *l.Paths["/a"].Floattype.Count)
+	}
+	if count != 2 || *r.Paths["/a"].Floattype.Count != 2 || min != 1 {
+		t.Errorf("merging changed the right dataset")
+	}
+
+	path := &DataPath{Path: "/a"}
+	path.Merge(*r.Paths["/a"])
+	*path.Floattype.Min = 0
+	if min != 1 {
+		t.Errorf("merged path shares its statistics with the right path")
+	}
+	if path.Merge(DataPath{Path: "/b"}) != nil {
+		t.Errorf("merging different paths succeeded")
+	}
+}
@@ -0,0 +1,82 @@
+package dataset
+
+import "strings"
+
+// The path segment representing all elements of an array
+const ElementWildcard = "*"
+
+// ElementPath returns the path describing the elements of the array at the given path
+func ElementPath(path string) string {
+	return path + "/" + ElementWildcard
+}
+
+// IsElementPath checks whether the path describes array elements or values nested within array elements
+func IsElementPath(path string) bool {
+	return strings.Contains(path+"/", "/"+ElementWildcard+"/")
+}
+
+// ElementDataSet returns the statistics of the elements of the array at the given path as a DataSet.
+// Each array element is treated as a single document, the paths keep their full element path (e.g. "/tags/*/name").
+// If no element statistics exist, false is returned.
+func (d *DataSet) ElementDataSet(path string) (DataSet, bool) {
+	element_path := ElementPath(path)
+	elements, ok := d.Paths[element_path]
+	if !ok || elements == nil || elements.Count == nil || *elements.Count == 0 {
+		return DataSet{}, false
+	}
+	paths := make(map[string]*DataPath)
+	for p, data_path := range d.Paths {
+		if p == element_path || strings.HasPrefix(p, element_path+"/") {
+			paths[p] = data_path
+		}
+	}
+	count := *elements.Count
+	return DataSet{
+		Name:          d.Name,
+		Count:         &count,
+		ExpectedCount: count,
+		Paths:         paths,
+		DerivedFrom:   nil,
+	}, true
+}
+
+// UnwoundDataSet returns the statistics of the DataSet, in which each document is replaced by one document per element of the array at the given path.
+// The array is replaced by the element in each document, so the element paths are moved to the array path (e.g. "/tags/*/name" to "/tags/name").
+// Documents without array at the path are removed. Paths outside of the array keep the statistics of the original documents.
+// The size is the number of elements or, without element statistics, estimated by the average array size.
+// If no array statistics exist, false is returned.
+func (d *DataSet) UnwoundDataSet(path string) (DataSet, bool) {
+	array, ok := d.Paths[path]
+	if !ok || array == nil || array.Arraytype == nil || array.Arraytype.Count == nil || *array.Arraytype.Count == 0 {
+		return DataSet{}, false
+	}
+
+	var count uint64
+	element_path := ElementPath(path)
+	if elements, ok := d.ElementDataSet(path); ok {
+		count = elements.GetSize()
+	} else if array.Arraytype.MinSize != nil && array.Arraytype.MaxSize != nil {
+		count = uint64(float64(*array.Arraytype.Count) * float64(*array.Arraytype.MinSize+*array.Arraytype.MaxSize) / 2)
+	}
+
+	paths := make(map[string]*DataPath)
+	for p, data_path := range d.Paths {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			if p != element_path && !strings.HasPrefix(p, element_path+"/") {
+				continue
+			}
+			unwound_path := *data_path
+			unwound_path.Path = path + strings.TrimPrefix(p, element_path)
+			paths[unwound_path.Path] = &unwound_path
+		} else {
+			paths[p] = data_path
+		}
+	}
+	return DataSet{
+		Name:          d.Name,
+		Count:         nil,
+		ExpectedCount: count,
+		Paths:         paths,
+		DerivedFrom:   d.DerivedFrom,
+	}, true
+}
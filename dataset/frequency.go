@@ -0,0 +1,107 @@
+package dataset
+
+import (
+	"math"
+	"sort"
+)
+
+// The maximum number of most common values stored per type and path
+const MaxMostCommon = 10
+
+// StringFrequency is a string value and the number of its occurrences at a path
+type StringFrequency struct {
+	Value string
+	Count uint64
+}
+
+// IntFrequency is an integer value and the number of its occurrences at a path
+type IntFrequency struct {
+	Value int64
+	Count uint64
+}
+
+// Estimates the fraction of values equal to a single value.
+// If the value is one of the most common values, counts contains only its count and found is true.
+// Otherwise counts contains the counts of all most common values and the fraction of the remaining values is estimated.
+// A value that is not among the most common values can not be more frequent than the least common of them.
+// If the number of distinct values is known, the remaining values are assumed to be distributed uniformly among the remaining distinct values.
+func valueFraction(total *uint64, unique *uint64, counts []uint64, found bool) (float64, bool) {
+	if total == nil || *total == 0 || len(counts) == 0 {
+		return 0.0, false
+	}
+	if found {
+		return math.Min(float64(counts[0])/float64(*total), 1.0), true
+	}
+
+	var sum uint64
+	least := counts[0]
+	for _, count := range counts {
+		sum += count
+		if count < least {
+			least = count
+		}
+	}
+	if sum >= *total { // The most common values contain all values
+		return 0.0, true
+	}
+	remaining := float64(*total - sum)
+	if unique != nil && *unique > uint64(len(counts)) {
+		remaining /= float64(*unique - uint64(len(counts)))
+	}
+	return math.Min(remaining, float64(least)) / float64(*total), true
+}
+
+// Merges two frequency lists and keeps the limit most common values
+func mergeStringFrequencies(l []StringFrequency, r []StringFrequency, limit int) []StringFrequency {
+	if len(r) == 0 {
+		return l
+	}
+	counts := make(map[string]uint64)
+	for _, freq := range l {
+		counts[freq.Value] += freq.Count
+	}
+	for _, freq := range r {
+		counts[freq.Value] += freq.Count
+	}
+	merged := make([]StringFrequency, 0, len(counts))
+	for value, count := range counts {
+		merged = append(merged, StringFrequency{Value: value, Count: count})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Count != merged[j].Count {
+			return merged[i].Count > merged[j].Count
+		}
+		return merged[i].Value < merged[j].Value
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
+
+func mergeIntFrequencies(l []IntFrequency, r []IntFrequency) []IntFrequency {
+	if len(r) == 0 {
+		return l
+	}
+	counts := make(map[int64]uint64)
+	for _, freq := range l {
+		counts[freq.Value] += freq.Count
+	}
+	for _, freq := range r {
+		counts[freq.Value] += freq.Count
+	}
+	merged := make([]IntFrequency, 0, len(counts))
+	for value, count := range counts {
+		merged = append(merged, IntFrequency{Value: value, Count: count})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Count != merged[j].Count {
+			return merged[i].Count > merged[j].Count
+		}
+		return merged[i].Value < merged[j].Value
+	})
+	if len(merged) > MaxMostCommon {
+		merged = merged[:MaxMostCommon]
+	}
+	return merged
+}
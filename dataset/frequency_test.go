@@ -0,0 +1,81 @@
+package dataset
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func uint64Pointer(value uint64) *uint64 {
+	return &value
+}
+
+func TestValueFraction(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  *uint64
+		unique *uint64
+		counts []uint64
+		found  bool
+		want   float64
+		ok     bool
+	}{
+		{"unknown total", nil, nil, []uint64{1}, true, 0.0, false},
+		{"empty total", uint64Pointer(0), nil, []uint64{1}, true, 0.0, false},
+		{"no most common values", uint64Pointer(10), nil, nil, false, 0.0, false},
+		{"most common value", uint64Pointer(10), nil, []uint64{4}, true, 0.4, true},
+		{"all values common", uint64Pointer(10), nil, []uint64{6, 4}, false, 0.0, true},
+		{"unknown unique", uint64Pointer(100), nil, []uint64{50, 20}, false, 0.2, true},
+		{"uniform remaining", uint64Pointer(100), uint64Pointer(12), []uint64{50, 20}, false, 0.03, true},
+		{"remaining at most least common", uint64Pointer(100), uint64Pointer(3), []uint64{50, 20}, false, 0.2, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := valueFraction(test.total, test.unique, test.counts, test.found)
+			if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("valueFraction() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestMergeStringFrequencies(t *testing.T) {
+	l := []StringFrequency{{"a", 5}, {"b", 3}, {"c", 1}}
+	r := []StringFrequency{{"c", 4}, {"d", 3}}
+	tests := []struct {
+		name  string
+		r     []StringFrequency
+		limit int
+		want  []StringFrequency
+	}{
+		{"empty right", nil, 10, l},
+		{"summed counts", r, 10, []StringFrequency{{"a", 5}, {"c", 5}, {"b", 3}, {"d", 3}}},
+		{"limited", r, 3, []StringFrequency{{"a", 5}, {"c", 5}, {"b", 3}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mergeStringFrequencies(l, test.r, test.limit); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("mergeStringFrequencies() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeIntFrequencies(t *testing.T) {
+	var l, r []IntFrequency
+	for i := int64(0); i < MaxMostCommon; i++ {
+		l = append(l, IntFrequency{i, 2})
+		r = append(r, IntFrequency{i + MaxMostCommon/2, 1})
+	}
+	got := mergeIntFrequencies(l, r)
+	if len(got) != MaxMostCommon {
+		t.Fatalf("mergeIntFrequencies() kept %d values, want %d", len(got), MaxMostCommon)
+	}
+	// The overlapping values have the highest counts and come first
+	if got[0] != (IntFrequency{MaxMostCommon / 2, 3}) {
+		t.Errorf("mergeIntFrequencies()[0] = %v, want {%d 3}", got[0], MaxMostCommon/2)
+	}
+	if got := mergeIntFrequencies(l, nil); !reflect.DeepEqual(got, l) {
+		t.Errorf("mergeIntFrequencies(l, nil) = %v, want %v", got, l)
+	}
+}
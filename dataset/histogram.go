@@ -0,0 +1,250 @@
+package dataset
+
+import (
+	"math"
+	"sort"
+)
+
+// The desired number of buckets of a histogram
+const HistogramBuckets = 20
+
+// The number of points used to approximate the values of a bucket when merging histograms
+const mergePointsPerBucket = 16
+
+// Histogram is an equi-depth histogram over the numeric values of a path.
+// Bucket i contains the values in (Bounds[i], Bounds[i+1]], the first bucket also contains Bounds[0].
+// A bucket with equal bounds contains only this single, frequent value.
+// Within a bucket the values are assumed to be distributed uniformly.
+type Histogram struct {
+	// The bucket bounds in ascending order, one more than there are buckets
+	Bounds []float64
+	// The number of values within each bucket
+	Counts []uint64
+}
+
+type weightedValue struct {
+	value  float64
+	weight float64
+}
+
+// NewHistogram creates an equi-depth histogram with about the given number of buckets from the values.
+// nil is returned if no values are given.
+func NewHistogram(values []float64, buckets int) *Histogram {
+	points := make([]weightedValue, len(values))
+	for i, value := range values {
+		points[i] = weightedValue{value: value, weight: 1.0}
+	}
+	return buildHistogram(points, buckets)
+}
+
+// NewWeightedHistogram creates an equi-depth histogram with about the given number of buckets from values, which occur as often as their weight.
+// nil is returned if no values are given.
+func NewWeightedHistogram(values []float64, weights []float64, buckets int) *Histogram {
+	points := make([]weightedValue, len(values))
+	for i, value := range values {
+		points[i] = weightedValue{value: value, weight: weights[i]}
+	}
+	return buildHistogram(points, buckets)
+}
+
+// Builds an equi-depth histogram from weighted values.
+// Runs of equal values are never split between buckets, values filling a bucket on their own get a single value bucket.
+func buildHistogram(points []weightedValue, buckets int) *Histogram {
+	if len(points) == 0 || buckets <= 0 {
+		return nil
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].value < points[j].value })
+
+	total := 0.0
+	for _, point := range points {
+		total += point.weight
+	}
+	depth := total / float64(buckets)
+
+	bounds := []float64{points[0].value}
+	var weights []float64
+	pending := 0.0
+	last := points[0].value
+	for i := 0; i < len(points); {
+		// Collect the run of equal values
+		value := points[i].value
+		run := 0.0
+		for ; i < len(points) && points[i].value == value; i++ {
+			run += points[i].weight
+		}
+
+		if run < depth {
+			pending += run
+			last = value
+			if pending >= depth {
+				bounds = append(bounds, value)
+				weights = append(weights, pending)
+				pending = 0
+			}
+			continue
+		}
+
+		// Close the pending bucket and create a single value bucket
+		if pending > 0 {
+			bounds = append(bounds, last)
+			weights = append(weights, pending)
+			pending = 0
+		}
+		if bounds[len(bounds)-1] != value {
+			bounds = append(bounds, value)
+			weights = append(weights, 0)
+		}
+		bounds = append(bounds, value)
+		weights = append(weights, run)
+	}
+	if pending > 0 {
+		bounds = append(bounds, last)
+		weights = append(weights, pending)
+	}
+	return &Histogram{Bounds: bounds, Counts: roundWeights(weights)}
+}
+
+// Rounds the weights to integers while keeping their total sum
+func roundWeights(weights []float64) []uint64 {
+	counts := make([]uint64, len(weights))
+	sum := 0.0
+	var prev uint64
+	for i, weight := range weights {
+		sum += weight
+		current := uint64(math.Round(sum))
+		if current > prev {
+			counts[i] = current - prev
+			prev = current
+		}
+	}
+	return counts
+}
+
+// Total returns the number of values in the histogram
+func (h *Histogram) Total() uint64 {
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+	return total
+}
+
+// FractionBelow estimates the fraction of values smaller than (or equal to, if inclusive) the given value
+func (h *Histogram) FractionBelow(value float64, inclusive bool) float64 {
+	total := h.Total()
+	if total == 0 {
+		return 0.0
+	}
+	below := 0.0
+	for i, count := range h.Counts {
+		lo, hi := h.Bounds[i], h.Bounds[i+1]
+		switch {
+		case value > hi || (inclusive && value == hi):
+			below += float64(count)
+		case value <= lo:
+		default:
+			below += float64(count) * (value - lo) / (hi - lo)
+		}
+	}
+	return below / float64(total)
+}
+
+// FractionEqual estimates the fraction of values equal to the given value.
+// The values are assumed to be integers.
+func (h *Histogram) FractionEqual(value float64) float64 {
+	total := h.Total()
+	if total == 0 {
+		return 0.0
+	}
+	// Frequent values have their own bucket
+	for i, count := range h.Counts {
+		if h.Bounds[i] == h.Bounds[i+1] && h.Bounds[i] == value {
+			return float64(count) / float64(total)
+		}
+	}
+	for i, count := range h.Counts {
+		lo, hi := h.Bounds[i], h.Bounds[i+1]
+		if lo == hi || value > hi || value < lo || (value == lo && i > 0) {
+			continue
+		}
+		width := math.Floor(hi) - math.Floor(lo)
+		if i == 0 {
+			width++
+		}
+		return float64(count) / math.Max(width, 1.0) / float64(total)
+	}
+	return 0.0
+}
+
+// Quantile returns the estimated value below which the given fraction (0-1) of values lie
+func (h *Histogram) Quantile(fraction float64) float64 {
+	target := fraction * float64(h.Total())
+	acc := 0.0
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		if acc+float64(count) >= target {
+			lo, hi := h.Bounds[i], h.Bounds[i+1]
+			return lo + (hi-lo)*math.Max(target-acc, 0.0)/float64(count)
+		}
+		acc += float64(count)
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// Scale returns a copy of the histogram with the same distribution, but the given total number of values
+func (h *Histogram) Scale(total uint64) *Histogram {
+	sum := h.Total()
+	weights := make([]float64, len(h.Counts))
+	for i, count := range h.Counts {
+		if sum > 0 {
+			weights[i] = float64(count) * float64(total) / float64(sum)
+		}
+	}
+	bounds := make([]float64, len(h.Bounds))
+	copy(bounds, h.Bounds)
+	return &Histogram{Bounds: bounds, Counts: roundWeights(weights)}
+}
+
+// Approximates the values of the histogram with weighted points
+func (h *Histogram) points() []weightedValue {
+	var points []weightedValue
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		lo, hi := h.Bounds[i], h.Bounds[i+1]
+		if lo == hi {
+			points = append(points, weightedValue{value: lo, weight: float64(count)})
+			continue
+		}
+		weight := float64(count) / mergePointsPerBucket
+		for j := 0; j < mergePointsPerBucket; j++ {
+			// The first bucket contains its lower bound, all others their upper bound
+			step := float64(j+1) / mergePointsPerBucket
+			if i == 0 {
+				step = float64(j) / (mergePointsPerBucket - 1)
+			}
+			points = append(points, weightedValue{value: lo + (hi-lo)*step, weight: weight})
+		}
+	}
+	return points
+}
+
+// Rebucket creates an equi-depth histogram with about the given number of buckets from the values of the histogram.
+// Fine-grained histograms of any kind, e.g. equi-width ones, can be turned into equi-depth histograms this way.
+func (h *Histogram) Rebucket(buckets int) *Histogram {
+	return buildHistogram(h.points(), buckets)
+}
+
+// Merges two histograms into a new histogram, nil histograms are ignored
+func mergeHistograms(l *Histogram, r *Histogram) *Histogram {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	return buildHistogram(append(l.points(), r.points()...), HistogramBuckets)
+}
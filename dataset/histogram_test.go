@@ -0,0 +1,155 @@
+package dataset
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Returns the values 1 to n
+func sequence(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	return values
+}
+
+func TestNewHistogram(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []float64
+		buckets int
+		want    *Histogram
+	}{
+		{"empty", nil, 4, nil},
+		{"no buckets", []float64{1}, 0, nil},
+		{"equal depth", sequence(8), 4, &Histogram{Bounds: []float64{1, 2, 4, 6, 8}, Counts: []uint64{2, 2, 2, 2}}},
+		{"unsorted", []float64{8, 3, 1, 6, 2, 5, 7, 4}, 2, &Histogram{Bounds: []float64{1, 4, 8}, Counts: []uint64{4, 4}}},
+		{"frequent value", []float64{1, 2, 5, 5, 5, 5, 5, 9}, 4, &Histogram{Bounds: []float64{1, 2, 5, 5, 9}, Counts: []uint64{2, 0, 5, 1}}},
+		{"single value", []float64{3, 3, 3}, 2, &Histogram{Bounds: []float64{3, 3}, Counts: []uint64{3}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NewHistogram(test.values, test.buckets)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("NewHistogram(%v, %d) = %v, want %v", test.values, test.buckets, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewWeightedHistogram(t *testing.T) {
+	got := NewWeightedHistogram([]float64{4, 1, 2, 3}, []float64{2, 2, 2, 2}, 4)
+	want := NewHistogram([]float64{1, 1, 2, 2, 3, 3, 4, 4}, 4)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewWeightedHistogram() = %v, want %v", got, want)
+	}
+}
+
+func TestHistogramFractionBelow(t *testing.T) {
+	h := NewHistogram(sequence(100), 10)
+	tests := []struct {
+		value     float64
+		inclusive bool
+		want      float64
+	}{
+		{0, true, 0.0},
+		{1, false, 0.0},
+		{50, true, 0.5},
+		{50.5, false, 0.505},
+		{100, false, 0.99},
+		{100, true, 1.0},
+		{200, false, 1.0},
+	}
+	for _, test := range tests {
+		got := h.FractionBelow(test.value, test.inclusive)
+		if math.Abs(got-test.want) > 0.02 {
+			t.Errorf("FractionBelow(%v, %v) = %v, want %v", test.value, test.inclusive, got, test.want)
+		}
+	}
+}
+
+func TestHistogramFractionEqual(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 3, 4, 5, 5, 5, 5, 5, 5, 6, 7, 8}, 4)
+	tests := []struct {
+		value float64
+		want  float64
+	}{
+		{5, 6.0 / 13.0},
+		{2, 1.0 / 13.0},
+		{0, 0.0},
+		{9, 0.0},
+	}
+	for _, test := range tests {
+		got := h.FractionEqual(test.value)
+		if math.Abs(got-test.want) > 0.02 {
+			t.Errorf("FractionEqual(%v) = %v, want %v", test.value, got, test.want)
+		}
+	}
+	if got := (&Histogram{}).FractionEqual(1); got != 0 {
+		t.Errorf("FractionEqual on empty histogram = %v, want 0", got)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram(sequence(100), 10)
+	for _, fraction := range []float64{0.1, 0.25, 0.5, 0.9} {
+		want := fraction * 100
+		if got := h.Quantile(fraction); math.Abs(got-want) > 2 {
+			t.Errorf("Quantile(%v) = %v, want %v", fraction, got, want)
+		}
+	}
+	if got := h.Quantile(1.5); got != 100 {
+		t.Errorf("Quantile(1.5) = %v, want the maximum 100", got)
+	}
+}
+
+func TestHistogramScale(t *testing.T) {
+	h := NewHistogram(sequence(10), 3)
+	scaled := h.Scale(100)
+	if scaled.Total() != 100 {
+		t.Errorf("Scale(100).Total() = %d, want 100", scaled.Total())
+	}
+	if !reflect.DeepEqual(scaled.Bounds, h.Bounds) {
+		t.Errorf("Scale changed the bounds from %v to %v", h.Bounds, scaled.Bounds)
+	}
+	scaled.Bounds[0] = -1
+	if h.Bounds[0] == -1 {
+		t.Errorf("Scale shares the bounds with the original histogram")
+	}
+}
+
+func TestHistogramRebucket(t *testing.T) {
+	// Equi-width buckets of skewed values
+	fine := &Histogram{Bounds: []float64{0, 10, 20, 30, 40}, Counts: []uint64{70, 10, 10, 10}}
+	h := fine.Rebucket(4)
+	if h.Total() != 100 {
+		t.Errorf("Rebucket(4).Total() = %d, want 100", h.Total())
+	}
+	if h.Bounds[0] != 0 || h.Bounds[len(h.Bounds)-1] != 40 {
+		t.Errorf("Rebucket(4) bounds %v do not span [0, 40]", h.Bounds)
+	}
+	// Most buckets cover the dense first equi-width bucket
+	if median := h.Quantile(0.5); median > 10 {
+		t.Errorf("Rebucket(4).Quantile(0.5) = %v, want at most 10", median)
+	}
+}
+
+func TestMergeHistograms(t *testing.T) {
+	l := NewHistogram(sequence(50), 5)
+	r := NewHistogram(sequence(100)[50:], 5)
+	if got := mergeHistograms(nil, r); got != r {
+		t.Errorf("mergeHistograms(nil, r) = %v, want r", got)
+	}
+	if got := mergeHistograms(l, nil); got != l {
+		t.Errorf("mergeHistograms(l, nil) = %v, want l", got)
+	}
+	merged := mergeHistograms(l, r)
+	if merged.Total() != 100 {
+		t.Errorf("merged total = %d, want 100", merged.Total())
+	}
+	if got := merged.FractionBelow(50, true); math.Abs(got-0.5) > 0.05 {
+		t.Errorf("merged FractionBelow(50) = %v, want 0.5", got)
+	}
+}
@@ -0,0 +1,164 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// The number of index bits of a HyperLogLog sketch, resulting in 2^12 registers and a standard error of about 1.6%
+const hyperLogLogPrecision = 12
+
+// HyperLogLog is a mergeable sketch estimating the number of distinct values
+type HyperLogLog struct {
+	// The maximum observed rank per register
+	Registers []byte
+}
+
+// NewHyperLogLog creates an empty sketch
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{Registers: make([]byte, 1<<hyperLogLogPrecision)}
+}
+
+// AddString adds a string value to the sketch
+func (h *HyperLogLog) AddString(value string) {
+	h.add("s" + value)
+}
+
+// AddInt adds an integer value to the sketch
+func (h *HyperLogLog) AddInt(value int64) {
+	h.add("i" + strconv.FormatInt(value, 10))
+}
+
+// AddFloat adds a float value to the sketch
+func (h *HyperLogLog) AddFloat(value float64) {
+	h.add("f" + strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (h *HyperLogLog) add(value string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(value))
+	hash := mix(hasher.Sum64())
+
+	index := hash >> (64 - hyperLogLogPrecision)
+	rank := byte(bits.LeadingZeros64(hash<<hyperLogLogPrecision|1<<(hyperLogLogPrecision-1)) + 1)
+	if rank > h.Registers[index] {
+		h.Registers[index] = rank
+	}
+}
+
+// Finalizer of splitmix64, distributes the bits of the FNV hash over the whole range
+func mix(hash uint64) uint64 {
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
+
+// Estimate returns the estimated number of distinct values added to the sketch
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.Registers))
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.Registers {
+		sum += math.Pow(2, -float64(register))
+		if register == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Use linear counting for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// Merge returns a new sketch containing the values of both sketches.
+// nil is returned if the sketches have a different precision.
+func (h *HyperLogLog) Merge(r *HyperLogLog) *HyperLogLog {
+	if len(h.Registers) != len(r.Registers) {
+		return nil
+	}
+	merged := &HyperLogLog{Registers: make([]byte, len(h.Registers))}
+	for i := range h.Registers {
+		merged.Registers[i] = h.Registers[i]
+		if r.Registers[i] > merged.Registers[i] {
+			merged.Registers[i] = r.Registers[i]
+		}
+	}
+	return merged
+}
+
+// The JSON representation of a sketch.
+// Sketches with few non-zero registers are stored sparsely as list of (index, rank) pairs of three bytes each, with the number of registers in Size.
+// Other sketches store all registers.
+type hyperLogLogJSON struct {
+	Registers []byte `json:",omitempty"`
+	Size      int    `json:",omitempty"`
+	Sparse    []byte `json:",omitempty"`
+}
+
+// MarshalJSON stores the sketch sparsely if that is smaller than storing all registers
+func (h HyperLogLog) MarshalJSON() ([]byte, error) {
+	var sparse []byte
+	for i, register := range h.Registers {
+		if register != 0 {
+			sparse = append(sparse, byte(i>>8), byte(i), register)
+		}
+	}
+	if len(sparse) >= len(h.Registers) {
+		return json.Marshal(hyperLogLogJSON{Registers: h.Registers})
+	}
+	return json.Marshal(hyperLogLogJSON{Size: len(h.Registers), Sparse: sparse})
+}
+
+// UnmarshalJSON reads sparse sketches as well as sketches storing all registers
+func (h *HyperLogLog) UnmarshalJSON(data []byte) error {
+	var stored hyperLogLogJSON
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	if stored.Size == 0 {
+		h.Registers = stored.Registers
+		return nil
+	}
+	if len(stored.Sparse)%3 != 0 {
+		return fmt.Errorf("sparse sketch has invalid length %d", len(stored.Sparse))
+	}
+	h.Registers = make([]byte, stored.Size)
+	for i := 0; i < len(stored.Sparse); i += 3 {
+		index := int(stored.Sparse[i])<<8 | int(stored.Sparse[i+1])
+		if index >= stored.Size {
+			return fmt.Errorf("sparse sketch register %d out of range", index)
+		}
+		h.Registers[index] = stored.Sparse[i+2]
+	}
+	return nil
+}
+
+// Merges the unique counts of two types.
+// If both types have a sketch, the unique count is estimated from the merged sketch.
+// Otherwise the unique counts are added up, which overestimates the count if the values overlap.
+func mergeUnique(l_unique *uint64, l_sketch *HyperLogLog, r_unique *uint64, r_sketch *HyperLogLog) (*uint64, *HyperLogLog) {
+	if l_sketch != nil && r_sketch != nil {
+		if sketch := l_sketch.Merge(r_sketch); sketch != nil {
+			unique := sketch.Estimate()
+			return &unique, sketch
+		}
+	}
+	if l_unique == nil {
+		return r_unique, r_sketch
+	}
+	if r_unique == nil {
+		return l_unique, l_sketch
+	}
+	unique := *l_unique + *r_unique
+	return &unique, nil
+}
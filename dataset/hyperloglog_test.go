@@ -0,0 +1,117 @@
+package dataset
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Returns a sketch of the strings from to to-1
+func sketchOf(from int, to int) *HyperLogLog {
+	h := NewHyperLogLog()
+	for i := from; i < to; i++ {
+		h.AddString(strconv.Itoa(i))
+	}
+	return h
+}
+
+// The raw estimate is biased by a few percent for cardinalities just above the range of linear counting
+const hyperLogLogTolerance = 0.06
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 1000, 10000, 100000} {
+		got := float64(sketchOf(0, n).Estimate())
+		if math.Abs(got-float64(n)) > hyperLogLogTolerance*float64(n) {
+			t.Errorf("Estimate() of %d distinct values = %v", n, got)
+		}
+	}
+}
+
+func TestHyperLogLogDuplicates(t *testing.T) {
+	h := sketchOf(0, 100)
+	for i := 0; i < 10; i++ {
+		h.AddString("1")
+	}
+	if got := h.Estimate(); got != sketchOf(0, 100).Estimate() {
+		t.Errorf("Estimate() changed by duplicates to %d", got)
+	}
+}
+
+func TestHyperLogLogTypes(t *testing.T) {
+	h := NewHyperLogLog()
+	h.AddString("1")
+	h.AddInt(1)
+	h.AddFloat(1.5)
+	if got := h.Estimate(); got != 3 {
+		t.Errorf("Estimate() of values of different types = %d, want 3", got)
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	merged := sketchOf(0, 6000).Merge(sketchOf(4000, 10000))
+	if got := float64(merged.Estimate()); math.Abs(got-10000) > hyperLogLogTolerance*10000 {
+		t.Errorf("Estimate() of merged sketches = %v, want 10000", got)
+	}
+	if !reflect.DeepEqual(merged, sketchOf(0, 10000)) {
+		t.Errorf("merged sketch differs from the sketch of all values")
+	}
+	if got := merged.Merge(&HyperLogLog{Registers: make([]byte, 16)}); got != nil {
+		t.Errorf("Merge() of sketches with different precision = %v, want nil", got)
+	}
+}
+
+func TestHyperLogLogJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		sketch *HyperLogLog
+		sparse bool
+	}{
+		{"empty", NewHyperLogLog(), true},
+		{"few values", sketchOf(0, 100), true},
+		{"many values", sketchOf(0, 100000), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.sketch)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var stored hyperLogLogJSON
+			if err := json.Unmarshal(data, &stored); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if sparse := stored.Size != 0; sparse != test.sparse {
+				t.Errorf("sketch stored sparsely = %v, want %v", sparse, test.sparse)
+			}
+			got := &HyperLogLog{}
+			if err := json.Unmarshal(data, got); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.sketch) {
+				t.Errorf("sketch changed by storing it as JSON")
+			}
+		})
+	}
+}
+
+func TestHyperLogLogUnmarshalRegisters(t *testing.T) {
+	want := sketchOf(0, 100)
+	data, err := json.Marshal(struct{ Registers []byte }{want.Registers})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	got := &HyperLogLog{}
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sketch storing all registers was not read")
+	}
+	for _, invalid := range []string{`{"Size":16,"Sparse":"AAE="}`, `{"Size":16,"Sparse":"AEAB"}`} {
+		if err := json.Unmarshal([]byte(invalid), &HyperLogLog{}); err == nil {
+			t.Errorf("json.Unmarshal(%s) succeeded, want an error", invalid)
+		}
+	}
+}
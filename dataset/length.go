@@ -0,0 +1,69 @@
+package dataset
+
+import "math"
+
+// LengthFractionBelow estimates the fraction of string values at the path with less than the given number of characters.
+// Lengths are integers, so a length n is assumed to cover (n-0.5, n+0.5].
+// The lengths are modeled as a piecewise uniform distribution with half of the values below and half above the average length.
+// If the minimum and maximum length are not known, false is returned.
+func (l *StringType) LengthFractionBelow(length float64) (float64, bool) {
+	lo, mid, hi, ok := l.lengthBounds()
+	if !ok {
+		return 0.0, false
+	}
+	switch {
+	case length <= lo:
+		return 0.0, true
+	case length >= hi:
+		return 1.0, true
+	case length <= mid:
+		return 0.5 * (length - lo) / (mid - lo), true
+	default:
+		return 0.5 + 0.5*(length-mid)/(hi-mid), true
+	}
+}
+
+// LengthQuantile returns the estimated length below which the given fraction (0-1) of string values lie.
+// It is the inverse of LengthFractionBelow.
+// If the minimum and maximum length are not known, false is returned.
+func (l *StringType) LengthQuantile(fraction float64) (float64, bool) {
+	lo, mid, hi, ok := l.lengthBounds()
+	if !ok {
+		return 0.0, false
+	}
+	fraction = math.Max(math.Min(fraction, 1.0), 0.0)
+	if fraction <= 0.5 {
+		return lo + (mid-lo)*fraction/0.5, true
+	}
+	return mid + (hi-mid)*(fraction-0.5)/0.5, true
+}
+
+// Returns the bounds of the modeled length distribution
+func (l *StringType) lengthBounds() (lo float64, mid float64, hi float64, ok bool) {
+	if l.MinLength == nil || l.MaxLength == nil {
+		return 0.0, 0.0, 0.0, false
+	}
+	lo = float64(*l.MinLength) - 0.5
+	hi = float64(*l.MaxLength) + 0.5
+	mid = (lo + hi) / 2
+	if l.AvgLength != nil {
+		mid = math.Max(math.Min(*l.AvgLength, hi), lo)
+	}
+	return lo, mid, hi, true
+}
+
+// Merges two averages, weighted by the number of values they were computed from.
+// If a count is unknown, both averages are weighted equally.
+func mergeAverage(l_avg *float64, l_count *uint64, r_avg *float64, r_count *uint64) *float64 {
+	if l_avg == nil {
+		return r_avg
+	}
+	if r_avg == nil {
+		return l_avg
+	}
+	avg := (*l_avg + *r_avg) / 2
+	if l_count != nil && r_count != nil && *l_count+*r_count > 0 {
+		avg = (*l_avg*float64(*l_count) + *r_avg*float64(*r_count)) / float64(*l_count+*r_count)
+	}
+	return &avg
+}
@@ -0,0 +1,69 @@
+package dataset
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLengthFractionBelow(t *testing.T) {
+	min, max := uint64(1), uint64(10)
+	avg := 3.0
+	uniform := &StringType{MinLength: &min, MaxLength: &max}
+	skewed := &StringType{MinLength: &min, MaxLength: &max, AvgLength: &avg}
+	tests := []struct {
+		name   string
+		t      *StringType
+		length float64
+		want   float64
+		ok     bool
+	}{
+		{"unknown lengths", &StringType{}, 5, 0.0, false},
+		{"below minimum", uniform, 0, 0.0, true},
+		{"above maximum", uniform, 11, 1.0, true},
+		{"uniform middle", uniform, 5.5, 0.5, true},
+		{"average", skewed, 3, 0.5, true},
+		{"below average", skewed, 1.75, 0.25, true},
+		{"above average", skewed, 6.75, 0.75, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.t.LengthFractionBelow(test.length)
+			if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("LengthFractionBelow(%v) = %v, %v, want %v, %v", test.length, got, ok, test.want, test.ok)
+			}
+			if !ok {
+				return
+			}
+			// LengthQuantile is the inverse within the bounds
+			if length, _ := test.t.LengthQuantile(got); got > 0 && got < 1 && math.Abs(length-test.length) > 1e-9 {
+				t.Errorf("LengthQuantile(%v) = %v, want %v", got, length, test.length)
+			}
+		})
+	}
+}
+
+func TestMergeAverage(t *testing.T) {
+	l, r := 2.0, 8.0
+	tests := []struct {
+		name    string
+		l_avg   *float64
+		l_count *uint64
+		r_avg   *float64
+		r_count *uint64
+		want    *float64
+	}{
+		{"no averages", nil, nil, nil, nil, nil},
+		{"left only", &l, nil, nil, nil, &l},
+		{"right only", nil, nil, &r, nil, &r},
+		{"unknown counts", &l, nil, &r, uint64Pointer(3), func() *float64 { avg := 5.0; return &avg }()},
+		{"weighted", &l, uint64Pointer(3), &r, uint64Pointer(1), func() *float64 { avg := 3.5; return &avg }()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mergeAverage(test.l_avg, test.l_count, test.r_avg, test.r_count)
+			if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+				t.Errorf("mergeAverage() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
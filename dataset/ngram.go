@@ -0,0 +1,77 @@
+package dataset
+
+import (
+	"math"
+	"strings"
+)
+
+// The length (in characters) of the collected n-grams
+const NGramLength = 3
+
+// The maximum number of most common n-grams stored per path
+const MaxNGrams = 50
+
+// NGrams returns the distinct n-grams of the string in order of their first occurrence.
+// Strings shorter than NGramLength have no n-grams.
+func NGrams(str string) []string {
+	runes := []rune(str)
+	seen := make(map[string]struct{})
+	var ngrams []string
+	for i := 0; i+NGramLength <= len(runes); i++ {
+		ngram := string(runes[i : i+NGramLength])
+		if _, ok := seen[ngram]; !ok {
+			seen[ngram] = struct{}{}
+			ngrams = append(ngrams, ngram)
+		}
+	}
+	return ngrams
+}
+
+// NGramFraction estimates the fraction of string values at the path containing the given n-gram.
+// If no n-grams are known, false is returned.
+func (l *StringType) NGramFraction(ngram string) (float64, bool) {
+	if l.Count == nil || *l.Count == 0 || len(l.NGrams) == 0 {
+		return 0.0, false
+	}
+	least := l.NGrams[0].Count
+	for _, freq := range l.NGrams {
+		if freq.Value == ngram {
+			return math.Min(float64(freq.Count)/float64(*l.Count), 1.0), true
+		}
+		if freq.Count < least {
+			least = freq.Count
+		}
+	}
+	// A shorter list contains all n-grams of the path
+	if len(l.NGrams) < MaxNGrams {
+		return 0.0, true
+	}
+	// Unknown n-grams can not be more frequent than the least common known n-gram
+	return float64(least) / float64(*l.Count), true
+}
+
+// SubstringFraction estimates the fraction of string values at the path containing the given substring.
+// Substrings of at least NGramLength characters are estimated by their least frequent n-gram.
+// Shorter substrings are estimated by the most frequent n-gram containing them.
+// If no n-grams are known, false is returned.
+func (l *StringType) SubstringFraction(substr string) (float64, bool) {
+	if l.Count == nil || *l.Count == 0 || len(l.NGrams) == 0 {
+		return 0.0, false
+	}
+	ngrams := NGrams(substr)
+	if len(ngrams) == 0 {
+		fraction := 0.0
+		for _, freq := range l.NGrams {
+			if strings.Contains(freq.Value, substr) {
+				fraction = math.Max(fraction, math.Min(float64(freq.Count)/float64(*l.Count), 1.0))
+			}
+		}
+		return fraction, fraction > 0
+	}
+	fraction := 1.0
+	for _, ngram := range ngrams {
+		ngram_fraction, _ := l.NGramFraction(ngram)
+		fraction = math.Min(fraction, ngram_fraction)
+	}
+	return fraction, true
+}
@@ -0,0 +1,349 @@
+package dataset
+
+import (
+	"math"
+	"time"
+)
+
+// TemporalFormat is the representation of the timestamps stored at a path
+type TemporalFormat string
+
+const (
+	// ISO-8601 dates, e.g. "2021-03-04"
+	FormatDate TemporalFormat = "date"
+	// ISO-8601 timestamps in UTC with second precision, e.g. "2021-03-04T05:06:07Z"
+	FormatDateTime TemporalFormat = "datetime"
+	// RFC 3339 timestamps with fractional seconds or UTC offsets, e.g. "2021-03-04T05:06:07.123+01:00"
+	FormatRFC3339 TemporalFormat = "rfc3339"
+	// Integer seconds since the unix epoch
+	FormatEpochSeconds TemporalFormat = "epoch_seconds"
+	// Integer milliseconds since the unix epoch
+	FormatEpochMillis TemporalFormat = "epoch_millis"
+)
+
+// Epoch numbers are only detected as timestamps between these instants, to not mistake other numbers for timestamps
+var (
+	minEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxEpoch = time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// IsEpoch checks whether the timestamps are stored as numbers
+func (f TemporalFormat) IsEpoch() bool {
+	return f == FormatEpochSeconds || f == FormatEpochMillis
+}
+
+// Layout returns the Go time layout of string formats, or an empty string for epoch formats
+func (f TemporalFormat) Layout() string {
+	switch f {
+	case FormatDate:
+		return "2006-01-02"
+	case FormatDateTime:
+		return "2006-01-02T15:04:05Z"
+	case FormatRFC3339:
+		return time.RFC3339Nano
+	}
+	return ""
+}
+
+// Text returns the timestamp in the string format
+func (f TemporalFormat) Text(t time.Time) string {
+	return t.UTC().Format(f.Layout())
+}
+
+// Epoch returns the timestamp as number in the epoch format
+func (f TemporalFormat) Epoch(t time.Time) int64 {
+	if f == FormatEpochMillis {
+		return t.UnixMilli()
+	}
+	return t.Unix()
+}
+
+// ParseString parses a string timestamp of the format.
+// RFC 3339 timestamps may omit the fractional seconds, timestamps of other formats have to match the layout exactly.
+func (f TemporalFormat) ParseString(str string) (time.Time, bool) {
+	layout := f.Layout()
+	if layout == "" || (f != FormatRFC3339 && len(str) != len(layout)) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, str)
+	return t.UTC(), err == nil
+}
+
+// Returns the format covering the timestamps of both formats.
+// UTC timestamps with second precision are also RFC 3339 timestamps, other formats can not be combined.
+func commonFormat(l TemporalFormat, r TemporalFormat) (TemporalFormat, bool) {
+	switch {
+	case l == r:
+		return l, true
+	case (l == FormatDateTime && r == FormatRFC3339) || (l == FormatRFC3339 && r == FormatDateTime):
+		return FormatRFC3339, true
+	}
+	return "", false
+}
+
+// ParseNumber parses a numeric timestamp of the format
+func (f TemporalFormat) ParseNumber(number float64) (time.Time, bool) {
+	if number != math.Trunc(number) {
+		return time.Time{}, false
+	}
+	switch f {
+	case FormatEpochSeconds:
+		return time.Unix(int64(number), 0).UTC(), true
+	case FormatEpochMillis:
+		return time.UnixMilli(int64(number)).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// Granularity is a unit of time, used to describe the precision of timestamps and to bucket them
+type Granularity string
+
+const (
+	GranularityMillisecond Granularity = "millisecond"
+	GranularitySecond      Granularity = "second"
+	GranularityMinute      Granularity = "minute"
+	GranularityHour        Granularity = "hour"
+	GranularityDay         Granularity = "day"
+	GranularityMonth       Granularity = "month"
+	GranularityYear        Granularity = "year"
+)
+
+// AllGranularities returns all granularities from the finest to the coarsest
+func AllGranularities() []Granularity {
+	return []Granularity{GranularityMillisecond, GranularitySecond, GranularityMinute, GranularityHour, GranularityDay, GranularityMonth, GranularityYear}
+}
+
+// Returns the position of the granularity in AllGranularities
+func (g Granularity) rank() int {
+	for i, granularity := range AllGranularities() {
+		if g == granularity {
+			return i
+		}
+	}
+	return -1
+}
+
+// Finer checks whether g is a finer unit than r
+func (g Granularity) Finer(r Granularity) bool {
+	return g.rank() < r.rank()
+}
+
+// Duration returns the (average) duration of the unit
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case GranularityMillisecond:
+		return time.Millisecond
+	case GranularitySecond:
+		return time.Second
+	case GranularityMinute:
+		return time.Minute
+	case GranularityHour:
+		return time.Hour
+	case GranularityDay:
+		return 24 * time.Hour
+	case GranularityMonth:
+		return 30 * 24 * time.Hour
+	case GranularityYear:
+		return 365 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Truncate returns the start of the unit containing the timestamp
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case GranularityYear:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(g.Duration())
+}
+
+// GranularityOf returns the precision of the timestamp, the coarsest unit the timestamp is at the start of
+func GranularityOf(t time.Time) Granularity {
+	t = t.UTC()
+	precision := GranularityMillisecond
+	for _, granularity := range AllGranularities() {
+		if !granularity.Truncate(t).Equal(t) {
+			break
+		}
+		precision = granularity
+	}
+	return precision
+}
+
+// TemporalType represents timestamps stored at a DataPath.
+// A path is temporal, if all its string or all its number values are timestamps of a single format.
+// UTC timestamps with second precision and other RFC 3339 timestamps may be mixed.
+type TemporalType struct {
+	// An optional count of how many documents have a timestamp at the path
+	Count  *uint64
+	Format TemporalFormat
+	// The earliest and latest timestamp
+	Min *time.Time
+	Max *time.Time
+	// The precision of the timestamps, the finest unit of all timestamps
+	Granularity Granularity
+}
+
+// FractionBefore estimates the fraction of timestamps at the path before the given instant.
+// The timestamps are assumed to be distributed uniformly between the minimum and the end of the unit of the maximum.
+// If the minimum and maximum are not known, false is returned.
+func (l *TemporalType) FractionBefore(t time.Time) (float64, bool) {
+	if l.Min == nil || l.Max == nil {
+		return 0.0, false
+	}
+	end := l.Max.Add(l.Granularity.Duration())
+	switch {
+	case !t.After(*l.Min):
+		return 0.0, true
+	case !t.Before(end):
+		return 1.0, true
+	}
+	return float64(t.Sub(*l.Min)) / float64(end.Sub(*l.Min)), true
+}
+
+// Quantile returns the estimated instant before which the given fraction (0-1) of timestamps lie.
+// It is the inverse of FractionBefore.
+// If the minimum and maximum are not known, false is returned.
+func (l *TemporalType) Quantile(fraction float64) (time.Time, bool) {
+	if l.Min == nil || l.Max == nil {
+		return time.Time{}, false
+	}
+	fraction = math.Max(math.Min(fraction, 1.0), 0.0)
+	end := l.Max.Add(l.Granularity.Duration())
+	return l.Min.Add(time.Duration(fraction * float64(end.Sub(*l.Min)))), true
+}
+
+// TemporalFractionBefore estimates the fraction of timestamps at the path before the given instant.
+// Epoch timestamps are estimated with the histogram of the numbers, if it exists.
+// If the path is not temporal or the distribution is not known, false is returned.
+func (l *DataPath) TemporalFractionBefore(t time.Time) (float64, bool) {
+	if l.Temporaltype == nil {
+		return 0.0, false
+	}
+	format := l.Temporaltype.Format
+	if format.IsEpoch() && l.Floattype != nil && l.Floattype.Histogram != nil {
+		return l.Floattype.Histogram.FractionBelow(float64(format.Epoch(t)), false), true
+	}
+	return l.Temporaltype.FractionBefore(t)
+}
+
+// TemporalQuantile returns the estimated instant before which the given fraction (0-1) of timestamps at the path lie.
+// It is the inverse of TemporalFractionBefore.
+// If the path is not temporal or the distribution is not known, false is returned.
+func (l *DataPath) TemporalQuantile(fraction float64) (time.Time, bool) {
+	if l.Temporaltype == nil {
+		return time.Time{}, false
+	}
+	format := l.Temporaltype.Format
+	if format.IsEpoch() && l.Floattype != nil && l.Floattype.Histogram != nil {
+		return format.ParseNumber(math.Round(l.Floattype.Histogram.Quantile(fraction)))
+	}
+	return l.Temporaltype.Quantile(fraction)
+}
+
+// Merges the statistics of two temporal types.
+// If the formats can not be combined, the path is not temporal and nil is returned.
+func (l *TemporalType) merge(r TemporalType) *TemporalType {
+	format, ok := commonFormat(l.Format, r.Format)
+	if !ok {
+		return nil
+	}
+	l.Format = format
+
+	if l.Count == nil {
+		l.Count = r.Count
+	} else if r.Count != nil {
+		*l.Count += *r.Count
+	}
+
+	if l.Min == nil || (r.Min != nil && r.Min.Before(*l.Min)) {
+		l.Min = r.Min
+	}
+	if l.Max == nil || (r.Max != nil && r.Max.After(*l.Max)) {
+		l.Max = r.Max
+	}
+
+	if r.Granularity.Finer(l.Granularity) {
+		l.Granularity = r.Granularity
+	}
+	return l
+}
+
+// TemporalAnalysis detects timestamps among the string and number values of a path
+type TemporalAnalysis struct {
+	format      TemporalFormat
+	invalid     bool
+	count       uint64
+	min         time.Time
+	max         time.Time
+	granularity Granularity
+}
+
+// AddString adds count occurrences of a string value
+func (a *TemporalAnalysis) AddString(str string, count uint64) {
+	for _, format := range []TemporalFormat{FormatDateTime, FormatDate, FormatRFC3339} {
+		if t, ok := format.ParseString(str); ok {
+			a.add(format, t, count)
+			return
+		}
+	}
+	a.invalid = true
+}
+
+// AddNumber adds count occurrences of a number value
+func (a *TemporalAnalysis) AddNumber(number float64, count uint64) {
+	for _, format := range []TemporalFormat{FormatEpochSeconds, FormatEpochMillis} {
+		if t, ok := format.ParseNumber(number); ok && !t.Before(minEpoch) && t.Before(maxEpoch) {
+			a.add(format, t, count)
+			return
+		}
+	}
+	a.invalid = true
+}
+
+func (a *TemporalAnalysis) add(format TemporalFormat, t time.Time, count uint64) {
+	if a.invalid {
+		return
+	}
+	if a.count > 0 {
+		common, ok := commonFormat(a.format, format)
+		if !ok {
+			a.invalid = true
+			return
+		}
+		format = common
+	}
+	granularity := GranularityOf(t)
+	if a.count == 0 || t.Before(a.min) {
+		a.min = t
+	}
+	if a.count == 0 || t.After(a.max) {
+		a.max = t
+	}
+	if a.count == 0 || granularity.Finer(a.granularity) {
+		a.granularity = granularity
+	}
+	a.format = format
+	a.count += count
+}
+
+// TemporalType returns the statistics of the timestamps, or nil if not all values are timestamps of a single format
+func (a *TemporalAnalysis) TemporalType() *TemporalType {
+	if a.invalid || a.count == 0 {
+		return nil
+	}
+	count := a.count
+	min := a.min
+	max := a.max
+	return &TemporalType{
+		Count:       &count,
+		Format:      a.format,
+		Min:         &min,
+		Max:         &max,
+		Granularity: a.granularity,
+	}
+}
@@ -0,0 +1,170 @@
+package dataset
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTemporalFormatParse(t *testing.T) {
+	tests := []struct {
+		format TemporalFormat
+		str    string
+		want   time.Time
+		ok     bool
+	}{
+		{FormatDate, "2021-03-04", time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC), true},
+		{FormatDate, "2021-3-4", time.Time{}, false},
+		{FormatDate, "2021-03-04T05:06:07Z", time.Time{}, false},
+		{FormatDateTime, "2021-03-04T05:06:07Z", time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC), true},
+		{FormatDateTime, "2021-03-04", time.Time{}, false},
+		{FormatEpochSeconds, "1614834367", time.Time{}, false},
+		{FormatRFC3339, "2021-03-04T05:06:07Z", time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC), true},
+		{FormatRFC3339, "2021-03-04T05:06:07.5Z", time.Date(2021, time.March, 4, 5, 6, 7, 5e8, time.UTC), true},
+		{FormatRFC3339, "2021-03-04T07:06:07+02:00", time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC), true},
+		{FormatRFC3339, "2021-03-04T03:36:07.123-01:30", time.Date(2021, time.March, 4, 5, 6, 7, 123e6, time.UTC), true},
+		{FormatRFC3339, "2021-03-04", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := test.format.ParseString(test.str)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("%s.ParseString(%q) = %v, %v, want %v, %v", test.format, test.str, got, ok, test.want, test.ok)
+		}
+		if ok && got.Location() != time.UTC {
+			t.Errorf("%s.ParseString(%q) is in %v, want UTC", test.format, test.str, got.Location())
+		}
+		if reparsed, _ := test.format.ParseString(test.format.Text(got)); ok && !reparsed.Equal(got) {
+			t.Errorf("%s.Text(%v) = %q is parsed as %v", test.format, got, test.format.Text(got), reparsed)
+		}
+	}
+}
+
+func TestTemporalFormatParseNumber(t *testing.T) {
+	instant := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		format TemporalFormat
+		number float64
+		want   time.Time
+		ok     bool
+	}{
+		{FormatEpochSeconds, float64(instant.Unix()), instant, true},
+		{FormatEpochMillis, float64(instant.UnixMilli()), instant, true},
+		{FormatEpochSeconds, 1.5, time.Time{}, false},
+		{FormatDate, float64(instant.Unix()), time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := test.format.ParseNumber(test.number)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("%s.ParseNumber(%v) = %v, %v, want %v, %v", test.format, test.number, got, ok, test.want, test.ok)
+		}
+		if ok && float64(test.format.Epoch(got)) != test.number {
+			t.Errorf("%s.Epoch(%v) = %v, want %v", test.format, got, test.format.Epoch(got), test.number)
+		}
+	}
+}
+
+func TestGranularity(t *testing.T) {
+	instant := time.Date(2021, time.March, 4, 5, 6, 7, 8000000, time.UTC)
+	tests := []struct {
+		granularity Granularity
+		truncated   time.Time
+	}{
+		{GranularityMillisecond, instant},
+		{GranularitySecond, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)},
+		{GranularityMinute, time.Date(2021, time.March, 4, 5, 6, 0, 0, time.UTC)},
+		{GranularityHour, time.Date(2021, time.March, 4, 5, 0, 0, 0, time.UTC)},
+		{GranularityDay, time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)},
+		{GranularityMonth, time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{GranularityYear, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := test.granularity.Truncate(instant); !got.Equal(test.truncated) {
+			t.Errorf("%s.Truncate(%v) = %v, want %v", test.granularity, instant, got, test.truncated)
+		}
+		if got := GranularityOf(test.truncated); got != test.granularity {
+			t.Errorf("GranularityOf(%v) = %s, want %s", test.truncated, got, test.granularity)
+		}
+	}
+	if !GranularityDay.Finer(GranularityMonth) || GranularityYear.Finer(GranularityDay) {
+		t.Errorf("Finer() does not order the granularities")
+	}
+}
+
+func TestTemporalFractionBefore(t *testing.T) {
+	min := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
+	temporal := &TemporalType{Format: FormatDate, Min: &min, Max: &max, Granularity: GranularityDay}
+	tests := []struct {
+		instant time.Time
+		want    float64
+	}{
+		{min.AddDate(0, 0, -1), 0.0},
+		{min, 0.0},
+		{min.AddDate(0, 0, 5), 0.5},
+		{max, 0.9},
+		{max.AddDate(0, 0, 1), 1.0},
+	}
+	for _, test := range tests {
+		got, ok := temporal.FractionBefore(test.instant)
+		if !ok || math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("FractionBefore(%v) = %v, %v, want %v", test.instant, got, ok, test.want)
+		}
+		if got > 0 && got < 1 {
+			if instant, _ := temporal.Quantile(got); !instant.Equal(test.instant) {
+				t.Errorf("Quantile(%v) = %v, want %v", got, instant, test.instant)
+			}
+		}
+	}
+	if _, ok := (&TemporalType{}).FractionBefore(min); ok {
+		t.Errorf("FractionBefore() without range succeeded")
+	}
+}
+
+func TestTemporalAnalysis(t *testing.T) {
+	tests := []struct {
+		name        string
+		strings     []string
+		numbers     []float64
+		format      TemporalFormat
+		granularity Granularity
+	}{
+		{"no values", nil, nil, "", ""},
+		{"dates", []string{"2021-03-04", "2021-01-01"}, nil, FormatDate, GranularityDay},
+		{"datetimes", []string{"2021-03-04T05:06:00Z", "2021-03-04T05:00:00Z"}, nil, FormatDateTime, GranularityMinute},
+		{"mixed formats", []string{"2021-03-04", "2021-03-04T05:06:07Z"}, nil, "", ""},
+		{"offsets", []string{"2021-03-04T05:06:07+02:00", "2021-03-04T05:06:07.25Z"}, nil, FormatRFC3339, GranularityMillisecond},
+		{"datetimes and offsets", []string{"2021-03-04T05:06:00Z", "2021-03-04T05:00:00+01:00", "2021-03-04T06:00:00Z"}, nil, FormatRFC3339, GranularityMinute},
+		{"other strings", []string{"2021-03-04", "yesterday"}, nil, "", ""},
+		{"epoch seconds", nil, []float64{1614834367, 1614834000}, FormatEpochSeconds, GranularitySecond},
+		{"epoch millis", nil, []float64{1614834367123}, FormatEpochMillis, GranularityMillisecond},
+		{"small numbers", nil, []float64{42}, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			analysis := &TemporalAnalysis{}
+			for _, str := range test.strings {
+				analysis.AddString(str, 2)
+			}
+			for _, number := range test.numbers {
+				analysis.AddNumber(number, 2)
+			}
+			temporal := analysis.TemporalType()
+			if test.format == "" {
+				if temporal != nil {
+					t.Errorf("TemporalType() = %v, want nil", temporal)
+				}
+				return
+			}
+			if temporal == nil {
+				t.Fatalf("TemporalType() = nil, want format %s", test.format)
+			}
+			count := uint64(2 * (len(test.strings) + len(test.numbers)))
+			if temporal.Format != test.format || temporal.Granularity != test.granularity || *temporal.Count != count {
+				t.Errorf("TemporalType() = %s, %s, %d, want %s, %s, %d", temporal.Format, temporal.Granularity, *temporal.Count, test.format, test.granularity, count)
+			}
+			if temporal.Min.After(*temporal.Max) {
+				t.Errorf("TemporalType() minimum %v after maximum %v", temporal.Min, temporal.Max)
+			}
+		})
+	}
+}
@@ -0,0 +1,944 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// Evaluator evaluates a query on a stream of decoded JSON documents.
+// It serves as an offline and deterministic reference implementation for the query semantics.
+// The base dataset of the query is not loaded by the evaluator, the documents have to be added with Add.
+// The documents of a joined dataset have to be added with AddJoined before.
+// Queries based on intermediate sets have to be merged with Query.MergeQuery first.
+type Evaluator struct {
+	// The path of the array to unwind, empty if the documents are not unwound
+	unwind string
+	// The join with another dataset, nil if no dataset is joined
+	join *query.Join
+	// The documents of the joined dataset by their join value
+	joined map[string][]interface{}
+	// Checks if a document matches the filter predicate
+	matcher matcher
+	// The projection of matching documents, nil if the whole documents are kept
+	projection *query.Projection
+	// Creates a new aggregator for each group, nil if the query is not aggregated
+	newAggregator func() aggregator
+	// The grouping keys, nil if the aggregation is not grouped
+	groupKeys []query.GroupKey
+	// The name of the aggregation attribute
+	aggName string
+	// The keys to order the result by
+	sortKeys []query.SortKey
+	// The maximum number of results, 0 if unlimited
+	limit uint64
+	// Documents matching the predicate, if the query is not aggregated
+	documents []interface{}
+	// Aggregation state per group key
+	groups map[string]*group
+}
+
+type group struct {
+	value      interface{}
+	aggregator aggregator
+}
+
+// Creates a new Evaluator for the given query.
+// An error is returned if the query contains predicates or aggregations that can not be evaluated.
+func New(q query.Query) (*Evaluator, error) {
+	m, err := compilePredicate(q.FilterPredicate())
+	if err != nil {
+		return nil, err
+	}
+	e := &Evaluator{
+		unwind:     q.UnwindPath(),
+		join:       q.GetJoin(),
+		joined:     make(map[string][]interface{}),
+		matcher:    m,
+		projection: q.Projection(),
+		sortKeys:   q.SortKeys(),
+		limit:      q.ResultLimit(),
+		groups:     make(map[string]*group),
+	}
+
+	agg := q.Aggregation()
+	if agg != nil {
+		e.aggName = agg.Name()
+		if grouped, ok := agg.(query.GroupedAggregation); ok {
+			e.groupKeys = grouped.Keys
+			agg = grouped.Agg
+		}
+		e.newAggregator, err = compileAggregation(agg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Evaluate evaluates the query on all given documents and returns the result
+func Evaluate(q query.Query, docs []interface{}) ([]interface{}, error) {
+	return EvaluateJoin(q, docs, nil)
+}
+
+// EvaluateJoin evaluates the query on all given documents, joined with the given documents of the joined dataset, and returns the result
+func EvaluateJoin(q query.Query, docs []interface{}, joined []interface{}) ([]interface{}, error) {
+	e, err := New(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range joined {
+		e.AddJoined(doc)
+	}
+	for _, doc := range docs {
+		e.Add(doc)
+	}
+	return e.Result(), nil
+}
+
+// AddJoined adds a document of the joined dataset.
+// Documents without string or number at the join path never match and are ignored.
+func (e *Evaluator) AddJoined(doc interface{}) {
+	if e.join == nil {
+		return
+	}
+	value, ok := Resolve(doc, e.join.ForeignPath)
+	if !ok || !isJoinValue(value) {
+		return
+	}
+	key := groupKey(value)
+	e.joined[key] = append(e.joined[key], doc)
+}
+
+// Add evaluates the query on a single document.
+// If the query unwinds an array, the query is evaluated on each unwound document instead.
+// If the query joins a dataset, the query is evaluated on the document joined with each matching document instead.
+func (e *Evaluator) Add(doc interface{}) {
+	if e.unwind == "" {
+		e.lookup(doc)
+		return
+	}
+	array, ok := Resolve(doc, e.unwind)
+	if !ok {
+		return
+	}
+	elements, ok := array.([]interface{})
+	if !ok {
+		return
+	}
+	for _, element := range elements {
+		e.lookup(replace(doc, e.unwind, element))
+	}
+}
+
+// Joins the document with each matching document of the joined dataset and evaluates the query on the results
+func (e *Evaluator) lookup(doc interface{}) {
+	if e.join == nil {
+		e.add(doc)
+		return
+	}
+	value, ok := Resolve(doc, e.join.Path)
+	if !ok || !isJoinValue(value) {
+		return
+	}
+	for _, joined := range e.joined[groupKey(value)] {
+		e.add(replace(doc, e.join.As, joined))
+	}
+}
+
+// Checks whether the value can be joined, only strings and numbers are joined
+func isJoinValue(value interface{}) bool {
+	if _, ok := value.(string); ok {
+		return true
+	}
+	_, ok := toFloat(value)
+	return ok
+}
+
+func (e *Evaluator) add(doc interface{}) {
+	if !e.matcher(doc) {
+		return
+	}
+	doc = e.project(doc)
+	if e.newAggregator == nil {
+		e.documents = append(e.documents, doc)
+		return
+	}
+
+	value := e.groupValue(doc)
+	key := groupKey(value)
+	g, ok := e.groups[key]
+	if !ok {
+		g = &group{value: value, aggregator: e.newAggregator()}
+		e.groups[key] = g
+	}
+	g.aggregator.add(doc)
+}
+
+// Result returns the matching documents or, if the query is aggregated, the aggregated rows.
+// Ungrouped aggregations return a single row {<name>: <value>}.
+// Grouped aggregations return one row {"group": <value>, <name>: <value>} per group, ordered by group value.
+// Groups of multiple keys have the array of the key values as group value.
+// Multiple aggregations are stored in one attribute each.
+// If the query is ordered or limited, the documents or rows are ordered and limited afterwards.
+func (e *Evaluator) Result() []interface{} {
+	if e.newAggregator == nil {
+		return e.order(e.documents)
+	}
+
+	if e.groupKeys == nil {
+		g, ok := e.groups[groupKey(nil)]
+		if !ok { // Aggregate over an empty set
+			g = &group{aggregator: e.newAggregator()}
+		}
+		return e.order([]interface{}{e.row(g.aggregator)})
+	}
+
+	groups := make([]*group, 0, len(e.groups))
+	for _, g := range e.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return compareValues(groups[i].value, groups[j].value) < 0
+	})
+	rows := make([]interface{}, 0, len(groups))
+	for _, g := range groups {
+		row := e.row(g.aggregator)
+		row["group"] = g.value
+		rows = append(rows, row)
+	}
+	return e.order(rows)
+}
+
+// Orders the results by the sort keys and returns the first results up to the limit.
+// Groups with equal keys are ordered by their group value, like in the translations.
+// Documents are ordered by all sortable paths by the generator, the remaining ties keep the order of the input.
+func (e *Evaluator) order(results []interface{}) []interface{} {
+	if len(e.sortKeys) > 0 || e.limit > 0 {
+		results = append([]interface{}{}, results...)
+		sort.SliceStable(results, func(i, j int) bool {
+			for _, key := range e.sortKeys {
+				cmp := compareValues(sortValue(results[i], key), sortValue(results[j], key))
+				if key.Descending {
+					cmp = -cmp
+				}
+				if cmp != 0 {
+					return cmp < 0
+				}
+			}
+			if e.groupKeys != nil {
+				return compareValues(results[i].(map[string]interface{})["group"], results[j].(map[string]interface{})["group"]) < 0
+			}
+			return false
+		})
+	}
+	if e.limit > 0 && uint64(len(results)) > e.limit {
+		results = results[:e.limit]
+	}
+	return results
+}
+
+// Returns the value of a document or aggregated row to order by, nil if it does not exist
+func sortValue(result interface{}, key query.SortKey) interface{} {
+	if key.IsAggregation() {
+		if row, ok := result.(map[string]interface{}); ok {
+			return row[key.Aggregation]
+		}
+		return nil
+	}
+	value, _ := Resolve(result, key.Path)
+	return value
+}
+
+// Returns the attributes holding the results of the aggregator
+func (e *Evaluator) row(a aggregator) map[string]interface{} {
+	if multi, ok := a.(*multiAggregator); ok {
+		return multi.result().(map[string]interface{})
+	}
+	return map[string]interface{}{e.aggName: a.result()}
+}
+
+// Matches checks whether a single document satisfies the predicate.
+// Projects a matching document to a new object of the projected attributes.
+// Attributes whose source path is missing in the document are omitted.
+func (e *Evaluator) project(doc interface{}) interface{} {
+	if e.projection == nil {
+		return doc
+	}
+	projected := make(map[string]interface{})
+	for _, attribute := range e.projection.Attributes {
+		if value, ok := Resolve(doc, attribute.Source); ok {
+			projected[attribute.Name()] = value
+		}
+	}
+	return projected
+}
+
+// Returns a copy of the document, in which the value at the path is replaced or added to the existing parent object.
+// Only the objects along the path are copied.
+func replace(doc interface{}, path string, value interface{}) interface{} {
+	if path == "" {
+		return value
+	}
+	keys := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return doc
+	}
+	copied := make(map[string]interface{}, len(object))
+	for key, child := range object {
+		copied[key] = child
+	}
+	if len(keys) == 1 {
+		copied[keys[0]] = value
+	} else {
+		copied[keys[0]] = replace(object[keys[0]], "/"+keys[1], value)
+	}
+	return copied
+}
+
+// A nil predicate matches every document.
+func Matches(predicate query.Predicate, doc interface{}) (bool, error) {
+	m, err := compilePredicate(predicate)
+	if err != nil {
+		return false, err
+	}
+	return m(doc), nil
+}
+
+// Resolve returns the value at the given JSON pointer path and whether it exists
+func Resolve(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+	current := doc
+	for _, key := range strings.Split(path, "/")[1:] {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			child, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			current = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+//
+// Predicates
+//
+
+type matcher func(doc interface{}) bool
+
+func compilePredicate(predicate query.Predicate) (matcher, error) {
+	if predicate == nil {
+		return func(doc interface{}) bool { return true }, nil
+	}
+
+	switch v := predicate.(type) {
+	case query.AndPredicate:
+		lhs, err := compilePredicate(v.Lhs)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := compilePredicate(v.Rhs)
+		if err != nil {
+			return nil, err
+		}
+		return func(doc interface{}) bool { return lhs(doc) && rhs(doc) }, nil
+	case query.OrPredicate:
+		lhs, err := compilePredicate(v.Lhs)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := compilePredicate(v.Rhs)
+		if err != nil {
+			return nil, err
+		}
+		return func(doc interface{}) bool { return lhs(doc) || rhs(doc) }, nil
+	case query.NotPredicate:
+		m, err := compilePredicate(v.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		return func(doc interface{}) bool { return !m(doc) }, nil
+	case query.ExistsPredicate:
+		return func(doc interface{}) bool {
+			_, ok := Resolve(doc, v.Path)
+			return ok
+		}, nil
+	case query.TypeCheckPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			return hasType(value, v.Type)
+		}), nil
+	case query.IntEqualityPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			return equalsInt(value, v.Number)
+		}), nil
+	case query.FloatComparisonPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			f, ok := toFloat(value)
+			return ok && compareFloat(f, v.Number, v.Smaller, v.Equal)
+		}), nil
+	case query.RangePredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			f, ok := toFloat(value)
+			return ok && compareFloat(f, v.Lower, false, v.LowerInclusive) && compareFloat(f, v.Upper, true, v.UpperInclusive)
+		}), nil
+	case query.StrEqualityPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			str, ok := value.(string)
+			return ok && str == v.Str
+		}), nil
+	case query.InPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			if str, ok := value.(string); ok {
+				for _, candidate := range v.Strings {
+					if str == candidate {
+						return true
+					}
+				}
+				return false
+			}
+			for _, candidate := range v.Numbers {
+				if equalsInt(value, candidate) {
+					return true
+				}
+			}
+			return false
+		}), nil
+	case query.StrPrefixPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			str, ok := value.(string)
+			return ok && strings.HasPrefix(str, v.Prefix)
+		}), nil
+	case query.StrContainsPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			str, ok := value.(string)
+			return ok && strings.Contains(str, v.Substring)
+		}), nil
+	case query.StrRegexPredicate:
+		regex, err := regexp.Compile(v.Regex())
+		if err != nil {
+			return nil, fmt.Errorf("could not compile regular expression: %v", err)
+		}
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			str, ok := value.(string)
+			return ok && regex.MatchString(str)
+		}), nil
+	case query.BoolEqualityPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			b, ok := value.(bool)
+			return ok && b == v.Value
+		}), nil
+	case query.ObjectSizeComparisonPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			obj, ok := value.(map[string]interface{})
+			return ok && compareFloat(float64(len(obj)), float64(v.Number), v.Smaller, v.Equal)
+		}), nil
+	case query.ArraySizeComparisonPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			arr, ok := value.([]interface{})
+			return ok && compareFloat(float64(len(arr)), float64(v.Number), v.Smaller, v.Equal)
+		}), nil
+	case query.StrLengthComparisonPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			str, ok := value.(string)
+			return ok && compareFloat(float64(utf8.RuneCountInString(str)), float64(v.Number), v.Smaller, v.Equal)
+		}), nil
+	case query.TemporalPredicate:
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			t, ok := toTime(value, v.Format)
+			return ok && (v.From == nil || !t.Before(*v.From)) && (v.To == nil || t.Before(*v.To))
+		}), nil
+	case query.PathComparisonPredicate:
+		return func(doc interface{}) bool {
+			lhs, lhs_ok := Resolve(doc, v.Lhs)
+			rhs, rhs_ok := Resolve(doc, v.Rhs)
+			if !lhs_ok || !rhs_ok {
+				return false
+			}
+			l, lhs_ok := toFloat(lhs)
+			r, rhs_ok := toFloat(rhs)
+			return lhs_ok && rhs_ok && compareFloat(l, r, v.Smaller, v.Equal)
+		}, nil
+	case query.PathStrEqualityPredicate:
+		return func(doc interface{}) bool {
+			lhs, lhs_ok := Resolve(doc, v.Lhs)
+			rhs, rhs_ok := Resolve(doc, v.Rhs)
+			if !lhs_ok || !rhs_ok {
+				return false
+			}
+			l, lhs_ok := lhs.(string)
+			r, rhs_ok := rhs.(string)
+			return lhs_ok && rhs_ok && l == r
+		}, nil
+	case query.AnyElementPredicate:
+		// The sub-predicate is evaluated on each element, its paths become relative to the element
+		m, err := compilePredicate(query.RebasePredicate(v.Predicate, dataset.ElementPath(v.Path), ""))
+		if err != nil {
+			return nil, err
+		}
+		return valueMatcher(v.Path, func(value interface{}) bool {
+			arr, ok := value.([]interface{})
+			if !ok {
+				return false
+			}
+			for _, element := range arr {
+				if m(element) {
+					return true
+				}
+			}
+			return false
+		}), nil
+	default:
+		return nil, fmt.Errorf("missing predicate type evaluation: %s", predicate.String())
+	}
+}
+
+// Creates a matcher checking the value at the path. Missing paths never match.
+func valueMatcher(path string, check func(value interface{}) bool) matcher {
+	return func(doc interface{}) bool {
+		value, ok := Resolve(doc, path)
+		return ok && check(value)
+	}
+}
+
+// Checks whether the value has the JSON type. Integers are also numbers.
+func hasType(value interface{}, t query.JSONType) bool {
+	switch t {
+	case query.TypeNull:
+		return value == nil
+	case query.TypeBool:
+		_, ok := value.(bool)
+		return ok
+	case query.TypeInt:
+		_, ok := toInt(value)
+		return ok
+	case query.TypeNumber:
+		_, ok := toFloat(value)
+		return ok
+	case query.TypeString:
+		_, ok := value.(string)
+		return ok
+	case query.TypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case query.TypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+// Checks whether the value is a number equal to the integer
+func equalsInt(value interface{}, number int64) bool {
+	if i, ok := toInt(value); ok {
+		return i == number
+	}
+	f, ok := toFloat(value)
+	return ok && f == float64(number)
+}
+
+func compareFloat(lhs float64, rhs float64, smaller bool, equal bool) bool {
+	if equal && lhs == rhs {
+		return true
+	}
+	if smaller {
+		return lhs < rhs
+	}
+	return lhs > rhs
+}
+
+//
+// Aggregations
+//
+
+type aggregator interface {
+	add(doc interface{})
+	result() interface{}
+}
+
+func compileAggregation(agg query.Aggregation) (func() aggregator, error) {
+	switch v := agg.(type) {
+	case query.GlobalCountAggregation:
+		return func() aggregator { return &countAggregator{} }, nil
+	case query.CountAggregation:
+		return func() aggregator { return &countAggregator{path: &v.Path} }, nil
+	case query.SumAggregation:
+		return func() aggregator { return &sumAggregator{path: v.Path} }, nil
+	case query.MinAggregation:
+		return func() aggregator { return &extremeAggregator{path: v.Path, valueType: v.Type, smaller: true} }, nil
+	case query.MaxAggregation:
+		return func() aggregator { return &extremeAggregator{path: v.Path, valueType: v.Type} }, nil
+	case query.AvgAggregation:
+		return func() aggregator { return &avgAggregator{path: v.Path} }, nil
+	case query.DistinctCountAggregation:
+		return func() aggregator { return &distinctAggregator{path: v.Path, values: make(map[string]struct{})} }, nil
+	case query.MultiAggregation:
+		names := make([]string, len(v.Aggs))
+		newAggregators := make([]func() aggregator, len(v.Aggs))
+		for i, named := range v.Aggs {
+			if _, ok := named.Agg.(query.MultiAggregation); ok {
+				return nil, fmt.Errorf("nested multiple aggregations can not be evaluated: %s", agg.String())
+			}
+			newAggregator, err := compileAggregation(named.Agg)
+			if err != nil {
+				return nil, err
+			}
+			names[i] = named.Name
+			newAggregators[i] = newAggregator
+		}
+		return func() aggregator {
+			multi := &multiAggregator{names: names}
+			for _, newAggregator := range newAggregators {
+				multi.aggregators = append(multi.aggregators, newAggregator())
+			}
+			return multi
+		}, nil
+	case query.GroupedAggregation:
+		return nil, fmt.Errorf("nested grouped aggregations can not be evaluated: %s", agg.String())
+	default:
+		return nil, fmt.Errorf("missing aggregation type evaluation: %s", agg.String())
+	}
+}
+
+// Counts all documents or, if a path is given, all documents containing the path
+type countAggregator struct {
+	path  *string
+	count uint64
+}
+
+func (a *countAggregator) add(doc interface{}) {
+	if a.path != nil {
+		if _, ok := Resolve(doc, *a.path); !ok {
+			return
+		}
+	}
+	a.count++
+}
+
+func (a *countAggregator) result() interface{} {
+	return a.count
+}
+
+// Sums all numbers at the path, ignoring other types
+type sumAggregator struct {
+	path string
+	sum  float64
+}
+
+func (a *sumAggregator) add(doc interface{}) {
+	value, _ := Resolve(doc, a.path)
+	if f, ok := toFloat(value); ok {
+		a.sum += f
+	}
+}
+
+func (a *sumAggregator) result() interface{} {
+	return a.sum
+}
+
+// Computes the minimum or maximum of all numbers or strings at the path, ignoring other types.
+// Without values, the result is null.
+type extremeAggregator struct {
+	path      string
+	valueType query.JSONType
+	smaller   bool
+	extreme   interface{}
+}
+
+func (a *extremeAggregator) add(doc interface{}) {
+	value, _ := Resolve(doc, a.path)
+	if a.valueType == query.TypeString {
+		str, ok := value.(string)
+		if !ok {
+			return
+		}
+		current, set := a.extreme.(string)
+		if !set || (a.smaller && str < current) || (!a.smaller && str > current) {
+			a.extreme = str
+		}
+		return
+	}
+	f, ok := toFloat(value)
+	if ok && (a.extreme == nil || compareFloat(f, a.extreme.(float64), a.smaller, false)) {
+		a.extreme = f
+	}
+}
+
+func (a *extremeAggregator) result() interface{} {
+	return a.extreme
+}
+
+// Averages all numbers at the path, ignoring other types.
+// Without numbers, the result is null.
+type avgAggregator struct {
+	path  string
+	sum   float64
+	count uint64
+}
+
+func (a *avgAggregator) add(doc interface{}) {
+	value, _ := Resolve(doc, a.path)
+	if f, ok := toFloat(value); ok {
+		a.sum += f
+		a.count++
+	}
+}
+
+func (a *avgAggregator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return a.sum / float64(a.count)
+}
+
+// Computes several aggregations over the same documents, the results are stored in the attributes of their names
+type multiAggregator struct {
+	names       []string
+	aggregators []aggregator
+}
+
+func (a *multiAggregator) add(doc interface{}) {
+	for _, aggregator := range a.aggregators {
+		aggregator.add(doc)
+	}
+}
+
+func (a *multiAggregator) result() interface{} {
+	results := make(map[string]interface{}, len(a.names))
+	for i, name := range a.names {
+		results[name] = a.aggregators[i].result()
+	}
+	return results
+}
+
+// Counts the distinct values at the path, ignoring null values
+type distinctAggregator struct {
+	path   string
+	values map[string]struct{}
+}
+
+func (a *distinctAggregator) add(doc interface{}) {
+	if value, ok := Resolve(doc, a.path); ok && value != nil {
+		a.values[groupKey(value)] = struct{}{}
+	}
+}
+
+func (a *distinctAggregator) result() interface{} {
+	return uint64(len(a.values))
+}
+
+//
+// Values
+//
+
+// Converts a JSON number to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Converts an integral JSON number to int64
+func toInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		// Integral numbers written with a fractional part or exponent, e.g. 1.0
+		if f, err := v.Float64(); err == nil {
+			return toInt(f)
+		}
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Converts a timestamp of the given format to a time
+func toTime(value interface{}, format dataset.TemporalFormat) (time.Time, bool) {
+	if str, ok := value.(string); ok {
+		return format.ParseString(str)
+	}
+	if f, ok := toFloat(value); ok {
+		return format.ParseNumber(f)
+	}
+	return time.Time{}, false
+}
+
+// Returns the value of the grouping keys of the document.
+// A single key is grouped by its value, multiple keys by the array of their values.
+func (e *Evaluator) groupValue(doc interface{}) interface{} {
+	if e.groupKeys == nil {
+		return nil
+	}
+	values := make([]interface{}, len(e.groupKeys))
+	for i, key := range e.groupKeys {
+		values[i], _ = Resolve(doc, key.Path)
+		if key.Bucket != nil {
+			values[i] = bucketValue(values[i], *key.Bucket)
+		}
+		if key.Bins != nil {
+			values[i] = binValue(values[i], *key.Bins)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Returns the start of the date bucket containing the timestamp as RFC 3339 string, or nil if the value is no timestamp
+func bucketValue(value interface{}, bucket query.DateBucket) interface{} {
+	t, ok := toTime(value, bucket.Format)
+	if !ok {
+		return nil
+	}
+	return bucket.Unit.Truncate(t).Format(time.RFC3339)
+}
+
+// Returns the lower bound of the bin containing the number, or nil if the value is no number
+func binValue(value interface{}, bins query.NumericBins) interface{} {
+	f, ok := toFloat(value)
+	if !ok {
+		return nil
+	}
+	return bins.Bound(int(math.Floor((f - bins.Min) / bins.Width)))
+}
+
+// Compares two JSON values, values of different types are ordered null < bools < numbers < strings < arrays < objects.
+// Strings are compared by their bytes and arrays by their elements in order.
+// Objects are compared by their sorted keys first and then by their values in the order of the keys, like jq does.
+func compareValues(a interface{}, b interface{}) int {
+	rank := func(value interface{}) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case string:
+			return 3
+		case []interface{}:
+			return 4
+		case map[string]interface{}:
+			return 5
+		}
+		return 2
+	}
+	if rank(a) != rank(b) {
+		return rank(a) - rank(b)
+	}
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0
+		} else if a {
+			return 1
+		}
+		return -1
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		b := b.([]interface{})
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if cmp := compareValues(a[i], b[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		return len(a) - len(b)
+	case map[string]interface{}:
+		b := b.(map[string]interface{})
+		a_keys := sortedKeys(a)
+		b_keys := sortedKeys(b)
+		for i := 0; i < len(a_keys) && i < len(b_keys); i++ {
+			if cmp := strings.Compare(a_keys[i], b_keys[i]); cmp != 0 {
+				return cmp
+			}
+		}
+		if len(a_keys) != len(b_keys) {
+			return len(a_keys) - len(b_keys)
+		}
+		for _, key := range a_keys {
+			if cmp := compareValues(a[key], b[key]); cmp != 0 {
+				return cmp
+			}
+		}
+		return 0
+	}
+	if fa, ok := toFloat(a); ok {
+		fb, _ := toFloat(b)
+		if fa < fb {
+			return -1
+		} else if fa > fb {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Returns the keys of the object in ascending order
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns a canonical key of a group value, numbers with equal value share a key
+func groupKey(value interface{}) string {
+	if f, ok := toFloat(value); ok {
+		value = f
+	}
+	if values, ok := value.([]interface{}); ok { // Values of multiple keys
+		keys := make([]string, len(values))
+		for i, v := range values {
+			keys[i] = groupKey(v)
+		}
+		return fmt.Sprintf("[%s]", strings.Join(keys, ","))
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
@@ -0,0 +1,323 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/JODA-Explore/BETZE/analyzer"
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// Decodes line-separated JSON documents like the analyzer does
+func decode(t *testing.T, lines string) []interface{} {
+	t.Helper()
+	var docs []interface{}
+	err := analyzer.ReadDocuments(strings.NewReader(lines), func(doc interface{}) error {
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not decode documents: %v", err)
+	}
+	return docs
+}
+
+// Encodes the results as line-separated JSON documents
+func encode(t *testing.T, results []interface{}) string {
+	t.Helper()
+	lines := make([]string, len(results))
+	for i, result := range results {
+		b, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("could not encode result: %v", err)
+		}
+		lines[i] = string(b)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestMatches(t *testing.T) {
+	doc := decode(t, `{"s":"hello","i":3,"f":2.5,"d":4.0,"b":true,"n":null,"o":{"a":1},"arr":[{"x":1},{"x":5}],"t":"2020-01-02"}`)[0]
+	from, _ := dataset.FormatDate.ParseString("2020-01-01")
+	to, _ := dataset.FormatDate.ParseString("2020-02-01")
+	tests := []struct {
+		name      string
+		predicate query.Predicate
+		want      bool
+	}{
+		{"nil", nil, true},
+		{"exists", query.ExistsPredicate{Path: "/o/a"}, true},
+		{"exists missing", query.ExistsPredicate{Path: "/o/b"}, false},
+		{"exists null", query.ExistsPredicate{Path: "/n"}, true},
+		{"type string", query.TypeCheckPredicate{Path: "/s", Type: query.TypeString}, true},
+		{"type number", query.TypeCheckPredicate{Path: "/s", Type: query.TypeNumber}, false},
+		{"type null", query.TypeCheckPredicate{Path: "/n", Type: query.TypeNull}, true},
+		{"type int", query.TypeCheckPredicate{Path: "/i", Type: query.TypeInt}, true},
+		{"type int integral float", query.TypeCheckPredicate{Path: "/d", Type: query.TypeInt}, true},
+		{"type int fraction", query.TypeCheckPredicate{Path: "/f", Type: query.TypeInt}, false},
+		{"int", query.IntEqualityPredicate{Path: "/i", Number: 3}, true},
+		{"int integral float", query.IntEqualityPredicate{Path: "/d", Number: 4}, true},
+		{"int fraction", query.IntEqualityPredicate{Path: "/f", Number: 2}, false},
+		{"float smaller", query.FloatComparisonPredicate{Path: "/f", Number: 3, Smaller: true}, true},
+		{"float greater equal", query.FloatComparisonPredicate{Path: "/f", Number: 2.5, Equal: true}, true},
+		{"float greater", query.FloatComparisonPredicate{Path: "/f", Number: 2.5}, false},
+		{"float string", query.FloatComparisonPredicate{Path: "/s", Number: 0}, false},
+		{"range", query.RangePredicate{Path: "/i", Lower: 3, Upper: 4, LowerInclusive: true}, true},
+		{"range exclusive", query.RangePredicate{Path: "/i", Lower: 3, Upper: 4}, false},
+		{"string", query.StrEqualityPredicate{Path: "/s", Str: "hello"}, true},
+		{"string number", query.StrEqualityPredicate{Path: "/i", Str: "3"}, false},
+		{"in string", query.InPredicate{Path: "/s", Strings: []string{"a", "hello"}}, true},
+		{"in number", query.InPredicate{Path: "/i", Numbers: []int64{1, 3}}, true},
+		{"in missing", query.InPredicate{Path: "/i", Numbers: []int64{1, 2}}, false},
+		{"prefix", query.StrPrefixPredicate{Path: "/s", Prefix: "he"}, true},
+		{"contains", query.StrContainsPredicate{Path: "/s", Substring: "ell"}, true},
+		{"regex", query.StrRegexPredicate{Path: "/s", Prefix: "h", Infixes: []string{"l", "o"}}, true},
+		{"regex order", query.StrRegexPredicate{Path: "/s", Prefix: "h", Infixes: []string{"o", "l"}}, false},
+		{"bool", query.BoolEqualityPredicate{Path: "/b", Value: true}, true},
+		{"object size", query.ObjectSizeComparisonPredicate{Path: "/o", Number: 1, Equal: true}, true},
+		{"array size", query.ArraySizeComparisonPredicate{Path: "/arr", Number: 2, Smaller: true}, false},
+		{"string length", query.StrLengthComparisonPredicate{Path: "/s", Number: 5, Smaller: true, Equal: true}, true},
+		{"temporal", query.TemporalPredicate{Path: "/t", Format: dataset.FormatDate, From: &from, To: &to}, true},
+		{"temporal before", query.TemporalPredicate{Path: "/t", Format: dataset.FormatDate, To: &from}, false},
+		{"path comparison", query.PathComparisonPredicate{Lhs: "/f", Rhs: "/i", Smaller: true}, true},
+		{"path comparison string", query.PathComparisonPredicate{Lhs: "/s", Rhs: "/i", Smaller: true}, false},
+		{"path string equality", query.PathStrEqualityPredicate{Lhs: "/s", Rhs: "/s"}, true},
+		{"any element", query.AnyElementPredicate{Path: "/arr", Predicate: query.IntEqualityPredicate{Path: "/arr/*/x", Number: 5}}, true},
+		{"any element none", query.AnyElementPredicate{Path: "/arr", Predicate: query.IntEqualityPredicate{Path: "/arr/*/x", Number: 2}}, false},
+		{"and", query.AndPredicate{Lhs: query.ExistsPredicate{Path: "/s"}, Rhs: query.ExistsPredicate{Path: "/x"}}, false},
+		{"or", query.OrPredicate{Lhs: query.ExistsPredicate{Path: "/s"}, Rhs: query.ExistsPredicate{Path: "/x"}}, true},
+		{"not", query.NotPredicate{Predicate: query.ExistsPredicate{Path: "/x"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Matches(test.predicate, doc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Matches(%v) = %v, want %v", test.predicate, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	docs := `{"id":1,"g":"b","n":20,"tags":[1,2]}
+{"id":2,"g":"a","n":100,"tags":[]}
+{"id":3,"g":"b","n":3.5,"tags":"x"}
+{"id":4,"n":"text"}`
+	base := &dataset.DataSet{Name: "base"}
+	group := func(agg query.Aggregation, keys ...query.GroupKey) query.Aggregation {
+		return query.GroupedAggregation{Keys: keys, Agg: agg}
+	}
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{
+			name:  "filter",
+			query: new(query.Query).Load(base).Filter(query.TypeCheckPredicate{Path: "/n", Type: query.TypeNumber}),
+			want: `{"g":"b","id":1,"n":20,"tags":[1,2]}
+{"g":"a","id":2,"n":100,"tags":[]}
+{"g":"b","id":3,"n":3.5,"tags":"x"}`,
+		},
+		{
+			name:  "count",
+			query: new(query.Query).Load(base).Aggregate(query.CountAggregation{Path: "/g"}),
+			want:  `{"count":3}`,
+		},
+		{
+			name:  "count empty",
+			query: new(query.Query).Load(base).Filter(query.ExistsPredicate{Path: "/x"}).Aggregate(query.GlobalCountAggregation{}),
+			want:  `{"count":0}`,
+		},
+		{
+			name:  "sum ignores strings",
+			query: new(query.Query).Load(base).Aggregate(query.SumAggregation{Path: "/n"}),
+			want:  `{"sum":123.5}`,
+		},
+		{
+			name:  "min string",
+			query: new(query.Query).Load(base).Aggregate(query.MinAggregation{Path: "/n", Type: query.TypeString}),
+			want:  `{"min":"text"}`,
+		},
+		{
+			name:  "max number",
+			query: new(query.Query).Load(base).Aggregate(query.MaxAggregation{Path: "/n", Type: query.TypeNumber}),
+			want:  `{"max":100}`,
+		},
+		{
+			name:  "avg without numbers",
+			query: new(query.Query).Load(base).Aggregate(query.AvgAggregation{Path: "/g"}),
+			want:  `{"avg":null}`,
+		},
+		{
+			name:  "distinct count",
+			query: new(query.Query).Load(base).Aggregate(query.DistinctCountAggregation{Path: "/g"}),
+			want:  `{"distinct":2}`,
+		},
+		{
+			name:  "groups ordered by value",
+			query: new(query.Query).Load(base).Aggregate(group(query.GlobalCountAggregation{}, query.GroupKey{Path: "/n"})),
+			want: `{"count":1,"group":3.5}
+{"count":1,"group":20}
+{"count":1,"group":100}
+{"count":1,"group":"text"}`,
+		},
+		{
+			name:  "groups of multiple keys",
+			query: new(query.Query).Load(base).Aggregate(group(query.GlobalCountAggregation{}, query.GroupKey{Path: "/g"}, query.GroupKey{Path: "/tags"})),
+			want: `{"count":1,"group":[null,null]}
+{"count":1,"group":["a",[]]}
+{"count":1,"group":["b","x"]}
+{"count":1,"group":["b",[1,2]]}`,
+		},
+		{
+			name:  "binned groups",
+			query: new(query.Query).Load(base).Aggregate(group(query.GlobalCountAggregation{}, query.GroupKey{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 50, Count: 3}})),
+			want: `{"count":1,"group":null}
+{"count":2,"group":0}
+{"count":1,"group":100}`,
+		},
+		{
+			name:  "bins are not clamped at the upper bound",
+			query: new(query.Query).Load(base).Aggregate(group(query.GlobalCountAggregation{}, query.GroupKey{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 50, Count: 2}})),
+			want: `{"count":1,"group":null}
+{"count":2,"group":0}
+{"count":1,"group":100}`,
+		},
+		{
+			name: "multiple aggregations",
+			query: new(query.Query).Load(base).Aggregate(query.MultiAggregation{Aggs: []query.NamedAggregation{
+				{Name: "count", Agg: query.GlobalCountAggregation{}},
+				{Name: "sum", Agg: query.SumAggregation{Path: "/n"}},
+			}}),
+			want: `{"count":4,"sum":123.5}`,
+		},
+		{
+			name:  "order and limit",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}).Limit(2),
+			want: `{"n":"text","id":4}
+{"g":"a","id":2,"n":100,"tags":[]}`,
+		},
+		{
+			name:  "limit keeps input order",
+			query: new(query.Query).Load(base).Limit(2),
+			want: `{"g":"b","id":1,"n":20,"tags":[1,2]}
+{"g":"a","id":2,"n":100,"tags":[]}`,
+		},
+		{
+			name:  "ties ordered by remaining keys",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/x", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/g", Type: query.TypeString}).Limit(2),
+			want: `{"id":4,"n":"text"}
+{"g":"a","id":2,"n":100,"tags":[]}`,
+		},
+		{
+			name: "order groups by aggregation",
+			query: new(query.Query).Load(base).
+				Aggregate(group(query.GlobalCountAggregation{}, query.GroupKey{Path: "/g"})).
+				OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(1),
+			want: `{"count":2,"group":"b"}`,
+		},
+		{
+			name:  "projection",
+			query: new(query.Query).Load(base).Filter(query.ExistsPredicate{Path: "/g"}).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/g", Target: "/group"}, {Source: "/x", Target: "/x"}}}),
+			want: `{"group":"b"}
+{"group":"a"}
+{"group":"b"}`,
+		},
+		{
+			name:  "unwind",
+			query: new(query.Query).Load(base).Unwind("/tags").Filter(query.ExistsPredicate{Path: "/tags"}).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/id", Target: "/id"}, {Source: "/tags", Target: "/tag"}}}),
+			want: `{"id":1,"tag":1}
+{"id":1,"tag":2}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := Evaluate(*test.query, decode(t, docs))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := encode(t, decode(t, test.want))
+			if got := encode(t, results); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestEvaluateJoin(t *testing.T) {
+	docs := decode(t, `{"id":1,"user":"a"}
+{"id":2,"user":"b"}
+{"id":3,"user":1}
+{"id":4}`)
+	joined := decode(t, `{"name":"a","age":30}
+{"name":"a","age":40}
+{"name":1.0,"age":50}
+{"name":"c","age":60}`)
+	q := new(query.Query).Load(&dataset.DataSet{Name: "base"}).Join(&query.Join{
+		Dataset:     &dataset.DataSet{Name: "users"},
+		Path:        "/user",
+		ForeignPath: "/name",
+		As:          "/users",
+	})
+	results, err := EvaluateJoin(*q, docs, joined)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := encode(t, decode(t, `{"id":1,"user":"a","users":{"name":"a","age":30}}
+{"id":1,"user":"a","users":{"name":"a","age":40}}
+{"id":3,"user":1,"users":{"name":1.0,"age":50}}`))
+	if got := encode(t, results); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEvaluateDateBuckets(t *testing.T) {
+	docs := decode(t, `{"t":"2021-03-04T23:30:00Z"}
+{"t":"2021-03-05T00:30:00+02:00"}
+{"t":"2021-03-05T01:00:00.5-01:00"}`)
+	q := new(query.Query).Load(&dataset.DataSet{Name: "base"}).Aggregate(query.GroupedAggregation{
+		Keys: []query.GroupKey{{Path: "/t", Bucket: &query.DateBucket{Format: dataset.FormatRFC3339, Unit: dataset.GranularityDay}}},
+		Agg:  query.GlobalCountAggregation{},
+	})
+	results, err := Evaluate(*q, docs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := encode(t, decode(t, `{"count":2,"group":"2021-03-04T00:00:00Z"}
+{"count":1,"group":"2021-03-05T00:00:00Z"}`))
+	if got := encode(t, results); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want int
+	}{
+		{nil, false, -1},
+		{true, false, 1},
+		{json.Number("20"), json.Number("100"), -1},
+		{json.Number("2"), 2.0, 0},
+		{json.Number("100"), "20", -1},
+		{"b", "a", 1},
+		{[]interface{}{"a", 2.0}, []interface{}{"a", 10.0}, -1},
+		{[]interface{}{"a"}, []interface{}{"a", nil}, -1},
+		{[]interface{}{}, map[string]interface{}{}, -1},
+		{map[string]interface{}{"b": 1.0}, map[string]interface{}{"a": 2.0, "b": 1.0}, 1},
+		{map[string]interface{}{"a": 1.0, "b": 2.0}, map[string]interface{}{"a": 1.0, "b": 3.0}, -1},
+		{map[string]interface{}{"a": "x"}, map[string]interface{}{"a": "x"}, 0},
+	}
+	for _, test := range tests {
+		got := compareValues(test.a, test.b)
+		if (got < 0) != (test.want < 0) || (got > 0) != (test.want > 0) {
+			t.Errorf("compareValues(%v, %v) = %d, want sign of %d", test.a, test.b, got, test.want)
+		}
+	}
+}
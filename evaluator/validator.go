@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/JODA-Explore/BETZE/analyzer"
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// Validator verifies generated queries in memory.
+// All documents of the base datasets are kept in memory and queried with the reference evaluator.
+type Validator struct {
+	// The documents of each base dataset
+	datasets map[string][]interface{}
+	// The documents of each executed query, by store name
+	results map[string][]interface{}
+}
+
+// Creates a new Validator without any datasets
+func NewValidator() *Validator {
+	return &Validator{
+		datasets: make(map[string][]interface{}),
+		results:  make(map[string][]interface{}),
+	}
+}
+
+// Adds a base dataset with the given documents
+func (v *Validator) AddDataset(name string, docs []interface{}) {
+	v.datasets[name] = docs
+}
+
+// Loads each line-separated JSON file as a base dataset named after the file
+func (v *Validator) LoadFiles(filenames []string) error {
+	for _, filename := range filenames {
+		var docs []interface{}
+		err := analyzer.ReadFile(filename, func(doc interface{}) error {
+			docs = append(docs, doc)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		v.AddDataset(analyzer.DatasetName(filename), docs)
+	}
+	return nil
+}
+
+// Evaluates the query on its base dataset and returns the size of the result set
+func (v *Validator) ResultSize(q query.Query) (uint64, error) {
+	docs, ok := v.datasets[q.BaseName()]
+	if !ok {
+		return 0, fmt.Errorf("unknown dataset %s", q.BaseName())
+	}
+	var joined []interface{}
+	if join := q.GetJoin(); join != nil {
+		joined, ok = v.datasets[join.DatasetName()]
+		if !ok {
+			return 0, fmt.Errorf("unknown dataset %s", join.DatasetName())
+		}
+	}
+	result, err := EvaluateJoin(q.CopyWithoutAggregation(), docs, joined)
+	if err != nil {
+		return 0, err
+	}
+	v.results[q.StoreName()] = result
+	return uint64(len(result)), nil
+}
+
+// Analyzes the result set of the query
+func (v *Validator) Analyze(q query.Query) (dataset.DataSet, error) {
+	docs, ok := v.results[q.StoreName()]
+	if !ok {
+		return dataset.DataSet{}, fmt.Errorf("no result stored for %s", q.StoreName())
+	}
+	a := analyzer.New()
+	for _, doc := range docs {
+		a.Add(doc)
+	}
+	return a.DataSet(q.StoreName()), nil
+}
+
+// Removes the result set of the query
+func (v *Validator) Cleanup(q query.Query) error {
+	delete(v.results, q.StoreName())
+	return nil
+}
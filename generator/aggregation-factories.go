@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"strings"
@@ -28,7 +29,7 @@ type AggregationFactoryRepo struct {
 }
 
 func GetAggregationFactoryRepo() AggregationFactoryRepo {
-	defaultFactories := []AggregationFactory{CountAllAggregationFactory{}, CountAggregationFactory{}, GroupByAggregationFactory{}, SumAggregationFactory{}}
+	defaultFactories := []AggregationFactory{CountAllAggregationFactory{}, CountAggregationFactory{}, GroupByAggregationFactory{}, SumAggregationFactory{}, MinAggregationFactory{}, MaxAggregationFactory{}, AvgAggregationFactory{}, DistinctCountAggregationFactory{}}
 	return AggregationFactoryRepo{
 		allfactories: defaultFactories,
 	}
@@ -153,9 +154,72 @@ func (e CountAggregationFactory) Type() reflect.Type {
 type GroupByAggregationFactory struct {
 }
 
-// Checks wether the aggregation can be used on the given dataset
+// The maximum number of distinct values of a path that is grouped by
+const maxGroupByCardinality = 1000
+
+// Checks wether the aggregation can be used on the given dataset.
+// Either the values of the path, the buckets of its timestamps or the bins of its numbers are grouped.
 func (e GroupByAggregationFactory) IsApplicable(p dataset.DataPath) bool {
-	return p.HasNumCount() || p.HasStringCount() || p.HasBoolCount()
+	return e.isValueApplicable(p) || len(dateBucketUnits(p)) > 0 || isBinApplicable(p)
+}
+
+// Checks wether the values of the path can be grouped as they are.
+// Paths with too many distinct values (e.g. IDs) are not used, as they create about one group per document.
+func (e GroupByAggregationFactory) isValueApplicable(p dataset.DataPath) bool {
+	if !(p.HasNumCount() || p.HasStringCount() || p.HasBoolCount()) {
+		return false
+	}
+	groups, ok := estimateGroups(p)
+	if !ok {
+		return true
+	}
+	return groups <= maxGroupByCardinality && (p.Count == nil || groups*2 <= *p.Count)
+}
+
+// Estimates the number of groups when grouping by the path from the distinct value counts.
+// If the number of distinct values of a type is unknown, false is returned.
+func estimateGroups(p dataset.DataPath) (uint64, bool) {
+	var groups uint64
+	if p.HasStringCount() {
+		if p.Stringtype.Unique == nil {
+			return 0, false
+		}
+		groups += *p.Stringtype.Unique
+	}
+	if p.HasNumCount() {
+		if p.Floattype == nil || p.Floattype.Unique == nil {
+			return 0, false
+		}
+		groups += *p.Floattype.Unique
+	}
+	if p.HasBoolCount() {
+		groups += 2
+	}
+	return groups, true
+}
+
+// Returns the units the timestamps at the path can be bucketed by.
+// A unit has to be coarser than the granularity of the timestamps and create between 2 and maxGroupByCardinality buckets.
+// Epoch timestamps are only bucketed by hours and days, as months and years can not be computed arithmetically in all systems.
+func dateBucketUnits(p dataset.DataPath) []dataset.Granularity {
+	temporal := p.Temporaltype
+	if temporal == nil || temporal.Min == nil || temporal.Max == nil {
+		return nil
+	}
+	candidates := []dataset.Granularity{dataset.GranularityHour, dataset.GranularityDay, dataset.GranularityMonth, dataset.GranularityYear}
+	if temporal.Format.IsEpoch() {
+		candidates = candidates[:2]
+	}
+	var units []dataset.Granularity
+	for _, unit := range candidates {
+		if !temporal.Granularity.Finer(unit) || unit.Truncate(*temporal.Min).Equal(unit.Truncate(*temporal.Max)) {
+			continue
+		}
+		if temporal.Max.Sub(*temporal.Min)/unit.Duration() < maxGroupByCardinality {
+			units = append(units, unit)
+		}
+	}
+	return units
 }
 
 func (e GroupByAggregationFactory) ID() string {
@@ -164,19 +228,143 @@ func (e GroupByAggregationFactory) ID() string {
 
 // Generates the aggregation
 func (e GroupByAggregationFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Aggregation {
-	return query.GroupedAggregation{
-		Path: p.Path,
-		Agg:  query.CountAggregation{Path: p.Path},
-	}
+	return e.GenerateWithSubAgg(p, blacklist, ranGen, query.CountAggregation{Path: p.Path})
 }
 
+// Generates the aggregation with the given sub-aggregation, grouped by the path
 func (e GroupByAggregationFactory) GenerateWithSubAgg(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand, subAgg query.Aggregation) query.Aggregation {
 	return query.GroupedAggregation{
-		Path: p.Path,
+		Keys: []query.GroupKey{e.generateKey(p, ranGen)},
 		Agg:  subAgg,
 	}
 }
 
+// Adds the path as further grouping key, if the estimated number of groups of all keys stays below maxGroupByCardinality
+// and half the size of the dataset.
+// Returns false if the path can not be added, because it is not applicable, already grouped by or the number of groups is unknown or too large.
+func (e GroupByAggregationFactory) AddKey(group query.GroupedAggregation, ds dataset.DataSet, p dataset.DataPath, ranGen *rand.Rand) (query.GroupedAggregation, bool) {
+	if !e.IsApplicable(p) {
+		return group, false
+	}
+	for _, key := range group.Keys {
+		if key.Path == p.Path {
+			return group, false
+		}
+	}
+	key := e.generateKey(p, ranGen)
+	keyGroups, ok := estimateKeyGroups(p, key)
+	if !ok {
+		return group, false
+	}
+	groups, ok := estimateGroupCount(ds, group)
+	if !ok {
+		return group, false
+	}
+	groups *= keyGroups
+	if groups > maxGroupByCardinality || groups*2 > ds.GetSize() {
+		return group, false
+	}
+	keys := append(append([]query.GroupKey{}, group.Keys...), key)
+	return query.GroupedAggregation{Keys: keys, Agg: group.Agg}, true
+}
+
+// Generates a grouping key of the path.
+// The path is grouped by its values, a random date bucket or bins of its numbers, chosen randomly from the applicable ones.
+func (e GroupByAggregationFactory) generateKey(p dataset.DataPath, ranGen *rand.Rand) query.GroupKey {
+	keys := []query.GroupKey{}
+	if e.isValueApplicable(p) {
+		keys = append(keys, query.GroupKey{Path: p.Path})
+	}
+	if units := dateBucketUnits(p); len(units) > 0 {
+		keys = append(keys, query.GroupKey{Path: p.Path, Bucket: &query.DateBucket{
+			Format: p.Temporaltype.Format,
+			Unit:   units[ranGen.Intn(len(units))],
+		}})
+	}
+	if isBinApplicable(p) {
+		bins := generateBins(p, ranGen)
+		keys = append(keys, query.GroupKey{Path: p.Path, Bins: &bins})
+	}
+	return keys[ranGen.Intn(len(keys))]
+}
+
+// Estimates the number of groups of a grouped aggregation on the dataset, as product of the groups of all keys.
+// If the number of groups of a key is unknown, false is returned.
+func estimateGroupCount(ds dataset.DataSet, group query.GroupedAggregation) (uint64, bool) {
+	groups := uint64(1)
+	for _, key := range group.Keys {
+		keyPath := ds.Paths[key.Path]
+		if keyPath == nil {
+			return 0, false
+		}
+		keyGroups, ok := estimateKeyGroups(*keyPath, key)
+		if !ok {
+			return 0, false
+		}
+		groups *= keyGroups
+	}
+	return groups, true
+}
+
+// Estimates the number of groups of a grouping key of the path
+func estimateKeyGroups(p dataset.DataPath, key query.GroupKey) (uint64, bool) {
+	if key.Bins != nil {
+		return uint64(key.Bins.Count), true
+	}
+	if key.Bucket == nil {
+		return estimateGroups(p)
+	}
+	temporal := p.Temporaltype
+	return uint64(temporal.Max.Sub(*temporal.Min)/key.Bucket.Unit.Duration()) + 1, true
+}
+
+// The bounds of the number of equal-width bins
+const (
+	minNumericBins = 2
+	maxNumericBins = 20
+)
+
+// Checks whether the numbers of the path can be binned.
+// Epoch timestamps are bucketed by dates instead.
+func isBinApplicable(p dataset.DataPath) bool {
+	return p.HasNumCount() && p.Temporaltype == nil && p.Floattype != nil && p.Floattype.Min != nil && p.Floattype.Max != nil && *p.Floattype.Min < *p.Floattype.Max
+}
+
+// Generates bins covering all numbers of the path.
+// The width is either chosen to create a random number of equal-width bins or, if the quartiles are known, by the Freedman-Diaconis rule.
+// It is rounded up to 1, 2 or 5 times a power of ten and the bins are aligned to multiples of the width.
+func generateBins(p dataset.DataPath, ranGen *rand.Rand) query.NumericBins {
+	min, max := *p.Floattype.Min, *p.Floattype.Max
+	width := (max - min) / float64(minNumericBins+ranGen.Intn(maxNumericBins-minNumericBins+1))
+	if p.Floattype.Histogram != nil && p.Floattype.Count != nil && randomBool(ranGen) {
+		iqr := p.Floattype.Histogram.Quantile(0.75) - p.Floattype.Histogram.Quantile(0.25)
+		if iqr > 0 {
+			width = math.Max(2*iqr/math.Cbrt(float64(*p.Floattype.Count)), (max-min)/maxNumericBins)
+		}
+	}
+	width = roundWidth(width)
+	if p.HasIntCount() && p.HasFloatCount() && *p.Inttype.Count == *p.Floattype.Count { // Integers are not split into fractions
+		width = math.Max(width, 1)
+	}
+	start := math.Floor(min/width) * width
+	return query.NumericBins{
+		Min:   start,
+		Width: width,
+		Count: int(math.Floor((max-start)/width)) + 1,
+	}
+}
+
+// Rounds the width up to 1, 2 or 5 times a power of ten
+func roundWidth(width float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(width)))
+	for _, factor := range []float64{1, 2, 5} {
+		if factor*magnitude >= width {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
 func (e GroupByAggregationFactory) Type() reflect.Type {
 	return reflect.TypeOf(query.GroupedAggregation{})
 }
@@ -205,3 +393,138 @@ func (e SumAggregationFactory) Generate(p dataset.DataPath, blacklist *Blacklist
 func (e SumAggregationFactory) Type() reflect.Type {
 	return reflect.TypeOf(query.SumAggregation{})
 }
+
+// Returns the types whose values at the path can be ordered to compute a minimum or maximum.
+// Numbers and strings are used if the path contains them and, if known, not only a single value of the type.
+func orderedTypes(p dataset.DataPath) []query.JSONType {
+	var types []query.JSONType
+	if p.HasNumCount() && !constantNumbers(p) {
+		types = append(types, query.TypeNumber)
+	}
+	if p.HasStringCount() && (p.Stringtype.Min == nil || p.Stringtype.Max == nil || *p.Stringtype.Min != *p.Stringtype.Max) {
+		types = append(types, query.TypeString)
+	}
+	return types
+}
+
+// Checks whether all numbers at the path are known to have the same value
+func constantNumbers(p dataset.DataPath) bool {
+	if p.HasFloatCount() && p.Floattype.Min != nil && p.Floattype.Max != nil {
+		return *p.Floattype.Min == *p.Floattype.Max
+	}
+	if p.HasIntCount() && p.Inttype.Min != nil && p.Inttype.Max != nil {
+		return *p.Inttype.Min == *p.Inttype.Max
+	}
+	return false
+}
+
+//
+// Min
+//
+
+type MinAggregationFactory struct {
+}
+
+// Checks wether the aggregation can be used on the given dataset
+func (e MinAggregationFactory) IsApplicable(p dataset.DataPath) bool {
+	return len(orderedTypes(p)) > 0
+}
+
+func (e MinAggregationFactory) ID() string {
+	return "Min"
+}
+
+// Generates the aggregation over a random type of the ordered types
+func (e MinAggregationFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Aggregation {
+	types := orderedTypes(p)
+	return query.MinAggregation{Path: p.Path, Type: types[ranGen.Intn(len(types))]}
+}
+
+func (e MinAggregationFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.MinAggregation{})
+}
+
+//
+// Max
+//
+
+type MaxAggregationFactory struct {
+}
+
+// Checks wether the aggregation can be used on the given dataset
+func (e MaxAggregationFactory) IsApplicable(p dataset.DataPath) bool {
+	return len(orderedTypes(p)) > 0
+}
+
+func (e MaxAggregationFactory) ID() string {
+	return "Max"
+}
+
+// Generates the aggregation over a random type of the ordered types
+func (e MaxAggregationFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Aggregation {
+	types := orderedTypes(p)
+	return query.MaxAggregation{Path: p.Path, Type: types[ranGen.Intn(len(types))]}
+}
+
+func (e MaxAggregationFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.MaxAggregation{})
+}
+
+//
+// Avg
+//
+
+type AvgAggregationFactory struct {
+}
+
+// Checks wether the aggregation can be used on the given dataset
+func (e AvgAggregationFactory) IsApplicable(p dataset.DataPath) bool {
+	return p.HasNumCount() && !constantNumbers(p)
+}
+
+func (e AvgAggregationFactory) ID() string {
+	return "Avg"
+}
+
+// Generates the aggregation
+func (e AvgAggregationFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Aggregation {
+	return query.AvgAggregation{Path: p.Path}
+}
+
+func (e AvgAggregationFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.AvgAggregation{})
+}
+
+//
+// DistinctCount
+//
+
+type DistinctCountAggregationFactory struct {
+}
+
+// Checks wether the aggregation can be used on the given dataset.
+// Paths with a single distinct value or too many distinct values (e.g. IDs) are not used.
+// If the number of distinct values is unknown, the path is used.
+func (e DistinctCountAggregationFactory) IsApplicable(p dataset.DataPath) bool {
+	if !(p.HasNumCount() || p.HasStringCount() || p.HasBoolCount()) {
+		return false
+	}
+	distinct, ok := estimateGroups(p)
+	if !ok {
+		return true
+	}
+	return distinct > 1 && distinct <= maxGroupByCardinality && (p.Count == nil || distinct*2 <= *p.Count)
+}
+
+func (e DistinctCountAggregationFactory) ID() string {
+	return "DistinctCount"
+}
+
+// Generates the aggregation
+func (e DistinctCountAggregationFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Aggregation {
+	return query.DistinctCountAggregation{Path: p.Path}
+}
+
+func (e DistinctCountAggregationFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.DistinctCountAggregation{})
+}
@@ -1,10 +1,22 @@
 package generator
 
 import (
+	"fmt"
+
 	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
+	wr "github.com/mroth/weightedrand"
 )
 
+// The maximum number of aggregations computed by a single query
+const maxAggregations = 4
+
+// The default maximum number of keys a query is grouped by
+const maxGroupKeys = 3
+
+// The probability to try to add another grouping key
+const additionalGroupKeyProb = 0.3
+
 // Generates a aggregation according to the generator specifications
 func (g *Generator) generateAggregation(dataset dataset.DataSet) (aggregation query.Aggregation) {
 	if g.Aggregations == nil || len(g.Aggregations) == 0 {
@@ -23,6 +35,7 @@ func (g *Generator) generateAggregation(dataset dataset.DataSet) (aggregation qu
 			valid = true
 		}
 	}
+	aggregation = g.addAggregations(dataset, chooser, aggregation)
 
 	// If groupby enabled
 	if g.groupByEnabled() {
@@ -35,7 +48,8 @@ func (g *Generator) generateAggregation(dataset dataset.DataSet) (aggregation qu
 				continue
 			}
 			if groupBy.IsApplicable(*dataPath) {
-				aggregation = groupBy.GenerateWithSubAgg(*dataPath, &g.currentBlacklist, g.randomGenerator, aggregation)
+				group := groupBy.GenerateWithSubAgg(*dataPath, &g.currentBlacklist, g.randomGenerator, aggregation).(query.GroupedAggregation)
+				aggregation = g.addGroupKeys(dataset, chooser, group)
 				return
 			}
 		}
@@ -44,6 +58,59 @@ func (g *Generator) generateAggregation(dataset dataset.DataSet) (aggregation qu
 	return
 }
 
+// Adds further grouping keys of random paths with a fixed probability, as long as the number of groups stays reasonable
+func (g *Generator) addGroupKeys(dataset dataset.DataSet, chooser *wr.Chooser, group query.GroupedAggregation) query.GroupedAggregation {
+	random := g.getRand()
+	groupBy := GroupByAggregationFactory{}
+	for len(group.Keys) < g.MaxGroupKeys && random.Float64() < additionalGroupKeyProb {
+		path := chooser.PickSource(random).(string)
+		dataPath := dataset.Paths[path]
+		if dataPath == nil {
+			continue
+		}
+		group, _ = groupBy.AddKey(group, dataset, *dataPath, g.randomGenerator)
+	}
+	return group
+}
+
+// Adds further aggregations of random paths with the configured probability.
+// All aggregations are computed over the same documents or groups, aggregations with equal names are numbered.
+func (g *Generator) addAggregations(dataset dataset.DataSet, chooser *wr.Chooser, aggregation query.Aggregation) query.Aggregation {
+	random := g.getRand()
+	aggs := []query.NamedAggregation{{Name: aggregation.Name(), Agg: aggregation}}
+	used := map[string]bool{aggregation.String(): true}
+	for len(aggs) < maxAggregations && random.Float64() < g.MultiAggregationProb {
+		path := chooser.PickSource(random).(string)
+		agg := g.generateAggregationForPath(*dataset.Paths[path])
+		if agg == nil || used[agg.String()] {
+			continue
+		}
+		used[agg.String()] = true
+		aggs = append(aggs, query.NamedAggregation{Name: uniqueAggregationName(aggs, agg.Name()), Agg: agg})
+	}
+	if len(aggs) == 1 {
+		return aggregation
+	}
+	return query.MultiAggregation{Aggs: aggs}
+}
+
+// Returns the name, numbered if it is already used by one of the aggregations
+func uniqueAggregationName(aggs []query.NamedAggregation, name string) string {
+	unique := name
+	for i := 2; ; i++ {
+		taken := false
+		for _, agg := range aggs {
+			if agg.Name == unique {
+				taken = true
+			}
+		}
+		if !taken {
+			return unique
+		}
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+}
+
 // Generates a predicate for the given path
 func (g *Generator) generateAggregationForPath(path dataset.DataPath) query.Aggregation {
 	suitableFactories := []AggregationFactory{}
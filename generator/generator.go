@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/JODA-Explore/BETZE/dataset"
-	"github.com/JODA-Explore/BETZE/languages/joda"
 	"github.com/JODA-Explore/BETZE/query"
 )
 
@@ -34,6 +33,20 @@ type Generator struct {
 	Aggregations []AggregationFactory
 	// Probability to perform an aggregation
 	AggregationProb float64
+	// Probability to add another aggregation to an aggregated query
+	MultiAggregationProb float64
+	// Maximum number of keys an aggregation is grouped by
+	MaxGroupKeys int
+	// Probability to unwind an array of an original dataset
+	UnwindProb float64
+	// Probability to join another original dataset with an original dataset
+	JoinProb float64
+	// Probability to project the documents of an unaggregated query
+	ProjectionProb float64
+	// Probability to order and limit the result of a query
+	OrderProb float64
+	// Probability to negate a predicate if this moves its selectivity into the desired range
+	NegationProb float64
 	// # Random jumps
 	randomJumps int64
 	// # Go back
@@ -46,6 +59,8 @@ type Generator struct {
 	Blacklists map[string]*Blacklist
 	//Current Blacklis
 	currentBlacklist Blacklist
+	// Datasets no predicate could be generated on
+	blacklistedDatasets map[string]struct{}
 	//Network
 	network Network
 }
@@ -84,14 +99,17 @@ type Network struct {
 func New(seed int64) Generator {
 	r := rand.New(rand.NewSource(seed))
 	return Generator{
-		randomGenerator:  r,
-		MaxChain:         3,
-		MaxTries:         100,
-		MinSelectivity:   0.1,
-		MaxSelectivity:   0.9,
-		RandomBrowseProb: 0.2,
-		GoBackProb:       0.4,
-		Blacklists:       make(map[string]*Blacklist),
+		randomGenerator:     r,
+		MaxChain:            3,
+		MaxTries:            100,
+		MinSelectivity:      0.1,
+		MaxSelectivity:      0.9,
+		RandomBrowseProb:    0.2,
+		GoBackProb:          0.4,
+		NegationProb:        0.1,
+		MaxGroupKeys:        maxGroupKeys,
+		Blacklists:          make(map[string]*Blacklist),
+		blacklistedDatasets: make(map[string]struct{}),
 		network: Network{
 			Nodes: make(map[string]NetworkNode),
 		},
@@ -122,7 +140,7 @@ func (g *Generator) PrintConfig() string {
 	for _, agg := range g.Aggregations {
 		agg_ids = append(agg_ids, agg.ID())
 	}
-	return fmt.Sprintf("MinSelectivity: %s, MaxSelectivity: %s, MaxChain: %d, MaxTries: %d, RandomBrowseProb: %s, GoBackProb: %s, Weighted-Paths: %t, Predicates: [%s], Aggregations: [%s], AggregationProbability: %s", strconv.FormatFloat(g.MinSelectivity, 'f', -1, 64), strconv.FormatFloat(g.MaxSelectivity, 'f', -1, 64), g.MaxChain, g.MaxTries, strconv.FormatFloat(g.RandomBrowseProb, 'f', -1, 64), strconv.FormatFloat(g.GoBackProb, 'f', -1, 64), g.WeightedPaths, strings.Join(ids, ","), strings.Join(agg_ids, ","), strconv.FormatFloat(g.AggregationProb, 'f', -1, 64))
+	return fmt.Sprintf("MinSelectivity: %s, MaxSelectivity: %s, MaxChain: %d, MaxTries: %d, RandomBrowseProb: %s, GoBackProb: %s, Weighted-Paths: %t, Predicates: [%s], Aggregations: [%s], AggregationProbability: %s, MultiAggregationProbability: %s, UnwindProbability: %s, JoinProbability: %s, ProjectionProbability: %s, OrderProbability: %s, NegationProbability: %s", strconv.FormatFloat(g.MinSelectivity, 'f', -1, 64), strconv.FormatFloat(g.MaxSelectivity, 'f', -1, 64), g.MaxChain, g.MaxTries, strconv.FormatFloat(g.RandomBrowseProb, 'f', -1, 64), strconv.FormatFloat(g.GoBackProb, 'f', -1, 64), g.WeightedPaths, strings.Join(ids, ","), strings.Join(agg_ids, ","), strconv.FormatFloat(g.AggregationProb, 'f', -1, 64), strconv.FormatFloat(g.MultiAggregationProb, 'f', -1, 64), strconv.FormatFloat(g.UnwindProb, 'f', -1, 64), strconv.FormatFloat(g.JoinProb, 'f', -1, 64), strconv.FormatFloat(g.ProjectionProb, 'f', -1, 64), strconv.FormatFloat(g.OrderProb, 'f', -1, 64), strconv.FormatFloat(g.NegationProb, 'f', -1, 64))
 }
 
 // Returns a random number generator initialized with the seed
@@ -130,8 +148,11 @@ func (g *Generator) getRand() *rand.Rand {
 	return g.randomGenerator
 }
 
-// Returns a full benchmark query set
-func (g *Generator) GenerateQuerySet(datasets []dataset.DataSet, num_queries int64) (queries []query.Query) {
+// Returns a full benchmark query set.
+// If a validator is given, each query is tested against the validator backend and the resulting datasets are analyzed.
+// Otherwise the resulting datasets are estimated.
+// If no valid query could be generated in MaxTries consecutive tries, the queries generated so far are returned.
+func (g *Generator) GenerateQuerySet(datasets []dataset.DataSet, num_queries int64, validator Validator) ([]query.Query, error) {
 	for _, v := range datasets {
 		g.network.Nodes[v.Name] = NetworkNode{
 			DSName:    v.Name,
@@ -140,31 +161,53 @@ func (g *Generator) GenerateQuerySet(datasets []dataset.DataSet, num_queries int
 			Timestamp: 0,
 		}
 	}
+	queries := make([]query.Query, 0)
+	tries := 0
 	for len(queries) < int(num_queries) {
+		if tries >= g.MaxTries {
+			log.Printf("Could not generate a valid query in %d tries, stopping after %d of %d queries", tries, len(queries), num_queries)
+			break
+		}
+		tries++
 		var prev_query *query.Query
 		if len(queries) > 0 {
 			prev_query = &queries[len(queries)-1]
 		}
 		dataset_ptr, edge := g.chooseDataset(datasets, prev_query)
-		if dataset_ptr.GetSize() <= 1 {
+		if dataset_ptr == nil {
+			return queries, nil
+		}
+		if _, blacklisted := g.blacklistedDatasets[dataset_ptr.Name]; blacklisted || dataset_ptr.GetSize() <= 1 {
 			continue
 		}
-		if dataset_ptr == nil {
-			return nil
+		dataset := *dataset_ptr
+		q := g.generateQuery(dataset, datasets)
+		if q.FilterPredicate() == nil { // Query was discarded, e.g. because all paths of the dataset are constant
+			g.blacklistedDatasets[dataset.Name] = struct{}{}
+			continue
 		}
+		q.Store(createName(dataset, datasets))
+		// The query is based on the query which created its dataset, which is not the previous query after a jump or backtrack
+		q.BasedOn(findCreatingQuery(queries, dataset.Name))
 
+		new_dataset, err := g.createDataset(q, dataset_ptr, validator)
+		if err != nil {
+			return nil, err
+		}
+		if new_dataset == nil { // Query was discarded
+			continue
+		}
+
+		// Create network
 		g.network.MaxTimestamp++
 		edge.Timestamp = g.network.MaxTimestamp
-		g.network.Edges = append(g.network.Edges, edge) //Jump Edge
-		dataset := *dataset_ptr
-		q := g.generateQuery(dataset)
-		q.Store(createName(dataset, datasets))
-		q.BasedOn(prev_query)
-		new_dataset := q.GenerateDataset()
-		log.Printf("Created dataset %s (with size %d) from dataset %s (with size %d)", new_dataset.Name, new_dataset.GetSize(), new_dataset.DerivedFrom.Name, new_dataset.DerivedFrom.GetSize())
-		datasets = append(datasets, new_dataset)
+		g.network.Edges = append(g.network.Edges, edge) // Jump Edge
+
+		// Add queries/datasets
+		datasets = append(datasets, *new_dataset)
 		queries = append(queries, q)
-		g.Blacklists[q.StoreName()] = &g.currentBlacklist
+		tries = 0
+
 		g.network.MaxTimestamp++
 		g.network.Edges = append(g.network.Edges, NetworkEdge{
 			From:      q.BaseName(),
@@ -173,137 +216,111 @@ func (g *Generator) GenerateQuerySet(datasets []dataset.DataSet, num_queries int
 			JumpType:  3,
 			Timestamp: g.network.MaxTimestamp,
 		}) //Query Edge
+
 		g.network.Nodes[q.StoreName()] = NetworkNode{
 			DSName:    q.StoreName(),
 			Size:      new_dataset.GetSize(),
 			Timestamp: g.network.MaxTimestamp,
 		}
+		g.Blacklists[q.StoreName()] = &g.currentBlacklist
 	}
 	log.Printf("Used %d random jumps, %d backtracks, and %d stays", g.randomJumps, g.goBack, g.stay)
-	return
+	return queries, nil
 }
 
-// Returns a full benchmark query set.
-// Each query is tested against the JODA backend
-func (g *Generator) GenerateQuerySetWithJoda(datasets []dataset.DataSet, num_queries int64, joda_con joda.JodaConnection) ([]query.Query, error) {
-	for _, v := range datasets {
-		g.network.Nodes[v.Name] = NetworkNode{
-			DSName:    v.Name,
-			Original:  true,
-			Size:      v.GetSize(),
-			Timestamp: 0,
+// Returns the query storing the dataset, or nil if it is an original dataset
+func findCreatingQuery(queries []query.Query, name string) *query.Query {
+	for i := range queries {
+		if queries[i].StoreName() == name {
+			return &queries[i]
 		}
 	}
-	queries := make([]query.Query, 0)
-	for len(queries) < int(num_queries) {
-		var prev_query *query.Query
-		if len(queries) > 0 {
-			prev_query = &queries[len(queries)-1]
-		}
-		dataset_ptr, edge := g.chooseDataset(datasets, prev_query)
-		if dataset_ptr.GetSize() <= 1 {
-			continue
-		}
-		if dataset_ptr == nil {
-			return queries, nil
-		}
-		dataset := *dataset_ptr
-		q := g.generateQuery(dataset)
-		q.Store(createName(dataset, datasets))
-		q.BasedOn(prev_query)
-
-		q_wo_agg := q.CopyWithoutAggregation()
-		q_wo_agg = q_wo_agg.MergeQuery()
-
-		q_result, err := joda_con.Query(joda.Joda{}.Translate(q_wo_agg))
-		if err != nil {
-			return nil, err
-		}
-
-		if q_result.Error != "" {
-			return nil, fmt.Errorf("could not query JODA: %s", q_result.Error)
-		}
-
-		new_size := q_result.Size
-		actual_selectivity := float64(new_size) / float64(dataset_ptr.GetSize())
+	return nil
+}
 
-		err = joda_con.RemoveResult(*q_result)
-		if err != nil {
-			return nil, err
-		}
+// Creates the dataset resulting from the query.
+// Without validator, the dataset is estimated.
+// With validator, the query is executed and the result is analyzed.
+// If the actual selectivity is not within the desired range, nil is returned.
+func (g *Generator) createDataset(q query.Query, base *dataset.DataSet, validator Validator) (*dataset.DataSet, error) {
+	if validator == nil {
+		new_dataset := q.GenerateDataset()
+		log.Printf("Created dataset %s (with size %d) from dataset %s (with size %d)", new_dataset.Name, new_dataset.GetSize(), new_dataset.DerivedFrom.Name, new_dataset.DerivedFrom.GetSize())
+		return &new_dataset, nil
+	}
 
-		if new_size == 0 || actual_selectivity < g.MinSelectivity || actual_selectivity > g.MaxSelectivity {
-			log.Printf("Actual selectivity not in expected range, discarding query (selectivity %f, calculated %f, desired range [%f,%f])", actual_selectivity, q.FilterPredicate().Selectivity(dataset), g.MinSelectivity, g.MaxSelectivity)
-			// Clean up source
-			err := joda_con.RemoveSource(q.StoreName())
-			if err != nil {
-				return nil, err
-			}
-			continue
-		}
+	q_wo_agg := q.CopyWithoutAggregation()
+	q_wo_agg = q_wo_agg.MergeQuery()
 
-		// Analyze
-		analyze_time := time.Now()
-		new_dataset, err := joda_con.AnalyzeDataset(q.StoreName())
-		log.Printf("Analyzed dataset %s in %s (%d ns)", q.StoreName(), time.Since(analyze_time), time.Since(analyze_time).Nanoseconds())
+	new_size, err := validator.ResultSize(q_wo_agg)
+	if err != nil {
+		return nil, err
+	}
+	base_size := base.GetSize()
+	if q.UnwindPath() != "" || q.GetJoin() != nil {
+		// The selectivity is relative to the unwound and joined documents
+		input := query.Query{}
+		input.Load(base).Unwind(q.UnwindPath()).Join(q.GetJoin())
+		base_size, err = validator.ResultSize(input)
 		if err != nil {
 			return nil, err
 		}
-		// Set base set
-		new_dataset.DerivedFrom = dataset_ptr
-
-		// Remove source
-		err = joda_con.RemoveSource(q.StoreName())
+		// Only the size of the input is needed
+		err = validator.Cleanup(input)
 		if err != nil {
 			return nil, err
 		}
+	}
+	actual_selectivity := float64(new_size) / float64(base_size)
 
-		log.Printf("Created dataset %s (with size %d) from dataset %s (with size %d). Selectivity: %f", new_dataset.Name, new_dataset.GetSize(), new_dataset.DerivedFrom.Name, new_dataset.DerivedFrom.GetSize(), actual_selectivity)
-
-		// Create network
-		g.network.MaxTimestamp++
-		edge.Timestamp = g.network.MaxTimestamp
-		g.network.Edges = append(g.network.Edges, edge) // Jump Edge
-
-		// Add queries/datasets
-		datasets = append(datasets, new_dataset)
-		queries = append(queries, q)
+	if new_size == 0 || actual_selectivity < g.MinSelectivity || actual_selectivity > g.MaxSelectivity {
+		log.Printf("Actual selectivity not in expected range, discarding query (selectivity %f, calculated %f, desired range [%f,%f])", actual_selectivity, q.FilterPredicate().Selectivity(q.InputDataset()), g.MinSelectivity, g.MaxSelectivity)
+		// Clean up source
+		return nil, validator.Cleanup(q_wo_agg)
+	}
 
-		g.network.MaxTimestamp++
-		g.network.Edges = append(g.network.Edges, NetworkEdge{
-			From:      q.BaseName(),
-			To:        q.StoreName(),
-			Query:     q,
-			JumpType:  3,
-			Timestamp: g.network.MaxTimestamp,
-		}) //Query Edge
+	// Analyze
+	analyze_time := time.Now()
+	new_dataset, err := validator.Analyze(q_wo_agg)
+	log.Printf("Analyzed dataset %s in %s (%d ns)", q.StoreName(), time.Since(analyze_time), time.Since(analyze_time).Nanoseconds())
+	if err != nil {
+		return nil, err
+	}
+	// Set base set
+	new_dataset.DerivedFrom = base
 
-		g.network.Nodes[q.StoreName()] = NetworkNode{
-			DSName:    q.StoreName(),
-			Size:      new_dataset.GetSize(),
-			Timestamp: g.network.MaxTimestamp,
-		}
-		g.Blacklists[q.StoreName()] = &g.currentBlacklist
+	// Remove source
+	err = validator.Cleanup(q_wo_agg)
+	if err != nil {
+		return nil, err
 	}
 
-	return queries, nil
+	log.Printf("Created dataset %s (with size %d) from dataset %s (with size %d). Selectivity: %f", new_dataset.Name, new_dataset.GetSize(), new_dataset.DerivedFrom.Name, new_dataset.DerivedFrom.GetSize(), actual_selectivity)
+	return &new_dataset, nil
 }
 
-// Generates a single query given the dataset
-func (g *Generator) generateQuery(dataset dataset.DataSet) (q query.Query) {
+// Generates a single query given the dataset.
+// The other datasets may be joined with the dataset.
+func (g *Generator) generateQuery(dataset dataset.DataSet, datasets []dataset.DataSet) (q query.Query) {
 	q.Load(&dataset)
 	g.currentBlacklist = *g.getBlacklist(dataset.Name)
-	predicate := g.generatePredicate(dataset)
+	// The remaining query works on the unwound or joined documents
+	g.generateUnwind(dataset, &q)
+	g.generateJoin(dataset, datasets, &q)
+	input := q.InputDataset()
+	predicate := g.generatePredicate(input)
 	if predicate != nil {
 		q.Filter(predicate)
 	} else {
-		log.Println("Could not generate predicate")
+		log.Println("Could not generate predicate, discarding query")
 	}
 
 	if g.randomGenerator.Float64() <= g.AggregationProb {
-		agg := g.generateAggregation(dataset)
+		agg := g.generateAggregation(input)
 		q.Aggregate(agg)
 	}
+	g.generateProjection(input, &q)
+	g.generateOrder(input, &q)
 
 	if q.IsCopy() {
 		log.Println("Error: Could not generate valid query")
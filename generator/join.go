@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The maximum factor by which a join may increase the number of documents
+const maxJoinGrowth = 10.0
+
+// Characters which may not be used in the attribute of the joined document, e.g. dots which are nested fields in MongoDB
+var unsafeAttributeChars = regexp.MustCompile("[^a-zA-Z0-9]")
+
+// Joins another original dataset with the configured probability.
+// Only original datasets are joined and only if no array is unwound, as the datasets are joined before filtering and intermediate sets are already filtered.
+// The join paths are chosen among all path pairs of the same type with overlapping values, which do not increase the number of documents too much.
+func (g *Generator) generateJoin(ds dataset.DataSet, datasets []dataset.DataSet, q *query.Query) {
+	random := g.getRand()
+	if ds.DerivedFrom != nil || q.UnwindPath() != "" || random.Float64() >= g.JoinProb {
+		return
+	}
+
+	paths := joinablePaths(ds)
+	var candidates []query.Join
+	for i := range datasets {
+		foreign := &datasets[i]
+		if foreign.DerivedFrom != nil || foreign.Name == ds.Name {
+			continue
+		}
+		// The joined document is stored in a new top-level attribute, named after the dataset
+		as := "/" + unsafeAttributeChars.ReplaceAllString(foreign.Name, "_")
+		for _, exists := ds.Paths[as]; exists; _, exists = ds.Paths[as] {
+			as += "_joined"
+		}
+		foreign_paths := joinablePaths(*foreign)
+		for _, path := range paths {
+			for _, foreign_path := range foreign_paths {
+				size, ok := query.EstimateJoinSize(*ds.Paths[path], *foreign.Paths[foreign_path])
+				if ok && size > 0 && float64(size) <= maxJoinGrowth*float64(ds.GetSize()) {
+					candidates = append(candidates, query.Join{Dataset: foreign, Path: path, ForeignPath: foreign_path, As: as})
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	join := candidates[random.Intn(len(candidates))]
+	q.Join(&join)
+}
+
+// Returns all paths, which only contain strings or only integers besides null values, ordered by path.
+// Objects and arrays are matched by their members or elements by some systems, so paths containing them are not used.
+func joinablePaths(ds dataset.DataSet) []string {
+	paths := []string{}
+	for path, p := range ds.Paths {
+		if path == "" || p == nil || dataset.IsElementPath(path) || p.HasBoolCount() || hasObjectOrArray(*p) {
+			continue
+		}
+		only_strings := p.HasStringCount() && !p.HasNumCount()
+		only_ints := p.HasIntCount() && !p.HasStringCount() && (!p.HasFloatCount() || *p.Floattype.Count == *p.Inttype.Count)
+		if only_strings || only_ints {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"sort"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The limits a query result can be restricted to
+var resultLimits = []uint64{1, 5, 10, 20, 50, 100}
+
+// The maximum number of keys a query result is ordered by
+const maxSortKeys = 2
+
+// The probability to order by another key
+const additionalSortKeyProb = 0.3
+
+// Orders and limits the result of the query with the configured probability.
+// Documents are ordered by paths, groups by their aggregations. Ungrouped aggregations are not ordered, as they result in a single row.
+// All systems have to return the same results, so ties are broken by a total order every system can express:
+// Documents with equal keys are ordered ascending by the remaining sortable paths, which are added as sort keys.
+// Only documents differing in unsortable paths, like objects and arrays, remain ties without a defined order.
+// Groups with equal keys are ordered ascending by their group, so they are only ordered if all grouping keys have the same sortable type.
+// The limit is chosen smaller than the estimated number of results, if possible.
+func (g *Generator) generateOrder(dataset dataset.DataSet, q *query.Query) {
+	random := g.getRand()
+	if random.Float64() >= g.OrderProb {
+		return
+	}
+
+	var candidates []query.SortKey
+	var results uint64
+	agg := q.Aggregation()
+	if agg == nil {
+		// The documents may be projected, so the paths of the result are ordered
+		result := q.GenerateDataset()
+		candidates = sortablePaths(result)
+		results = result.GetSize()
+	} else if group, isgroup := agg.(query.GroupedAggregation); isgroup {
+		if !isGroupSortable(dataset, group) {
+			return
+		}
+		for _, named := range query.NamedAggregations(group.Agg) {
+			candidates = append(candidates, query.SortKey{Aggregation: named.Name})
+		}
+		groups, ok := estimateGroupCount(dataset, group)
+		if !ok {
+			groups = maxGroupByCardinality
+		}
+		results = groups
+	} else {
+		return
+	}
+
+	var keys []query.SortKey
+	for len(candidates) > 0 && (len(keys) == 0 || (len(keys) < maxSortKeys && random.Float64() < additionalSortKeyProb)) {
+		i := random.Intn(len(candidates))
+		key := candidates[i]
+		key.Descending = randomBool(random)
+		keys = append(keys, key)
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	if agg == nil {
+		keys = append(keys, candidates...)
+	}
+
+	limits := []uint64{}
+	for _, limit := range resultLimits {
+		if limit < results {
+			limits = append(limits, limit)
+		}
+	}
+	var limit uint64
+	if len(limits) > 0 {
+		limit = limits[random.Intn(len(limits))]
+	}
+	q.OrderBy(keys...).Limit(limit)
+}
+
+// Returns sort keys of all paths, which only contain numbers or only strings besides null values, ordered by path.
+// Values of different types are ordered differently by the systems, so paths of mixed types are not used.
+func sortablePaths(ds dataset.DataSet) []query.SortKey {
+	paths := make([]string, 0, len(ds.Paths))
+	for path := range ds.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	keys := []query.SortKey{}
+	for _, path := range paths {
+		if path == "" || dataset.IsElementPath(path) {
+			continue
+		}
+		if t, ok := sortType(*ds.Paths[path]); ok {
+			keys = append(keys, query.SortKey{Path: path, Type: t})
+		}
+	}
+	return keys
+}
+
+// Returns the type of the values at the path, if it only contains numbers or only strings besides null values
+func sortType(p dataset.DataPath) (query.JSONType, bool) {
+	if p.HasBoolCount() || hasObjectOrArray(p) {
+		return query.TypeNull, false
+	}
+	if p.HasNumCount() && !p.HasStringCount() {
+		return query.TypeNumber, true
+	} else if p.HasStringCount() && !p.HasNumCount() {
+		return query.TypeString, true
+	}
+	return query.TypeNull, false
+}
+
+// Checks whether all grouping keys have the same sortable type.
+// Bins are numbers and date buckets strings, other keys are grouped by the values of their path.
+func isGroupSortable(ds dataset.DataSet, group query.GroupedAggregation) bool {
+	types := map[query.JSONType]bool{}
+	for _, key := range group.Keys {
+		if key.Bins != nil {
+			types[query.TypeNumber] = true
+		} else if key.Bucket != nil {
+			types[query.TypeString] = true
+		} else if p, ok := ds.Paths[key.Path]; ok && p != nil {
+			t, ok := sortType(*p)
+			if !ok {
+				return false
+			}
+			types[t] = true
+		} else {
+			return false
+		}
+	}
+	return len(types) == 1
+}
+
+// Checks whether objects or arrays occur at the path
+func hasObjectOrArray(p dataset.DataPath) bool {
+	return (p.Objecttype != nil && p.Objecttype.Count != nil && *p.Objecttype.Count > 0) || (p.Arraytype != nil && p.Arraytype.Count != nil && *p.Arraytype.Count > 0)
+}
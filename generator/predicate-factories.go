@@ -5,11 +5,14 @@ import (
 	"math"
 	"math/rand"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
+	"github.com/adam-lavrik/go-imath/i64"
 	"github.com/adam-lavrik/go-imath/ix"
 )
 
@@ -25,13 +28,21 @@ type PredicateFactory interface {
 	Type() reflect.Type
 }
 
+// A SelectivityPredicateFactory is a PredicateFactory that can target a desired selectivity window.
+// The generator prefers GenerateWithSelectivity over Generate if a factory implements it.
+type SelectivityPredicateFactory interface {
+	PredicateFactory
+	// Generates a predicate selecting between min and max (0-1) of the documents of the dataset, if possible
+	GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate
+}
+
 type PredicateFactoryRepo struct {
 	allfactories    []PredicateFactory
 	chosenfactories []PredicateFactory
 }
 
 func GetPredicateFactoryRepo() PredicateFactoryRepo {
-	defaultFactories := []PredicateFactory{ExistsPredicateFactory{}, BoolEqualityPredicateFactory{}, IsStringPredicateFactory{}, IntEqualityPredicateFactory{}, FloatComparisonPredicateFactory{}, StrPrefixPredicateFactory{}, ObjectSizePredicateFactory{}, ArraySizePredicateFactory{}}
+	defaultFactories := []PredicateFactory{ExistsPredicateFactory{}, BoolEqualityPredicateFactory{}, TypeCheckPredicateFactory{}, IntEqualityPredicateFactory{}, FloatComparisonPredicateFactory{}, RangePredicateFactory{}, TemporalPredicateFactory{}, StrEqualityPredicateFactory{}, InPredicateFactory{}, StrPrefixPredicateFactory{}, StrContainsPredicateFactory{}, StrRegexPredicateFactory{}, StrLengthPredicateFactory{}, PathComparisonPredicateFactory{}, PathStrEqualityPredicateFactory{}, ObjectSizePredicateFactory{}, ArraySizePredicateFactory{}, AnyElementPredicateFactory{}}
 	return PredicateFactoryRepo{
 		allfactories: defaultFactories,
 	}
@@ -125,27 +136,40 @@ func (e ExistsPredicateFactory) Type() reflect.Type {
 }
 
 //
-// IsString
+// TypeCheck
 //
-type IsStringPredicateFactory struct {
+type TypeCheckPredicateFactory struct {
 }
 
-// Checks wether the predicate can be used on the given dataset
-func (e IsStringPredicateFactory) IsApplicable(p dataset.DataPath) bool {
-	return true
+// Checks wether the predicate can be used on the given dataset.
+// The root path is not checked, as it always contains objects.
+func (e TypeCheckPredicateFactory) IsApplicable(p dataset.DataPath) bool {
+	return p.Path != "" && len(existingTypes(p)) > 0
 }
 
-func (e IsStringPredicateFactory) ID() string {
-	return "IsString"
+func (e TypeCheckPredicateFactory) ID() string {
+	return "TypeCheck"
 }
 
-// Generates the predicate
-func (e IsStringPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
-	return query.IsStringPredicate{Path: p.Path}
+// Generates the predicate for one of the types existing at the path
+func (e TypeCheckPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	types := existingTypes(p)
+	return query.TypeCheckPredicate{Path: p.Path, Type: types[ranGen.Intn(len(types))]}
 }
 
-func (e IsStringPredicateFactory) Type() reflect.Type {
-	return reflect.TypeOf(query.IsStringPredicate{})
+func (e TypeCheckPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.TypeCheckPredicate{})
+}
+
+// Returns all types with a known, positive count at the path
+func existingTypes(p dataset.DataPath) []query.JSONType {
+	var types []query.JSONType
+	for _, t := range query.AllJSONTypes() {
+		if count, ok := t.Count(p); ok && count != nil && *count > 0 {
+			types = append(types, t)
+		}
+	}
+	return types
 }
 
 //
@@ -171,11 +195,19 @@ func (e IntEqualityPredicateFactory) Type() reflect.Type {
 	return reflect.TypeOf(query.IntEqualityPredicate{})
 }
 
-// Generates the predicate
+// Generates the predicate.
+// If a histogram exists, the number is drawn from the distribution of the path, otherwise uniformly between min and max.
 func (e IntEqualityPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	var number int64
+	if p.Inttype.Histogram != nil {
+		number = int64(math.Round(p.Inttype.Histogram.Quantile(ranGen.Float64())))
+		number = i64.Max(*p.Inttype.Min, i64.Min(*p.Inttype.Max, number))
+	} else {
+		number = ranGen.Int63n(*p.Inttype.Max-*p.Inttype.Min) + *p.Inttype.Min
+	}
 	predicate := query.IntEqualityPredicate{
 		Path:   p.Path,
-		Number: ranGen.Int63n(*p.Inttype.Max-*p.Inttype.Min) + *p.Inttype.Min,
+		Number: number,
 	}
 	return predicate
 }
@@ -202,9 +234,15 @@ func (e FloatComparisonPredicateFactory) Type() reflect.Type {
 	return reflect.TypeOf(query.FloatComparisonPredicate{})
 }
 
-// Generates the predicate
+// Generates the predicate.
+// If a histogram exists, the number is drawn from the distribution of the path, otherwise uniformly between min and max.
 func (e FloatComparisonPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
-	elt := ((*p.Floattype.Max - *p.Floattype.Min) * ranGen.Float64()) + *p.Floattype.Min
+	var elt float64
+	if p.Floattype.Histogram != nil {
+		elt = p.Floattype.Histogram.Quantile(ranGen.Float64())
+	} else {
+		elt = ((*p.Floattype.Max - *p.Floattype.Min) * ranGen.Float64()) + *p.Floattype.Min
+	}
 	smaller := randomBool(ranGen)
 	predicate := query.FloatComparisonPredicate{
 		Path:    p.Path,
@@ -215,6 +253,70 @@ func (e FloatComparisonPredicateFactory) Generate(p dataset.DataPath, blacklist
 	return predicate
 }
 
+//
+// Range
+//
+type RangePredicateFactory struct {
+}
+
+func (factory RangePredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	return FloatComparisonPredicateFactory{}.IsApplicable(path)
+}
+
+func (e RangePredicateFactory) ID() string {
+	return "Range"
+}
+
+func (e RangePredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.RangePredicate{})
+}
+
+// Generates the predicate with a random range
+func (e RangePredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	return e.generateRange(p, ranGen.Float64(), ranGen)
+}
+
+// Generates the predicate.
+// The desired selectivity is chosen from the window and converted to the fraction of numbers the range has to cover.
+func (e RangePredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	desired_selectivity := min + (max-min)*ranGen.Float64()
+	// Only documents containing a number at the path can be selected
+	if p.HasFloatCount() && d.GetSize() > 0 {
+		desired_selectivity = desired_selectivity * float64(d.GetSize()) / float64(*p.Floattype.Count)
+	}
+	return e.generateRange(p, math.Min(desired_selectivity, 1.0), ranGen)
+}
+
+// Generates a range containing about the given fraction of numbers at the path
+func (e RangePredicateFactory) generateRange(p dataset.DataPath, fraction float64, ranGen *rand.Rand) query.Predicate {
+	start := (1.0 - fraction) * ranGen.Float64()
+	var lower, upper float64
+	if p.Floattype.Histogram != nil {
+		lower = p.Floattype.Histogram.Quantile(start)
+		upper = p.Floattype.Histogram.Quantile(start + fraction)
+	} else {
+		lower = ((*p.Floattype.Max - *p.Floattype.Min) * start) + *p.Floattype.Min
+		upper = ((*p.Floattype.Max - *p.Floattype.Min) * (start + fraction)) + *p.Floattype.Min
+	}
+	// Paths with integers only get integer bounds
+	if p.HasIntCount() && p.HasFloatCount() && *p.Inttype.Count == *p.Floattype.Count {
+		lower = math.Floor(lower)
+		upper = math.Ceil(upper)
+	}
+	predicate := query.RangePredicate{
+		Path:           p.Path,
+		Lower:          lower,
+		Upper:          upper,
+		LowerInclusive: randomBool(ranGen),
+		UpperInclusive: randomBool(ranGen),
+	}
+	if lower == upper {
+		predicate.LowerInclusive = true
+		predicate.UpperInclusive = true
+	}
+	return predicate
+}
+
 //
 // String Equality
 //
@@ -223,6 +325,9 @@ type StrEqualityPredicateFactory struct {
 }
 
 func (factory StrEqualityPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	if path.Stringtype != nil && path.Count != nil && *path.Count > 0 && len(path.Stringtype.MostCommon) > 0 {
+		return true
+	}
 	return false
 }
 
@@ -234,9 +339,104 @@ func (e StrEqualityPredicateFactory) Type() reflect.Type {
 	return reflect.TypeOf(query.StrEqualityPredicate{})
 }
 
-// Generates the predicate
+// Generates the predicate by choosing one of the most common values of the path
 func (e StrEqualityPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
-	return nil
+	most_common := p.Stringtype.MostCommon
+	predicate := query.StrEqualityPredicate{
+		Path: p.Path,
+		Str:  most_common[ranGen.Intn(len(most_common))].Value,
+	}
+	return predicate
+}
+
+//
+// In
+//
+type InPredicateFactory struct {
+}
+
+// The maximum number of values of a generated IN predicate
+const maxInValues = 5
+
+// Checks wether the predicate can be used on the given dataset.
+// At least two most common strings or integers are required.
+func (factory InPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	if path.Count == nil || *path.Count == 0 {
+		return false
+	}
+	return (path.Stringtype != nil && len(path.Stringtype.MostCommon) > 1) || (path.Inttype != nil && len(path.Inttype.MostCommon) > 1)
+}
+
+func (e InPredicateFactory) ID() string {
+	return "In"
+}
+
+func (e InPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.InPredicate{})
+}
+
+// Generates the predicate by choosing between two and maxInValues random values from the most common values of the path
+func (e InPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	predicate := e.emptyPredicate(p, ranGen)
+	values := e.valueCount(p, predicate)
+	num_values := 2 + ranGen.Intn(ix.Min(values, maxInValues)-1)
+	for _, i := range ranGen.Perm(values)[:num_values] {
+		predicate = e.addValue(p, predicate, i)
+	}
+	return predicate
+}
+
+// Generates the predicate by adding random most common values of the path until the selectivity reaches a random target within the window.
+// Values exceeding the maximum selectivity are skipped.
+func (e InPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	desired_selectivity := min + (max-min)*ranGen.Float64()
+	predicate := e.emptyPredicate(p, ranGen)
+	values := e.valueCount(p, predicate)
+	num_values := 0
+	for _, i := range ranGen.Perm(values) {
+		candidate := e.addValue(p, predicate, i)
+		selectivity := candidate.Selectivity(d)
+		if selectivity > max && num_values >= 2 {
+			continue
+		}
+		predicate = candidate
+		num_values++
+		if num_values >= maxInValues || (num_values >= 2 && selectivity >= desired_selectivity) {
+			break
+		}
+	}
+	return predicate
+}
+
+// Returns a predicate without values, randomly choosing between strings and integers if both are available
+func (e InPredicateFactory) emptyPredicate(p dataset.DataPath, ranGen *rand.Rand) query.InPredicate {
+	predicate := query.InPredicate{Path: p.Path}
+	has_strings := p.Stringtype != nil && len(p.Stringtype.MostCommon) > 1
+	has_ints := p.Inttype != nil && len(p.Inttype.MostCommon) > 1
+	if has_strings && (!has_ints || randomBool(ranGen)) {
+		predicate.Strings = []string{}
+	} else {
+		predicate.Numbers = []int64{}
+	}
+	return predicate
+}
+
+// Returns the number of most common values matching the value type of the predicate
+func (e InPredicateFactory) valueCount(p dataset.DataPath, predicate query.InPredicate) int {
+	if predicate.Strings != nil {
+		return len(p.Stringtype.MostCommon)
+	}
+	return len(p.Inttype.MostCommon)
+}
+
+// Returns a copy of the predicate with the i-th most common value added
+func (e InPredicateFactory) addValue(p dataset.DataPath, predicate query.InPredicate, i int) query.InPredicate {
+	if predicate.Strings != nil {
+		predicate.Strings = append(append([]string{}, predicate.Strings...), p.Stringtype.MostCommon[i].Value)
+	} else {
+		predicate.Numbers = append(append([]int64{}, predicate.Numbers...), p.Inttype.MostCommon[i].Value)
+	}
+	return predicate
 }
 
 //
@@ -344,6 +544,99 @@ OUTER:
 	return pred
 }
 
+//
+// String Contains
+//
+type StrContainsPredicateFactory struct {
+}
+
+func (factory StrContainsPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	if path.Stringtype != nil && path.Count != nil && *path.Count > 0 && len(path.Stringtype.NGrams) > 0 {
+		return true
+	}
+	return false
+}
+
+func (e StrContainsPredicateFactory) ID() string {
+	return "StrContains"
+}
+
+func (e StrContainsPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.StrContainsPredicate{})
+}
+
+// Generates the predicate by choosing one of the most common n-grams of the path
+func (e StrContainsPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	ngrams := p.Stringtype.NGrams
+	return query.StrContainsPredicate{
+		Path:      p.Path,
+		Substring: ngrams[ranGen.Intn(len(ngrams))].Value,
+	}
+}
+
+// Generates the predicate by choosing an n-gram whose selectivity lies within the window.
+// If there is no such n-gram, the one closest to a random selectivity within the window is chosen.
+func (e StrContainsPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	desired_selectivity := min + (max-min)*ranGen.Float64()
+	var candidates []string
+	closest := ""
+	closest_distance := math.Inf(1)
+	for _, ngram := range p.Stringtype.NGrams {
+		selectivity := query.StrContainsPredicate{Path: p.Path, Substring: ngram.Value}.Selectivity(d)
+		if selectivity >= min && selectivity <= max {
+			candidates = append(candidates, ngram.Value)
+		}
+		if distance := math.Abs(selectivity - desired_selectivity); distance < closest_distance {
+			closest = ngram.Value
+			closest_distance = distance
+		}
+	}
+	if len(candidates) > 0 {
+		closest = candidates[ranGen.Intn(len(candidates))]
+	}
+	return query.StrContainsPredicate{
+		Path:      p.Path,
+		Substring: closest,
+	}
+}
+
+//
+// String Regex
+//
+type StrRegexPredicateFactory struct {
+}
+
+func (factory StrRegexPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	return StrContainsPredicateFactory{}.IsApplicable(path)
+}
+
+func (e StrRegexPredicateFactory) ID() string {
+	return "StrRegex"
+}
+
+func (e StrRegexPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.StrRegexPredicate{})
+}
+
+// Generates the predicate from an optional prefix followed by one or two of the most common n-grams of the path
+func (e StrRegexPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	path_type := p.Stringtype
+	predicate := query.StrRegexPredicate{
+		Path: p.Path,
+	}
+	if len(path_type.Prefixes) > 0 && randomBool(ranGen) {
+		prefix := path_type.Prefixes[ranGen.Intn(len(path_type.Prefixes))]
+		if utf8.ValidString(prefix) {
+			predicate.Prefix = prefix
+		}
+	}
+	num_infixes := ix.Min(1+ranGen.Intn(2), len(path_type.NGrams))
+	for _, i := range ranGen.Perm(len(path_type.NGrams))[:num_infixes] {
+		predicate.Infixes = append(predicate.Infixes, path_type.NGrams[i].Value)
+	}
+	return predicate
+}
+
 //
 // Bool Equality
 //
@@ -446,3 +739,367 @@ func (e ArraySizePredicateFactory) Generate(p dataset.DataPath, blacklist *Black
 	}
 	return predicate
 }
+
+//
+// String Length
+//
+type StrLengthPredicateFactory struct {
+}
+
+func (factory StrLengthPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	if path.Stringtype != nil && path.Count != nil && *path.Count > 0 && (path.Stringtype.MinLength != nil && path.Stringtype.MaxLength != nil && *path.Stringtype.MaxLength != *path.Stringtype.MinLength) {
+		return true
+	}
+
+	return false
+}
+
+func (e StrLengthPredicateFactory) ID() string {
+	return "StrLength"
+}
+
+func (e StrLengthPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.StrLengthComparisonPredicate{})
+}
+
+// Generates the predicate with a random length between the minimum and maximum length
+func (e StrLengthPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	min_length, max_length := *p.Stringtype.MinLength, *p.Stringtype.MaxLength
+	predicate := query.StrLengthComparisonPredicate{
+		Path:    p.Path,
+		Number:  min_length + uint64(ranGen.Int63n(int64(max_length-min_length)+1)),
+		Smaller: randomBool(ranGen),
+		Equal:   true,
+	}
+	return predicate
+}
+
+// Generates the predicate with the length at which a random selectivity within the window is reached
+func (e StrLengthPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	str_type := p.Stringtype
+	type_selectivity := query.TypeCheckPredicate{Path: p.Path, Type: query.TypeString}.Selectivity(d)
+	if type_selectivity <= 0 {
+		return e.Generate(p, blacklist, ranGen)
+	}
+	desired_fraction := math.Min((min+(max-min)*ranGen.Float64())/type_selectivity, 1.0)
+	smaller := randomBool(ranGen)
+	if !smaller {
+		desired_fraction = 1.0 - desired_fraction
+	}
+	quantile, _ := str_type.LengthQuantile(desired_fraction)
+	// Length n covers (n-0.5, n+0.5], "<= n" selects all values below n+0.5 and ">= n" all values above n-0.5
+	length := math.Round(quantile - 0.5)
+	if !smaller {
+		length = math.Round(quantile + 0.5)
+	}
+	length = math.Max(math.Min(length, float64(*str_type.MaxLength)), float64(*str_type.MinLength))
+	return query.StrLengthComparisonPredicate{
+		Path:    p.Path,
+		Number:  uint64(length),
+		Smaller: smaller,
+		Equal:   true,
+	}
+}
+
+//
+// Temporal
+//
+type TemporalPredicateFactory struct {
+}
+
+func (factory TemporalPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	temporal := path.Temporaltype
+	if !dataset.IsElementPath(path.Path) && temporal != nil && temporal.Count != nil && *temporal.Count > 0 && temporal.Min != nil && temporal.Max != nil && temporal.Min.Before(*temporal.Max) {
+		return true
+	}
+
+	return false
+}
+
+func (e TemporalPredicateFactory) ID() string {
+	return "Temporal"
+}
+
+func (e TemporalPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.TemporalPredicate{})
+}
+
+// Generates the predicate with a random time range
+func (e TemporalPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	return e.generateRange(p, ranGen.Float64(), ranGen)
+}
+
+// Generates the predicate.
+// The desired selectivity is chosen from the window and converted to the fraction of timestamps the range has to cover.
+func (e TemporalPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	desired_selectivity := min + (max-min)*ranGen.Float64()
+	type_selectivity := query.TemporalPredicate{Path: p.Path, Format: p.Temporaltype.Format}.Selectivity(d)
+	if type_selectivity > 0 {
+		desired_selectivity = desired_selectivity / type_selectivity
+	}
+	return e.generateRange(p, math.Min(desired_selectivity, 1.0), ranGen)
+}
+
+// Generates a time range containing about the given fraction of timestamps at the path.
+// The range either ends at an instant ("before"), covers the last days up to the latest timestamp ("last N days") or lies in between ("between").
+// The bounds are truncated to the granularity of the timestamps.
+func (e TemporalPredicateFactory) generateRange(p dataset.DataPath, fraction float64, ranGen *rand.Rand) query.Predicate {
+	temporal := p.Temporaltype
+	granularity := temporal.Granularity
+	if granularity.Finer(dataset.GranularitySecond) {
+		granularity = dataset.GranularitySecond
+	}
+	predicate := query.TemporalPredicate{
+		Path:   p.Path,
+		Format: temporal.Format,
+	}
+	switch ranGen.Intn(3) {
+	case 0: // Before
+		to, _ := p.TemporalQuantile(fraction)
+		to = granularity.Truncate(to)
+		predicate.To = &to
+	case 1: // Last N days
+		from, _ := p.TemporalQuantile(1.0 - fraction)
+		day := dataset.GranularityDay
+		if temporal.Max.Sub(*temporal.Min) >= 2*day.Duration() {
+			end := day.Truncate(*temporal.Max).Add(day.Duration())
+			days := math.Max(math.Round(float64(end.Sub(from))/float64(day.Duration())), 1.0)
+			from = end.Add(-time.Duration(days) * day.Duration())
+		} else {
+			from = granularity.Truncate(from)
+		}
+		predicate.From = &from
+	default: // Between
+		start := (1.0 - fraction) * ranGen.Float64()
+		from, _ := p.TemporalQuantile(start)
+		to, _ := p.TemporalQuantile(start + fraction)
+		from = granularity.Truncate(from)
+		to = granularity.Truncate(to)
+		if !to.After(from) {
+			to = from.Add(granularity.Duration())
+		}
+		predicate.From = &from
+		predicate.To = &to
+	}
+	return predicate
+}
+
+//
+// Path Comparison
+//
+type PathComparisonPredicateFactory struct {
+}
+
+func (factory PathComparisonPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	return !dataset.IsElementPath(path.Path) && FloatComparisonPredicateFactory{}.IsApplicable(path)
+}
+
+func (e PathComparisonPredicateFactory) ID() string {
+	return "PathComparison"
+}
+
+func (e PathComparisonPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.PathComparisonPredicate{})
+}
+
+// The second path is chosen from the dataset, so the predicate can only be generated with GenerateWithSelectivity
+func (e PathComparisonPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	return nil
+}
+
+// Generates the predicate by comparing the path with another number path with an overlapping value range.
+// Both comparison directions are tried, the predicate with the selectivity closest to the window is chosen.
+func (e PathComparisonPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	partners := comparablePaths(p, d, func(partner dataset.DataPath) bool {
+		return e.IsApplicable(partner) && p.Floattype.Overlaps(partner.Floattype)
+	}, ranGen)
+	var candidates []query.Predicate
+	for _, partner := range partners {
+		smaller := randomBool(ranGen)
+		equal := randomBool(ranGen)
+		candidates = append(candidates,
+			query.PathComparisonPredicate{Lhs: p.Path, Rhs: partner.Path, Smaller: smaller, Equal: equal},
+			query.PathComparisonPredicate{Lhs: p.Path, Rhs: partner.Path, Smaller: !smaller, Equal: equal},
+		)
+	}
+	return closestPredicate(candidates, d, min, max)
+}
+
+//
+// Path String Equality
+//
+type PathStrEqualityPredicateFactory struct {
+}
+
+func (factory PathStrEqualityPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	if !dataset.IsElementPath(path.Path) && path.Stringtype != nil && path.Count != nil && *path.Count > 0 && (len(path.Stringtype.MostCommon) > 0 || path.Stringtype.Unique != nil) {
+		return true
+	}
+
+	return false
+}
+
+func (e PathStrEqualityPredicateFactory) ID() string {
+	return "PathStrEquality"
+}
+
+func (e PathStrEqualityPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.PathStrEqualityPredicate{})
+}
+
+// The second path is chosen from the dataset, so the predicate can only be generated with GenerateWithSelectivity
+func (e PathStrEqualityPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	return nil
+}
+
+// Generates the predicate by comparing the path with another string path with an overlapping value range.
+// The predicate with the selectivity closest to the window is chosen.
+func (e PathStrEqualityPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	partners := comparablePaths(p, d, func(partner dataset.DataPath) bool {
+		return e.IsApplicable(partner) && p.Stringtype.Overlaps(partner.Stringtype)
+	}, ranGen)
+	var candidates []query.Predicate
+	for _, partner := range partners {
+		candidates = append(candidates, query.PathStrEqualityPredicate{Lhs: p.Path, Rhs: partner.Path})
+	}
+	return closestPredicate(candidates, d, min, max)
+}
+
+// Returns the shuffled paths of the dataset, other than p, that can be compared with p
+func comparablePaths(p dataset.DataPath, d dataset.DataSet, comparable func(partner dataset.DataPath) bool, ranGen *rand.Rand) []dataset.DataPath {
+	var keys []string
+	for key, partner := range d.Paths {
+		if key != p.Path && partner != nil && comparable(*partner) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	ranGen.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	partners := make([]dataset.DataPath, len(keys))
+	for i, key := range keys {
+		partners[i] = *d.Paths[key]
+	}
+	return partners
+}
+
+// Returns the first predicate with a selectivity within the window, or the predicate closest to the window.
+// Predicates selecting no or all documents are never chosen, nil is returned if no predicate remains.
+func closestPredicate(candidates []query.Predicate, d dataset.DataSet, min float64, max float64) query.Predicate {
+	var closest query.Predicate
+	closest_distance := math.Inf(1)
+	for _, predicate := range candidates {
+		selectivity := predicate.Selectivity(d)
+		if selectivity <= 0.0 || selectivity >= 1.0 {
+			continue
+		}
+		distance := math.Max(min-selectivity, selectivity-max)
+		if distance <= 0 {
+			return predicate
+		}
+		if distance < closest_distance {
+			closest = predicate
+			closest_distance = distance
+		}
+	}
+	return closest
+}
+
+//
+// Any Element
+//
+type AnyElementPredicateFactory struct {
+}
+
+// The factories used to generate the predicate on the array elements
+var elementPredicateFactories = []PredicateFactory{BoolEqualityPredicateFactory{}, IntEqualityPredicateFactory{}, FloatComparisonPredicateFactory{}, RangePredicateFactory{}, StrEqualityPredicateFactory{}, StrPrefixPredicateFactory{}, StrContainsPredicateFactory{}, StrRegexPredicateFactory{}}
+
+// Checks wether the predicate can be used on the given dataset.
+// The existence of element statistics is checked during the generation, as they are stored at separate paths.
+// Only the FILE dataset provider collects element statistics.
+func (factory AnyElementPredicateFactory) IsApplicable(path dataset.DataPath) bool {
+	if !dataset.IsElementPath(path.Path) && path.Arraytype != nil && path.Arraytype.Count != nil && *path.Arraytype.Count > 0 && path.Arraytype.MaxSize != nil && *path.Arraytype.MaxSize != 0 {
+		return true
+	}
+
+	return false
+}
+
+func (e AnyElementPredicateFactory) ID() string {
+	return "AnyElement"
+}
+
+func (e AnyElementPredicateFactory) Type() reflect.Type {
+	return reflect.TypeOf(query.AnyElementPredicate{})
+}
+
+// Element statistics are not part of the array path, so the predicate can only be generated with GenerateWithSelectivity
+func (e AnyElementPredicateFactory) Generate(p dataset.DataPath, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	return nil
+}
+
+// Generates the predicate on a random element path of the array.
+// The selectivity window of the element predicate is derived from the desired window of the documents.
+func (e AnyElementPredicateFactory) GenerateWithSelectivity(p dataset.DataPath, d dataset.DataSet, min float64, max float64, blacklist *Blacklist, ranGen *rand.Rand) query.Predicate {
+	elements, ok := d.ElementDataSet(p.Path)
+	if !ok {
+		return nil
+	}
+	element_root := dataset.ElementPath(p.Path)
+	var element_paths []string
+	for path := range elements.Paths {
+		// Nested arrays are not supported
+		if !dataset.IsElementPath(strings.TrimPrefix(path, element_root)) {
+			element_paths = append(element_paths, path)
+		}
+	}
+	sort.Strings(element_paths)
+	ranGen.Shuffle(len(element_paths), func(i, j int) {
+		element_paths[i], element_paths[j] = element_paths[j], element_paths[i]
+	})
+
+	type_selectivity := query.TypeCheckPredicate{Path: p.Path, Type: query.TypeArray}.Selectivity(d)
+	length := float64(elements.GetSize()) / float64(*p.Arraytype.Count)
+	element_min := elementSelectivity(min, type_selectivity, length)
+	element_max := elementSelectivity(max, type_selectivity, length)
+
+	for _, path := range element_paths {
+		element_path := *elements.Paths[path]
+		var factories []PredicateFactory
+		for _, factory := range elementPredicateFactories {
+			if factory.IsApplicable(element_path) {
+				factories = append(factories, factory)
+			}
+		}
+		if len(factories) == 0 {
+			continue
+		}
+		var predicate query.Predicate
+		factory := factories[ranGen.Intn(len(factories))]
+		if selectivity_factory, ok := factory.(SelectivityPredicateFactory); ok {
+			predicate = selectivity_factory.GenerateWithSelectivity(element_path, elements, element_min, element_max, blacklist, ranGen)
+		} else {
+			predicate = factory.Generate(element_path, blacklist, ranGen)
+		}
+		// Combined predicates can not be expressed on scalar elements in all systems
+		switch predicate.(type) {
+		case nil, query.AndPredicate, query.OrPredicate, query.NotPredicate:
+			continue
+		}
+		return query.AnyElementPredicate{
+			Path:      p.Path,
+			Predicate: predicate,
+		}
+	}
+	return nil
+}
+
+// Returns the selectivity an element predicate requires for the array predicate to reach the given selectivity.
+// Inverts the estimation of AnyElementPredicate.Selectivity.
+func elementSelectivity(selectivity float64, type_selectivity float64, length float64) float64 {
+	if type_selectivity <= 0 || length <= 0 {
+		return selectivity
+	}
+	return 1.0 - math.Pow(1.0-math.Min(selectivity/type_selectivity, 1.0), 1.0/length)
+}
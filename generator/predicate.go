@@ -13,12 +13,14 @@ import (
 	"github.com/JODA-Explore/BETZE/query"
 )
 
-func (g *Generator) collectPaths(dataset dataset.DataSet) []string {
-	i := 0
-	keys := make([]string, len(dataset.Paths))
-	for k := range dataset.Paths {
-		keys[i] = k
-		i++
+// Returns the shuffled paths of the dataset.
+// Array element paths are skipped, as they are only used through AnyElement predicates.
+func (g *Generator) collectPaths(ds dataset.DataSet) []string {
+	keys := make([]string, 0, len(ds.Paths))
+	for k := range ds.Paths {
+		if !dataset.IsElementPath(k) {
+			keys = append(keys, k)
+		}
 	}
 	sort.Strings(keys)
 	g.randomGenerator.Shuffle(len(keys), func(i, j int) {
@@ -35,6 +37,8 @@ func collectPredStrings(pred_strs map[string]bool, predicate query.Predicate) er
 	case query.OrPredicate:
 		collectPredStrings(pred_strs, v.Lhs)
 		collectPredStrings(pred_strs, v.Rhs)
+	case query.NotPredicate:
+		collectPredStrings(pred_strs, v.Predicate)
 	default:
 		str := predicate.String()
 		if _, ok := pred_strs[str]; ok {
@@ -141,21 +145,35 @@ func (g *Generator) generatePredicate(dataset dataset.DataSet) (predicate query.
 			}
 		}
 		selectivity = predicate.Selectivity(dataset)
+
+		// Negate the predicate if this moves the selectivity into the desired range
+		if (selectivity < g.MinSelectivity || selectivity > g.MaxSelectivity) && g.randomGenerator.Float64() < g.NegationProb {
+			negated := query.NotPredicate{Predicate: predicate}
+			negated_sel := negated.Selectivity(dataset)
+			if negated_sel >= g.MinSelectivity && negated_sel <= g.MaxSelectivity {
+				predicate = negated
+				selectivity = negated_sel
+			}
+		}
 	}
 	return
 }
 
-// Generates a weightes random predicate
+// Generates a weightes random predicate.
+// Returns nil if no predicate with a selectivity between 0 and 1 is found within the maximum tries, e.g. if all paths are constant.
 func (g *Generator) generateWeightedRandomPredicate(dataset dataset.DataSet) query.Predicate {
 	random := g.getRand()
 	chooser := g.getWeightedPathChooser(dataset)
+	if chooser == nil { // No paths to choose from
+		return nil
+	}
 
 	var predicate query.Predicate
 	valid := false
-	for !valid {
+	for tries := 0; !valid && tries < g.MaxTries; tries++ {
 		path := chooser.PickSource(random).(string)
 		dataPath := dataset.Paths[path]
-		predicate = g.generatePredicateForPath(*dataPath)
+		predicate = g.generatePredicateForPath(dataset, *dataPath)
 		if predicate != nil { // Check if predicate is set
 			valid = true
 		}
@@ -166,21 +184,28 @@ func (g *Generator) generateWeightedRandomPredicate(dataset dataset.DataSet) que
 			}
 		}
 	}
+	if !valid {
+		return nil
+	}
 
 	return predicate
 }
 
-// Generates a truly random predicate
+// Generates a truly random predicate.
+// Returns nil if no predicate with a selectivity between 0 and 1 is found within the maximum tries, e.g. if all paths are constant.
 func (g *Generator) generateRandomPredicate(dataset dataset.DataSet) query.Predicate {
 	random := g.getRand()
 	paths := g.collectPaths(dataset)
+	if len(paths) == 0 {
+		return nil
+	}
 
 	var predicate query.Predicate
 	valid := false
-	for !valid {
+	for tries := 0; !valid && tries < g.MaxTries; tries++ {
 		path := paths[random.Intn(len(paths))]
 		dataPath := dataset.Paths[path]
-		predicate = g.generatePredicateForPath(*dataPath)
+		predicate = g.generatePredicateForPath(dataset, *dataPath)
 		if predicate != nil { // Check if predicate is set
 			valid = true
 		}
@@ -191,12 +216,15 @@ func (g *Generator) generateRandomPredicate(dataset dataset.DataSet) query.Predi
 			}
 		}
 	}
+	if !valid {
+		return nil
+	}
 
 	return predicate
 }
 
-// Generates a predicate for the given path
-func (g *Generator) generatePredicateForPath(path dataset.DataPath) query.Predicate {
+// Generates a predicate for the given path of the dataset
+func (g *Generator) generatePredicateForPath(dataset dataset.DataSet, path dataset.DataPath) query.Predicate {
 	suitableFactories := []PredicateFactory{}
 	for _, factory := range g.Predicates {
 		if factory.IsApplicable(path) {
@@ -206,7 +234,11 @@ func (g *Generator) generatePredicateForPath(path dataset.DataPath) query.Predic
 	if len(suitableFactories) == 0 {
 		return nil
 	}
-	return suitableFactories[g.randomGenerator.Intn(len(suitableFactories))].Generate(path, &g.currentBlacklist, g.randomGenerator)
+	factory := suitableFactories[g.randomGenerator.Intn(len(suitableFactories))]
+	if selectivity_factory, ok := factory.(SelectivityPredicateFactory); ok {
+		return selectivity_factory.GenerateWithSelectivity(path, dataset, g.MinSelectivity, g.MaxSelectivity, &g.currentBlacklist, g.randomGenerator)
+	}
+	return factory.Generate(path, &g.currentBlacklist, g.randomGenerator)
 }
 
 func getRandomKeys(m map[string]float64, randomGenerator *rand.Rand) (s []string) {
@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JODA-Explore/BETZE/analyzer"
+	"github.com/JODA-Explore/BETZE/dataset"
+)
+
+// Analyzes the line-separated JSON documents
+func analyze(t *testing.T, lines ...string) dataset.DataSet {
+	t.Helper()
+	a := analyzer.New()
+	err := analyzer.ReadDocuments(strings.NewReader(strings.Join(lines, "\n")), func(doc interface{}) error {
+		a.Add(doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not read documents: %v", err)
+	}
+	return a.DataSet("test")
+}
+
+// Projected datasets may only contain constant paths, on which every predicate selects all or no documents
+func TestGeneratePredicateOnConstantPaths(t *testing.T) {
+	ds := analyze(t,
+		`{"a": 1, "b": "x", "c": true}`,
+		`{"a": 1, "b": "x", "c": true}`,
+		`{"a": 1, "b": "x", "c": true}`,
+	)
+	for _, weighted := range []bool{false, true} {
+		g := New(1)
+		repo := GetPredicateFactoryRepo()
+		repo.SetDefault()
+		g.Predicates = repo.GetChosen()
+		g.WeightedPaths = weighted
+		g.currentBlacklist = *g.getBlacklist(ds.Name)
+
+		done := make(chan bool)
+		go func() {
+			done <- g.generatePredicate(ds) == nil
+		}()
+		select {
+		case isNil := <-done:
+			if !isNil {
+				t.Errorf("expected no predicate on constant paths (weighted paths: %t)", weighted)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("predicate generation on constant paths did not terminate (weighted paths: %t)", weighted)
+		}
+	}
+}
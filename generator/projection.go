@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The maximum number of attributes a query projects
+const maxProjectedAttributes = 5
+
+// The probability to project another attribute
+const additionalAttributeProb = 0.6
+
+// The probability to rename a top-level attribute
+const renameAttributeProb = 0.3
+
+// Projects the documents of an unaggregated query to a random subset of paths with the configured probability.
+// Nested paths are flattened into top-level attributes, top-level attributes are optionally renamed.
+func (g *Generator) generateProjection(ds dataset.DataSet, q *query.Query) {
+	random := g.getRand()
+	if q.Aggregation() != nil || random.Float64() >= g.ProjectionProb {
+		return
+	}
+
+	candidates := projectablePaths(ds)
+	var attributes []query.ProjectedAttribute
+	targets := make(map[string]bool)
+	for len(candidates) > 0 && (len(attributes) == 0 || (len(attributes) < maxProjectedAttributes && random.Float64() < additionalAttributeProb)) {
+		i := random.Intn(len(candidates))
+		source := candidates[i]
+		candidates = append(candidates[:i], candidates[i+1:]...)
+		if overlapsAttribute(source, attributes) {
+			continue
+		}
+
+		target := "/" + strings.Join(strings.Split(strings.TrimPrefix(source, "/"), "/"), "_")
+		if target == source && random.Float64() < renameAttributeProb {
+			target = source + "_new"
+		}
+		// The target may only exist in the dataset if the attribute is projected unchanged
+		if _, exists := ds.Paths[target]; (exists && target != source) || targets[target] {
+			continue
+		}
+		targets[target] = true
+		attributes = append(attributes, query.ProjectedAttribute{Source: source, Target: target})
+	}
+	if len(attributes) == 0 {
+		return
+	}
+	q.Transform(&query.Projection{Attributes: attributes})
+}
+
+// Returns all paths which can be projected, ordered by path.
+// Array elements can not be projected on their own and the root would copy the whole document.
+func projectablePaths(ds dataset.DataSet) []string {
+	paths := []string{}
+	for path := range ds.Paths {
+		if path == "" || dataset.IsElementPath(path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Checks whether the path is already projected by, or contains, one of the attributes
+func overlapsAttribute(path string, attributes []query.ProjectedAttribute) bool {
+	for _, attribute := range attributes {
+		if path == attribute.Source || strings.HasPrefix(path, attribute.Source+"/") || strings.HasPrefix(attribute.Source, path+"/") {
+			return true
+		}
+	}
+	return false
+}
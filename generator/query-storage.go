@@ -26,12 +26,25 @@ type predRawContainer struct {
 	Type  string            `json:"type"`
 	Value boolPredContainer `json:"parameter"`
 }
+type notPredContainer struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"parameter"`
+}
+
+type anyElementPredContainer struct {
+	Path      string          `json:"Path"`
+	Predicate json.RawMessage `json:"Predicate"`
+}
+type anyElementPredRawContainer struct {
+	Type  string                  `json:"type"`
+	Value anyElementPredContainer `json:"parameter"`
+}
 
 // Marshal a predicate to a re-parsable JSON object
 func MarshalPredicate(pred query.Predicate) ([]byte, error) {
 	t := reflect.TypeOf(pred)
 
-	// Check And/Or, as they don't have factories
+	// Check And/Or/Not, as they don't have factories
 	if t == reflect.TypeOf(query.AndPredicate{}) {
 		lhs, err := MarshalPredicate(pred.(query.AndPredicate).Lhs)
 		if err != nil {
@@ -67,6 +80,33 @@ func MarshalPredicate(pred query.Predicate) ([]byte, error) {
 		})
 	}
 
+	if t == reflect.TypeOf(query.NotPredicate{}) {
+		sub, err := MarshalPredicate(pred.(query.NotPredicate).Predicate)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(notPredContainer{
+			Type:  "NotPredicate",
+			Value: sub,
+		})
+	}
+
+	// Check AnyElement, as its sub-predicate needs a type
+	if t == reflect.TypeOf(query.AnyElementPredicate{}) {
+		any_element := pred.(query.AnyElementPredicate)
+		sub, err := MarshalPredicate(any_element.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(anyElementPredRawContainer{
+			Type: AnyElementPredicateFactory{}.ID(),
+			Value: anyElementPredContainer{
+				Path:      any_element.Path,
+				Predicate: sub,
+			},
+		})
+	}
+
 	//Check all factories
 	for _, factory := range GetPredicateFactoryRepo().GetAll() {
 		if factory.Type() == t {
@@ -122,6 +162,50 @@ func UnmarshalPredicate(data []byte) (query.Predicate, error) {
 		}, nil
 	}
 
+	if typeName == "NotPredicate" {
+		valueBytes, err := json.Marshal(m["parameter"])
+		if err != nil {
+			return nil, err
+		}
+		sub, err := UnmarshalPredicate(valueBytes)
+		if err != nil {
+			return nil, err
+		}
+		return query.NotPredicate{Predicate: sub}, nil
+	}
+
+	if typeName == (AnyElementPredicateFactory{}).ID() {
+		valueBytes, err := json.Marshal(m["parameter"])
+		if err != nil {
+			return nil, err
+		}
+		value := anyElementPredContainer{}
+		if err := json.Unmarshal(valueBytes, &value); err != nil {
+			return nil, err
+		}
+		sub, err := UnmarshalPredicate(value.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		return query.AnyElementPredicate{
+			Path:      value.Path,
+			Predicate: sub,
+		}, nil
+	}
+
+	// Sessions created before the type check generalization contain string type checks
+	if typeName == "IsString" {
+		valueBytes, err := json.Marshal(m["parameter"])
+		if err != nil {
+			return nil, err
+		}
+		predicate := query.TypeCheckPredicate{Type: query.TypeString}
+		if err := json.Unmarshal(valueBytes, &predicate); err != nil {
+			return nil, err
+		}
+		return predicate, nil
+	}
+
 	var value reflect.Value
 	var predicate query.Predicate
 	if ty, found := customTypes[typeName]; found {
@@ -147,16 +231,46 @@ type aggContainer struct {
 }
 
 type groupedAggContainer struct {
-	Path   string       `json:"path"`
-	SubAgg aggContainer `json:"subAggregation"`
+	Keys []query.GroupKey `json:"keys,omitempty"`
+	// The single grouping key of files stored before grouping by multiple keys was supported
+	Path   string            `json:"path,omitempty"`
+	Bucket *query.DateBucket `json:"bucket,omitempty"`
+	SubAgg aggContainer      `json:"subAggregation"`
 }
 
+// A single aggregation of a multi aggregation
+type namedAggContainer struct {
+	Name string       `json:"name"`
+	Agg  aggContainer `json:"aggregation"`
+}
+
+// The type of multi aggregations, which have no factory
+const multiAggregationType = "Multi"
+
 // Marshal a aggregation to a re-parsable JSON object
 func MarshalAggregation(agg query.Aggregation) (*aggContainer, error) {
 	if agg == nil {
 		return nil, nil
 	}
 	t := reflect.TypeOf(agg)
+	if multi, ismulti := (agg).(query.MultiAggregation); ismulti { // If multiple aggregations, marshal each
+		aggConts := make([]namedAggContainer, 0, len(multi.Aggs))
+		for _, named := range multi.Aggs {
+			subagg, err := MarshalAggregation(named.Agg)
+			if err != nil {
+				return nil, err
+			}
+			aggConts = append(aggConts, namedAggContainer{Name: named.Name, Agg: *subagg})
+		}
+		b, err := json.Marshal(aggConts)
+		if err != nil {
+			return nil, err
+		}
+		return &aggContainer{
+			Type:  multiAggregationType,
+			Value: b,
+		}, nil
+	}
 	var group, isgroup = (agg).(query.GroupedAggregation)
 	if isgroup { // If group, special nested handling
 		// Marshal subaggregate
@@ -166,7 +280,7 @@ func MarshalAggregation(agg query.Aggregation) (*aggContainer, error) {
 		}
 		// Create data container
 		groupCont := groupedAggContainer{
-			Path:   group.Path,
+			Keys:   group.Keys,
 			SubAgg: *subagg,
 		}
 		// Marshal data container
@@ -208,7 +322,21 @@ func UnmarshalAggregation(data aggContainer) (query.Aggregation, error) {
 	typeName := data.Type
 	groupId := GroupByAggregationFactory{}.ID()
 
-	if typeName == groupId { // Group special nested handling
+	if typeName == multiAggregationType { // Unmarshal each aggregation
+		var aggConts []namedAggContainer
+		if err := json.Unmarshal(data.Value, &aggConts); err != nil {
+			return nil, err
+		}
+		multi := query.MultiAggregation{}
+		for _, aggCont := range aggConts {
+			subagg, err := UnmarshalAggregation(aggCont.Agg)
+			if err != nil {
+				return nil, err
+			}
+			multi.Aggs = append(multi.Aggs, query.NamedAggregation{Name: aggCont.Name, Agg: subagg})
+		}
+		return multi, nil
+	} else if typeName == groupId { // Group special nested handling
 		var aggCont groupedAggContainer
 		if err := json.Unmarshal(data.Value, &aggCont); err != nil {
 			return nil, err
@@ -221,9 +349,12 @@ func UnmarshalAggregation(data aggContainer) (query.Aggregation, error) {
 
 		// Create group
 		group := query.GroupedAggregation{
-			Path: aggCont.Path,
+			Keys: aggCont.Keys,
 			Agg:  subagg,
 		}
+		if len(group.Keys) == 0 {
+			group.Keys = []query.GroupKey{{Path: aggCont.Path, Bucket: aggCont.Bucket}}
+		}
 		return group, nil
 
 	} else {
@@ -242,11 +373,23 @@ func UnmarshalAggregation(data aggContainer) (query.Aggregation, error) {
 	}
 }
 
+type joinJSON struct {
+	Dataset     string `json:"dataset"`
+	Path        string `json:"path"`
+	ForeignPath string `json:"foreignPath"`
+	As          string `json:"as"`
+}
+
 type queryJSON struct {
-	Base      string          `json:"load"`
-	Filter    json.RawMessage `json:"filter"`
-	Aggregate *aggContainer   `json:"agg"`
-	Store     string          `json:"store"`
+	Base      string                     `json:"load"`
+	Unwind    string                     `json:"unwind,omitempty"`
+	Join      *joinJSON                  `json:"join,omitempty"`
+	Filter    json.RawMessage            `json:"filter"`
+	Transform []query.ProjectedAttribute `json:"transform,omitempty"`
+	Aggregate *aggContainer              `json:"agg"`
+	OrderBy   []query.SortKey            `json:"orderBy,omitempty"`
+	Limit     uint64                     `json:"limit,omitempty"`
+	Store     string                     `json:"store"`
 }
 
 func MarshalQuery(q query.Query) ([]byte, error) {
@@ -260,10 +403,25 @@ func MarshalQuery(q query.Query) ([]byte, error) {
 		return nil, err
 	}
 
+	var m_join *joinJSON
+	if join := q.GetJoin(); join != nil {
+		m_join = &joinJSON{join.DatasetName(), join.Path, join.ForeignPath, join.As}
+	}
+
+	var m_transform []query.ProjectedAttribute
+	if projection := q.Projection(); projection != nil {
+		m_transform = projection.Attributes
+	}
+
 	return json.Marshal(queryJSON{
 		q.BaseName(),
+		q.UnwindPath(),
+		m_join,
 		m_pred,
+		m_transform,
 		m_agg,
+		q.SortKeys(),
+		q.ResultLimit(),
 		q.StoreName(),
 	})
 }
@@ -274,8 +432,13 @@ func UnmarshalQuery(b []byte) (*query.Query, error) {
 	if err := json.Unmarshal(b, &temp); err != nil {
 		return nil, err
 	}
+	projection := query.Projection{Attributes: temp.Transform}
+	var join query.Join
+	if temp.Join != nil {
+		join = query.Join{Dataset: &dataset.DataSet{Name: temp.Join.Dataset}, Path: temp.Join.Path, ForeignPath: temp.Join.ForeignPath, As: temp.Join.As}
+	}
 	query := query.Query{}
-	query.Load(&dataset.DataSet{Name: temp.Base}).Store(temp.Store)
+	query.Load(&dataset.DataSet{Name: temp.Base}).Unwind(temp.Unwind).Store(temp.Store)
 
 	pred, err := UnmarshalPredicate(temp.Filter)
 	if err != nil {
@@ -283,6 +446,14 @@ func UnmarshalQuery(b []byte) (*query.Query, error) {
 	}
 	query.Filter(pred)
 
+	if temp.Join != nil {
+		query.Join(&join)
+	}
+
+	if len(temp.Transform) > 0 {
+		query.Transform(&projection)
+	}
+
 	if temp.Aggregate != nil {
 		agg, err := UnmarshalAggregation(*temp.Aggregate)
 		if err != nil {
@@ -290,6 +461,7 @@ func UnmarshalQuery(b []byte) (*query.Query, error) {
 		}
 		query.Aggregate(agg)
 	}
+	query.OrderBy(temp.OrderBy...).Limit(temp.Limit)
 
 	return &query, nil
 }
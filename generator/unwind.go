@@ -0,0 +1,37 @@
+package generator
+
+import (
+	"sort"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// Unwinds a random array of the dataset with the configured probability.
+// Only original datasets are unwound, as the arrays are unwound before filtering and intermediate sets are already filtered.
+func (g *Generator) generateUnwind(ds dataset.DataSet, q *query.Query) {
+	random := g.getRand()
+	if ds.DerivedFrom != nil || random.Float64() >= g.UnwindProb {
+		return
+	}
+	paths := unwindablePaths(ds)
+	if len(paths) == 0 {
+		return
+	}
+	q.Unwind(paths[random.Intn(len(paths))])
+}
+
+// Returns all paths with arrays, which are not nested in other arrays and result in documents if unwound, ordered by path
+func unwindablePaths(ds dataset.DataSet) []string {
+	paths := []string{}
+	for path := range ds.Paths {
+		if path == "" || dataset.IsElementPath(path) {
+			continue
+		}
+		if unwound, ok := ds.UnwoundDataSet(path); ok && unwound.GetSize() > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
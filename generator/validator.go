@@ -0,0 +1,18 @@
+package generator
+
+import (
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// A Validator verifies generated queries against a backend holding the actual data.
+// It is used to measure the real selectivity of a query and to analyze the resulting dataset.
+type Validator interface {
+	// Executes the query and returns the number of selected documents.
+	// The result has to be kept under the store name of the query until Cleanup is called.
+	ResultSize(q query.Query) (uint64, error)
+	// Analyzes the stored result of a previously executed query
+	Analyze(q query.Query) (dataset.DataSet, error)
+	// Removes the stored result of the query from the backend
+	Cleanup(q query.Query) error
+}
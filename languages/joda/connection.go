@@ -8,7 +8,9 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/adam-lavrik/go-imath/i64"
@@ -227,11 +229,26 @@ func (con *JodaConnection) AnalyzeDataset(source string) (dataset.DataSet, error
 		return dataset.DataSet{}, err
 	}
 
+	err = con.analyze_values(&ds)
+
+	if err != nil {
+		return dataset.DataSet{}, err
+	}
+
+	err = con.analyze_histograms(&ds, dataset.HistogramBuckets)
+
+	if err != nil {
+		return dataset.DataSet{}, err
+	}
+
 	return ds, nil
 }
 
+// The maximum number of distinct values of a path, which are collected by the analysis.
+// Listing more values, like all identifiers or timestamps, is too expensive.
+const max_distinct_values = 1000
+
 func (con *JodaConnection) analyze_strings(dataset *dataset.DataSet, max_prefix_length uint) error {
-	max_distinct_prefixes := 1000
 	var paths []string
 	// Collect all string paths
 	for _, path := range dataset.Paths {
@@ -289,7 +306,7 @@ func (con *JodaConnection) analyze_strings(dataset *dataset.DataSet, max_prefix_
 				prefix_list = append(prefix_list, prefix)
 			}
 
-			if len(prefix_list) > max_distinct_prefixes || len(dataset.Paths[path].Stringtype.Prefixes) == len(prefix_list) { // Remove paths with too many prefixes or if all prefixes are already known
+			if len(prefix_list) > max_distinct_values || len(dataset.Paths[path].Stringtype.Prefixes) == len(prefix_list) { // Remove paths with too many prefixes or if all prefixes are already known
 				// Remove Path
 				paths = remove(paths, path)
 			}
@@ -301,6 +318,279 @@ func (con *JodaConnection) analyze_strings(dataset *dataset.DataSet, max_prefix_
 	return nil
 }
 
+// Collects the most common string and integer values, the distinct values, the string lengths and the timestamps of each path by grouping the documents by the value of the path.
+// Paths with too many distinct values are not grouped and keep no value statistics.
+func (con *JodaConnection) analyze_values(ds *dataset.DataSet) error {
+	var agg_predicates []string
+	for _, path := range ds.Paths {
+		if (path.HasStringCount() || path.HasNumCount()) && !has_many_values(path) {
+			agg_predicates = append(agg_predicates, fmt.Sprintf("('/%s': GROUP COUNT('') AS count BY '%s')", strings.ReplaceAll(path.Path, "/", "~1"), path.Path))
+		}
+	}
+	if len(agg_predicates) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf("LOAD %s AGG %s", ds.Name, strings.Join(agg_predicates, ","))
+	query_resp, err := con.Query(query)
+	if err != nil {
+		return err
+	}
+
+	res, err := con.HandleResult(*query_resp)
+	if err != nil {
+		return err
+	}
+
+	if len(res.Result) != 1 {
+		return fmt.Errorf("expected one result document, got %d", len(res.Result))
+	}
+
+	path_map, ok := res.Result[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("query result has unrecognized format")
+	}
+
+	for path, groups := range path_map {
+		path = strings.ReplaceAll(path, "~1", "/")
+		data_path, ok := ds.Paths[path]
+		if !ok {
+			return fmt.Errorf("query result contains unknown path %s", path)
+		}
+		groups, ok := groups.([]interface{})
+		if !ok {
+			return fmt.Errorf("query result entry has unrecognized format")
+		}
+
+		var str_frequencies []dataset.StringFrequency
+		var int_frequencies []dataset.IntFrequency
+		str_sketch := dataset.NewHyperLogLog()
+		int_sketch := dataset.NewHyperLogLog()
+		num_sketch := dataset.NewHyperLogLog()
+		var num_unique uint64
+		var num_values, num_weights []float64
+		ngram_counts := make(map[string]uint64)
+		var min_length, max_length *uint64
+		var total_length, total_strings uint64
+		var temporal dataset.TemporalAnalysis
+		for _, group := range groups {
+			group, ok := group.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("group has unrecognized format")
+			}
+			count, ok := group["count"].(float64)
+			if !ok {
+				return fmt.Errorf("group count has unrecognized type")
+			}
+			switch value := group["group"].(type) {
+			case string:
+				str_frequencies = append(str_frequencies, dataset.StringFrequency{Value: value, Count: uint64(count)})
+				str_sketch.AddString(value)
+				temporal.AddString(value, uint64(count))
+				for _, ngram := range dataset.NGrams(value) {
+					ngram_counts[ngram] += uint64(count)
+				}
+				length := uint64(utf8.RuneCountInString(value))
+				total_length += length * uint64(count)
+				total_strings += uint64(count)
+				if min_length == nil || length < *min_length {
+					min_length = &length
+				}
+				if max_length == nil || length > *max_length {
+					tmp := length
+					max_length = &tmp
+				}
+			case float64:
+				num_sketch.AddFloat(value)
+				num_values = append(num_values, value)
+				num_weights = append(num_weights, count)
+				temporal.AddNumber(value, uint64(count))
+				num_unique++
+				if value == math.Trunc(value) {
+					int_frequencies = append(int_frequencies, dataset.IntFrequency{Value: int64(value), Count: uint64(count)})
+					int_sketch.AddInt(int64(value))
+				}
+			}
+		}
+
+		// Every group is a distinct value, the sketches allow merging the counts
+		str_unique := uint64(len(str_frequencies))
+		int_unique := uint64(len(int_frequencies))
+		if data_path.HasStringCount() {
+			data_path.Stringtype.MostCommon = mostCommonStrings(str_frequencies, dataset.MaxMostCommon)
+			var ngram_frequencies []dataset.StringFrequency
+			for ngram, count := range ngram_counts {
+				ngram_frequencies = append(ngram_frequencies, dataset.StringFrequency{Value: ngram, Count: count})
+			}
+			data_path.Stringtype.NGrams = mostCommonStrings(ngram_frequencies, dataset.MaxNGrams)
+			data_path.Stringtype.Unique = &str_unique
+			data_path.Stringtype.Sketch = str_sketch
+			if total_strings > 0 {
+				avg_length := float64(total_length) / float64(total_strings)
+				data_path.Stringtype.MinLength = min_length
+				data_path.Stringtype.MaxLength = max_length
+				data_path.Stringtype.AvgLength = &avg_length
+			}
+		}
+		if data_path.HasIntCount() {
+			data_path.Inttype.MostCommon = mostCommonInts(int_frequencies)
+			data_path.Inttype.Unique = &int_unique
+			data_path.Inttype.Sketch = int_sketch
+		}
+		if data_path.HasNumCount() {
+			data_path.Floattype.Unique = &num_unique
+			data_path.Floattype.Sketch = num_sketch
+			// The counts of all numbers are known, so the histogram is exact
+			set_histogram(data_path, dataset.NewWeightedHistogram(num_values, num_weights, dataset.HistogramBuckets))
+		}
+		data_path.Temporaltype = temporal.TemporalType()
+	}
+
+	return nil
+}
+
+// Checks whether the path may contain more than max_distinct_values distinct strings or numbers.
+// The distinct string prefixes are a lower bound of the distinct strings, so the strings have to be analyzed before.
+// The distinct numbers are bounded by the number of numbers and, if all numbers are integers, by their range.
+func has_many_values(path *dataset.DataPath) bool {
+	if path.HasStringCount() && len(path.Stringtype.Prefixes) > max_distinct_values {
+		return true
+	}
+	if !path.HasNumCount() || *path.Floattype.Count <= max_distinct_values {
+		return false
+	}
+	only_ints := path.HasIntCount() && *path.Inttype.Count == *path.Floattype.Count
+	return !only_ints || path.Inttype.Min == nil || path.Inttype.Max == nil || float64(*path.Inttype.Max)-float64(*path.Inttype.Min) >= max_distinct_values
+}
+
+// The number of equi-width buckets per histogram bucket, which are merged into the equi-depth buckets
+const histogram_refinement = 16
+
+// Creates equi-depth histograms of all numeric paths without histogram.
+// The documents are grouped by fine equi-width buckets of the value, which are merged into the equi-depth buckets afterwards.
+// The fine buckets contain their lower instead of their upper bound, which shifts the bounds by at most the width of a fine bucket.
+// Paths with few distinct numbers already have an exact histogram from the value analysis.
+func (con *JodaConnection) analyze_histograms(ds *dataset.DataSet, buckets int) error {
+	fine_buckets := buckets * histogram_refinement
+	var agg_predicates []string
+	widths := make(map[string]float64)
+	for _, path := range ds.Paths {
+		if !path.HasNumCount() || path.Floattype.Histogram != nil || path.Floattype.Min == nil || path.Floattype.Max == nil || *path.Floattype.Min == *path.Floattype.Max {
+			continue
+		}
+		width := (*path.Floattype.Max - *path.Floattype.Min) / float64(fine_buckets)
+		widths[path.Path] = width
+		agg_predicates = append(agg_predicates, fmt.Sprintf("('/%s': GROUP COUNT('') AS count BY FLOOR(('%s' - %v) / %v))", strings.ReplaceAll(path.Path, "/", "~1"), path.Path, *path.Floattype.Min, width))
+	}
+	if len(agg_predicates) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf("LOAD %s AGG %s", ds.Name, strings.Join(agg_predicates, ","))
+	query_resp, err := con.Query(query)
+	if err != nil {
+		return err
+	}
+
+	res, err := con.HandleResult(*query_resp)
+	if err != nil {
+		return err
+	}
+
+	if len(res.Result) != 1 {
+		return fmt.Errorf("expected one result document, got %d", len(res.Result))
+	}
+
+	path_map, ok := res.Result[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("query result has unrecognized format")
+	}
+
+	for path, groups := range path_map {
+		path = strings.ReplaceAll(path, "~1", "/")
+		data_path, ok := ds.Paths[path]
+		if !ok {
+			return fmt.Errorf("query result contains unknown path %s", path)
+		}
+		groups, ok := groups.([]interface{})
+		if !ok {
+			return fmt.Errorf("query result entry has unrecognized format")
+		}
+
+		fine := dataset.Histogram{
+			Bounds: make([]float64, fine_buckets+1),
+			Counts: make([]uint64, fine_buckets),
+		}
+		for i := range fine.Bounds {
+			fine.Bounds[i] = *data_path.Floattype.Min + float64(i)*widths[path]
+		}
+		fine.Bounds[fine_buckets] = *data_path.Floattype.Max
+
+		for _, group := range groups {
+			group, ok := group.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("group has unrecognized format")
+			}
+			count, ok := group["count"].(float64)
+			if !ok {
+				return fmt.Errorf("group count has unrecognized type")
+			}
+			// Non-numeric values do not have a bucket
+			bucket, ok := group["group"].(float64)
+			if !ok {
+				continue
+			}
+			// The maximum is part of the last bucket
+			index := int(math.Min(math.Max(bucket, 0), float64(fine_buckets-1)))
+			fine.Counts[index] += uint64(count)
+		}
+
+		set_histogram(data_path, fine.Rebucket(buckets))
+	}
+
+	return nil
+}
+
+// Sets the histogram of all numbers of the path.
+// If all numbers are integers, the number histogram is also the integer histogram.
+func set_histogram(data_path *dataset.DataPath, histogram *dataset.Histogram) {
+	if histogram == nil {
+		return
+	}
+	data_path.Floattype.Histogram = histogram
+	if data_path.HasIntCount() && *data_path.Inttype.Count == *data_path.Floattype.Count {
+		data_path.Inttype.Histogram = histogram.Scale(histogram.Total())
+	}
+}
+
+// Returns the limit most common values, ordered by descending frequency
+func mostCommonStrings(frequencies []dataset.StringFrequency, limit int) []dataset.StringFrequency {
+	sort.Slice(frequencies, func(i, j int) bool {
+		if frequencies[i].Count != frequencies[j].Count {
+			return frequencies[i].Count > frequencies[j].Count
+		}
+		return frequencies[i].Value < frequencies[j].Value
+	})
+	if len(frequencies) > limit {
+		frequencies = frequencies[:limit]
+	}
+	return frequencies
+}
+
+// Returns the most common values, ordered by descending frequency
+func mostCommonInts(frequencies []dataset.IntFrequency) []dataset.IntFrequency {
+	sort.Slice(frequencies, func(i, j int) bool {
+		if frequencies[i].Count != frequencies[j].Count {
+			return frequencies[i].Count > frequencies[j].Count
+		}
+		return frequencies[i].Value < frequencies[j].Value
+	})
+	if len(frequencies) > dataset.MaxMostCommon {
+		frequencies = frequencies[:dataset.MaxMostCommon]
+	}
+	return frequencies
+}
+
 func remove(s []string, r string) []string {
 	for i, v := range s {
 		if v == r {
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
 )
 
@@ -25,21 +27,46 @@ func Connect(host string) (*JodaConnection, error) {
 	return connection, nil
 }
 
-func (Joda) Translate(query query.Query) (query_string string) {
+func (j Joda) Translate(query query.Query) (query_string string) {
+	// Queries JODA can not express are not replaced by a different query
+	if unsupported := Unsupported(query); len(unsupported) > 0 {
+		return j.Comment(fmt.Sprintf("Query on %s can not be expressed in JODA: %s", query.BaseName(), strings.Join(unsupported, ", ")))
+	}
+
 	// LOAD
 	query_string += fmt.Sprintf("LOAD %s", query.BaseName())
 
-	// TODO AS
-
 	// CHOOSE
-	filter := query.FilterPredicate()
-	if filter != nil {
-		query_string += fmt.Sprintf(" CHOOSE %s ", translate_predicate(filter))
+	var filter_string string
+	if filter := query.FilterPredicate(); filter != nil {
+		filter_string = translate_predicate(expand_any_elements(filter, query.Base()))
+	}
+	// The minimum and maximum may only see values of their type
+	if agg_pred := translate_aggregation_prerequisite_predicate(query.Aggregation()); agg_pred != "" {
+		if filter_string != "" {
+			filter_string = fmt.Sprintf("(%s && %s)", filter_string, agg_pred)
+		} else {
+			filter_string = agg_pred
+		}
+	}
+	if filter_string != "" {
+		query_string += fmt.Sprintf(" CHOOSE %s ", filter_string)
+	}
+
+	// AS
+	projection := query.Projection()
+	if projection != nil {
+		query_string += fmt.Sprintf(" AS %s", translate_projection(*projection))
 	}
 
 	var agg = query.Aggregation()
 	if agg != nil {
 		query_string += fmt.Sprintf(" AGG %s", translate_aggregation(agg))
+		// DISTINCT returns the set of values, so a second query on the stored aggregation counts them
+		if contains_distinct_count(agg) {
+			distinct_set := fmt.Sprintf("%s_distinct", query.BaseName())
+			query_string += fmt.Sprintf(" STORE %s\nLOAD %s AS %s", distinct_set, distinct_set, translate_distinct_counts(agg))
+		}
 	}
 
 	// STORE
@@ -50,6 +77,185 @@ func (Joda) Translate(query query.Query) (query_string string) {
 	return
 }
 
+// Unsupported returns the features of the query JODA can not express, or nil if the query can be translated
+func Unsupported(query query.Query) []string {
+	var unsupported []string
+	if contains_predicate(query.FilterPredicate(), has_unknown_array_size(query.Base())) {
+		unsupported = append(unsupported, "predicates on array elements without array size statistics")
+	}
+	if contains_predicate(query.FilterPredicate(), is_unsupported_temporal) {
+		unsupported = append(unsupported, "timestamps with UTC offsets")
+	}
+	if is_grouped_by_multiple_keys(query.Aggregation()) {
+		unsupported = append(unsupported, "grouping by multiple keys")
+	}
+	if is_grouped_multi_aggregation(query.Aggregation()) {
+		unsupported = append(unsupported, "multiple aggregations per group")
+	}
+	if query.AggregationIsGrouped() && contains_distinct_count(query.Aggregation()) {
+		unsupported = append(unsupported, "counting distinct values per group")
+	}
+	if contains_typed_aggregation(query.Aggregation()) {
+		unsupported = append(unsupported, "minimum or maximum among multiple aggregations")
+	}
+	if contains_unsupported_bucket(query.Aggregation()) {
+		unsupported = append(unsupported, "date buckets of epoch timestamps or timestamps with UTC offsets")
+	}
+	if len(query.SortKeys()) > 0 || query.ResultLimit() > 0 {
+		unsupported = append(unsupported, "ordering or limiting results")
+	}
+	// JODA can not create multiple documents from one document
+	if query.UnwindPath() != "" {
+		unsupported = append(unsupported, "unwinding arrays")
+	}
+	if query.GetJoin() != nil {
+		unsupported = append(unsupported, "joining datasets")
+	}
+	// The intermediate set of a query JODA can not express is not stored
+	if base := query.GetBaseQuery(); base != nil && base.StoreName() == query.BaseName() && len(Unsupported(*base)) > 0 {
+		unsupported = append(unsupported, "loading the result of a query JODA can not express")
+	}
+	return unsupported
+}
+
+// SupportsTemporal checks whether JODA can filter and bucket timestamps of the format.
+// JODA has no date functions, so only strings in UTC without fractional seconds can be compared and truncated as text.
+func SupportsTemporal(format dataset.TemporalFormat) bool {
+	return format == dataset.FormatDate || format == dataset.FormatDateTime
+}
+
+// Checks whether the predicate or one of its children matches
+func contains_predicate(predicate query.Predicate, match func(query.Predicate) bool) bool {
+	switch v := predicate.(type) {
+	case query.AndPredicate:
+		return contains_predicate(v.Lhs, match) || contains_predicate(v.Rhs, match)
+	case query.OrPredicate:
+		return contains_predicate(v.Lhs, match) || contains_predicate(v.Rhs, match)
+	case query.NotPredicate:
+		return contains_predicate(v.Predicate, match)
+	}
+	return predicate != nil && match(predicate)
+}
+
+// Returns the largest size of the array at the path in the dataset, or 0 if it is unknown
+func max_array_size(base *dataset.DataSet, path string) uint64 {
+	if base == nil {
+		return 0
+	}
+	data_path, ok := base.Paths[path]
+	if !ok || data_path == nil || data_path.Arraytype == nil || data_path.Arraytype.MaxSize == nil {
+		return 0
+	}
+	return *data_path.Arraytype.MaxSize
+}
+
+// Returns a check whether a predicate on array elements refers to an array, whose size is not known in the dataset
+func has_unknown_array_size(base *dataset.DataSet) func(query.Predicate) bool {
+	return func(predicate query.Predicate) bool {
+		any_element, ok := predicate.(query.AnyElementPredicate)
+		return ok && max_array_size(base, any_element.Path) == 0
+	}
+}
+
+// JODA has no quantifier over array elements, so predicates on array elements are expanded to a check of every index up to the largest array size of the dataset.
+// Indices beyond the size of an array are skipped, so negated sub-predicates do not match missing elements.
+func expand_any_elements(predicate query.Predicate, base *dataset.DataSet) query.Predicate {
+	switch v := predicate.(type) {
+	case query.AndPredicate:
+		return query.AndPredicate{Lhs: expand_any_elements(v.Lhs, base), Rhs: expand_any_elements(v.Rhs, base)}
+	case query.OrPredicate:
+		return query.OrPredicate{Lhs: expand_any_elements(v.Lhs, base), Rhs: expand_any_elements(v.Rhs, base)}
+	case query.NotPredicate:
+		return query.NotPredicate{Predicate: expand_any_elements(v.Predicate, base)}
+	case query.AnyElementPredicate:
+		element_path := dataset.ElementPath(v.Path)
+		var elements query.Predicate
+		for i := max_array_size(base, v.Path); i > 0; i-- {
+			index := i - 1
+			element := query.AndPredicate{
+				Lhs: query.ArraySizeComparisonPredicate{Path: v.Path, Number: index},
+				Rhs: query.RebasePredicate(v.Predicate, element_path, fmt.Sprintf("%s/%d", v.Path, index)),
+			}
+			if elements == nil {
+				elements = element
+			} else {
+				elements = query.OrPredicate{Lhs: element, Rhs: elements}
+			}
+		}
+		return query.AndPredicate{Lhs: query.TypeCheckPredicate{Path: v.Path, Type: query.TypeArray}, Rhs: elements}
+	}
+	return predicate
+}
+
+// Checks whether the aggregation is grouped by multiple keys.
+// JODA groups by a single value and can not combine the values of the keys into an array.
+func is_grouped_by_multiple_keys(agg query.Aggregation) bool {
+	group, ok := agg.(query.GroupedAggregation)
+	return ok && len(group.Keys) > 1
+}
+
+// Checks whether multiple aggregations are grouped.
+// A GROUP computes a single aggregation, so the aggregations could not be combined into one result per group.
+func is_grouped_multi_aggregation(agg query.Aggregation) bool {
+	group, ok := agg.(query.GroupedAggregation)
+	if !ok {
+		return false
+	}
+	_, ok = group.Agg.(query.MultiAggregation)
+	return ok
+}
+
+// Checks whether the aggregation counts distinct values
+func contains_distinct_count(agg query.Aggregation) bool {
+	if group, ok := agg.(query.GroupedAggregation); ok {
+		agg = group.Agg
+	}
+	for _, named := range query.NamedAggregations(agg) {
+		if _, ok := named.Agg.(query.DistinctCountAggregation); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether one of multiple aggregations is a minimum or maximum.
+// Their type prerequisite would also filter the documents of the other aggregations.
+func contains_typed_aggregation(agg query.Aggregation) bool {
+	if group, ok := agg.(query.GroupedAggregation); ok {
+		agg = group.Agg
+	}
+	multi, ok := agg.(query.MultiAggregation)
+	if !ok {
+		return false
+	}
+	for _, named := range multi.Aggs {
+		if translate_aggregation_prerequisite_predicate(named.Agg) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether the aggregation groups by date buckets JODA can not compute
+func contains_unsupported_bucket(agg query.Aggregation) bool {
+	group, ok := agg.(query.GroupedAggregation)
+	if !ok {
+		return false
+	}
+	for _, key := range group.Keys {
+		if key.Bucket != nil && !SupportsTemporal(key.Bucket.Format) {
+			return true
+		}
+	}
+	return false
+}
+
+// Epoch timestamps are compared numerically, other strings than dates and datetimes can not be compared lexicographically
+func is_unsupported_temporal(predicate query.Predicate) bool {
+	temporal, ok := predicate.(query.TemporalPredicate)
+	return ok && !temporal.Format.IsEpoch() && !SupportsTemporal(temporal.Format)
+}
+
 func (Joda) Name() string {
 	return "JODA"
 }
@@ -84,6 +290,8 @@ func translate_predicate(predicate query.Predicate) string {
 		return fmt.Sprintf("(%s && %s)", translate_predicate(v.Lhs), translate_predicate(v.Rhs))
 	case query.OrPredicate:
 		return fmt.Sprintf("(%s || %s)", translate_predicate(v.Lhs), translate_predicate(v.Rhs))
+	case query.NotPredicate:
+		return fmt.Sprintf("!(%s)", translate_predicate(v.Predicate))
 	case query.IntEqualityPredicate:
 		return fmt.Sprintf("'%s' == %d", v.Path, v.Number)
 	case query.FloatComparisonPredicate:
@@ -95,14 +303,38 @@ func translate_predicate(predicate query.Predicate) string {
 			cmpstr += "="
 		}
 		return fmt.Sprintf("'%s' %s %f", v.Path, cmpstr, v.Number)
+	case query.RangePredicate:
+		var lowerstr = ">"
+		if v.LowerInclusive {
+			lowerstr += "="
+		}
+		var upperstr = "<"
+		if v.UpperInclusive {
+			upperstr += "="
+		}
+		return fmt.Sprintf("('%s' %s %f && '%s' %s %f)", v.Path, lowerstr, v.Lower, v.Path, upperstr, v.Upper)
 	case query.StrEqualityPredicate:
-		return fmt.Sprintf("'%s' == \"%s\"", v.Path, v.Str)
+		return fmt.Sprintf("'%s' == \"%s\"", v.Path, escape_string(v.Str))
+	case query.InPredicate:
+		// Each value is compared separately
+		var comparisons []string
+		for _, str := range v.Strings {
+			comparisons = append(comparisons, fmt.Sprintf("'%s' == \"%s\"", v.Path, escape_string(str)))
+		}
+		for _, number := range v.Numbers {
+			comparisons = append(comparisons, fmt.Sprintf("'%s' == %d", v.Path, number))
+		}
+		return fmt.Sprintf("(%s)", strings.Join(comparisons, " || "))
 	case query.StrPrefixPredicate:
 		return fmt.Sprintf("STARTSWITH('%s',\"%s\")", v.Path, escape_string(v.Prefix))
+	case query.StrContainsPredicate:
+		return fmt.Sprintf("CONTAINS('%s',\"%s\")", v.Path, escape_string(v.Substring))
+	case query.StrRegexPredicate:
+		return fmt.Sprintf("REGEX('%s',\"%s\")", v.Path, escape_string(v.Regex()))
 	case query.ExistsPredicate:
 		return fmt.Sprintf("EXISTS('%s')", v.Path)
-	case query.IsStringPredicate:
-		return fmt.Sprintf("ISSTRING('%s')", v.Path)
+	case query.TypeCheckPredicate:
+		return fmt.Sprintf("IS%s('%s')", strings.ToUpper(v.Type.String()), v.Path)
 	case query.BoolEqualityPredicate:
 		return fmt.Sprintf("'%s' == %t", v.Path, v.Value)
 	case query.ObjectSizeComparisonPredicate:
@@ -123,6 +355,28 @@ func translate_predicate(predicate query.Predicate) string {
 			cmpstr += "="
 		}
 		return fmt.Sprintf("SIZE('%s') %s %d", v.Path, cmpstr, v.Number)
+	case query.StrLengthComparisonPredicate:
+		var cmpstr = ">"
+		if v.Smaller {
+			cmpstr = "<"
+		}
+		if v.Equal {
+			cmpstr += "="
+		}
+		return fmt.Sprintf("(ISSTRING('%s') && LEN('%s') %s %d)", v.Path, v.Path, cmpstr, v.Number)
+	case query.TemporalPredicate:
+		return translate_temporal(v)
+	case query.PathComparisonPredicate:
+		var cmpstr = ">"
+		if v.Smaller {
+			cmpstr = "<"
+		}
+		if v.Equal {
+			cmpstr += "="
+		}
+		return fmt.Sprintf("(ISNUMBER('%s') && ISNUMBER('%s') && '%s' %s '%s')", v.Lhs, v.Rhs, v.Lhs, cmpstr, v.Rhs)
+	case query.PathStrEqualityPredicate:
+		return fmt.Sprintf("(ISSTRING('%s') && '%s' == '%s')", v.Lhs, v.Lhs, v.Rhs)
 	default:
 		log.Printf("Error: Missing predicate type translation: %s", predicate.String())
 		return ""
@@ -130,6 +384,75 @@ func translate_predicate(predicate query.Predicate) string {
 
 }
 
+// String timestamps are compared lexicographically, which preserves their order, epoch timestamps numerically
+func translate_temporal(predicate query.TemporalPredicate) string {
+	var bound func(t time.Time) string
+	conditions := []string{}
+	if predicate.Format.IsEpoch() {
+		conditions = append(conditions, fmt.Sprintf("ISNUMBER('%s')", predicate.Path))
+		bound = func(t time.Time) string { return fmt.Sprintf("%d", predicate.Format.Epoch(t)) }
+	} else {
+		conditions = append(conditions, fmt.Sprintf("ISSTRING('%s')", predicate.Path))
+		bound = func(t time.Time) string { return fmt.Sprintf("\"%s\"", predicate.Format.Text(t)) }
+	}
+	if predicate.From != nil {
+		conditions = append(conditions, fmt.Sprintf("'%s' >= %s", predicate.Path, bound(*predicate.From)))
+	}
+	if predicate.To != nil {
+		conditions = append(conditions, fmt.Sprintf("'%s' < %s", predicate.Path, bound(*predicate.To)))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(conditions, " && "))
+}
+
+// Translates a projection into a list of pointer assignments
+func translate_projection(projection query.Projection) string {
+	attributes := make([]string, len(projection.Attributes))
+	for i, attribute := range projection.Attributes {
+		attributes[i] = fmt.Sprintf("('%s': '%s')", attribute.Target, attribute.Source)
+	}
+	return strings.Join(attributes, ", ")
+}
+
+// Translates a single grouping key.
+// Timestamps are bucketed by their prefix, completed to the ISO-8601 string of the start of the bucket in UTC.
+// Numbers are grouped by the lower bound of their bin.
+func translate_group_key(key query.GroupKey) string {
+	if key.Bins != nil {
+		return fmt.Sprintf("(%v + FLOOR(('%s' - %v) / %v) * %v)", key.Bins.Min, key.Path, key.Bins.Min, key.Bins.Width, key.Bins.Width)
+	}
+	if key.Bucket == nil {
+		return fmt.Sprintf("'%s'", key.Path)
+	}
+	prefix := map[dataset.Granularity]int{
+		dataset.GranularityYear:  4,
+		dataset.GranularityMonth: 7,
+		dataset.GranularityDay:   10,
+		dataset.GranularityHour:  13,
+	}[key.Bucket.Unit]
+	suffix := map[dataset.Granularity]string{
+		dataset.GranularityYear:  "-01-01T00:00:00Z",
+		dataset.GranularityMonth: "-01T00:00:00Z",
+		dataset.GranularityDay:   "T00:00:00Z",
+		dataset.GranularityHour:  ":00:00Z",
+	}[key.Bucket.Unit]
+	return fmt.Sprintf("CONCAT(SUBSTR('%s', 0, %d), \"%s\")", key.Path, prefix, suffix)
+}
+
+// Translates the type check of the values a minimum or maximum is computed of
+func translate_aggregation_prerequisite_predicate(agg query.Aggregation) string {
+	switch v := agg.(type) {
+	case query.GroupedAggregation:
+		return translate_aggregation_prerequisite_predicate(v.Agg)
+	case query.MinAggregation:
+		return translate_predicate(query.TypeCheckPredicate{Path: v.Path, Type: v.Type})
+	case query.MaxAggregation:
+		return translate_predicate(query.TypeCheckPredicate{Path: v.Path, Type: v.Type})
+	default:
+		// No prerequisite
+		return ""
+	}
+}
+
 func translate_ungroupedaggregation(agg query.Aggregation) string {
 	switch v := agg.(type) {
 	case query.GlobalCountAggregation:
@@ -138,6 +461,14 @@ func translate_ungroupedaggregation(agg query.Aggregation) string {
 		return fmt.Sprintf("COUNT('%s')", v.Path)
 	case query.SumAggregation:
 		return fmt.Sprintf("SUM('%s')", v.Path)
+	case query.MinAggregation:
+		return fmt.Sprintf("MIN('%s')", v.Path)
+	case query.MaxAggregation:
+		return fmt.Sprintf("MAX('%s')", v.Path)
+	case query.AvgAggregation:
+		return fmt.Sprintf("AVG('%s')", v.Path)
+	case query.DistinctCountAggregation:
+		return fmt.Sprintf("DISTINCT('%s')", v.Path)
 	default:
 		log.Printf("Error: Missing aggregation type translation: %s", agg.String())
 		return ""
@@ -145,13 +476,32 @@ func translate_ungroupedaggregation(agg query.Aggregation) string {
 
 }
 
+// Translates the projection of the stored ungrouped aggregations, replacing the sets of distinct values by their size
+func translate_distinct_counts(agg query.Aggregation) string {
+	named := query.NamedAggregations(agg)
+	attributes := make([]string, len(named))
+	for i, n := range named {
+		if _, ok := n.Agg.(query.DistinctCountAggregation); ok {
+			attributes[i] = fmt.Sprintf("('/%s': SIZE('/%s'))", n.Name, n.Name)
+		} else {
+			attributes[i] = fmt.Sprintf("('/%s': '/%s')", n.Name, n.Name)
+		}
+	}
+	return strings.Join(attributes, ", ")
+}
+
 func translate_aggregation(agg query.Aggregation) string {
 
 	var group, isgroup = agg.(query.GroupedAggregation)
 	if isgroup { // If grouped aggregation, translate sub-aggregations
-		return fmt.Sprintf("('': GROUP %s AS %s BY '%s')", translate_ungroupedaggregation(group.Agg), group.Name(), group.Path)
+		return fmt.Sprintf("('': GROUP %s AS %s BY %s)", translate_ungroupedaggregation(group.Agg), group.Name(), translate_group_key(group.Keys[0]))
 	} else {
-		return fmt.Sprintf("('/%s': %s)", agg.Name(), translate_ungroupedaggregation(agg))
+		named := query.NamedAggregations(agg)
+		aggs := make([]string, len(named))
+		for i, n := range named {
+			aggs[i] = fmt.Sprintf("'/%s': %s", n.Name, translate_ungroupedaggregation(n.Agg))
+		}
+		return fmt.Sprintf("(%s)", strings.Join(aggs, ", "))
 	}
 
 }
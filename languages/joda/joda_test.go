@@ -0,0 +1,166 @@
+package joda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The queries are translated to JODA with every predicate, aggregation and query stage
+func TestTranslate(t *testing.T) {
+	maxSize := uint64(2)
+	// Predicates on array elements are expanded up to the largest array size
+	base := &dataset.DataSet{Name: "base", Paths: map[string]*dataset.DataPath{"/tags": {Arraytype: &dataset.ArrayType{MaxSize: &maxSize}}}}
+	users := &dataset.DataSet{Name: "users"}
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	count := query.NamedAggregation{Name: "count", Agg: query.GlobalCountAggregation{}}
+	sum := query.NamedAggregation{Name: "sum", Agg: query.SumAggregation{Path: "/n"}}
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{
+			name:  "negation",
+			query: new(query.Query).Load(base).Filter(query.NotPredicate{Predicate: query.ExistsPredicate{Path: "/a"}}),
+			want:  `LOAD base CHOOSE !(EXISTS('/a')) `,
+		},
+		{
+			name:  "string equality",
+			query: new(query.Query).Load(base).Filter(query.StrEqualityPredicate{Path: "/s", Str: "x"}),
+			want:  `LOAD base CHOOSE '/s' == "x" `,
+		},
+		{
+			name:  "range",
+			query: new(query.Query).Load(base).Filter(query.RangePredicate{Path: "/n", Lower: 1, Upper: 5, LowerInclusive: true}),
+			want:  `LOAD base CHOOSE ('/n' >= 1.000000 && '/n' < 5.000000) `,
+		},
+		{
+			name:  "substring",
+			query: new(query.Query).Load(base).Filter(query.StrContainsPredicate{Path: "/s", Substring: "ab"}),
+			want:  `LOAD base CHOOSE CONTAINS('/s',"ab") `,
+		},
+		{
+			name:  "regular expression",
+			query: new(query.Query).Load(base).Filter(query.StrRegexPredicate{Path: "/s", Prefix: "a", Infixes: []string{"b"}}),
+			want:  `LOAD base CHOOSE REGEX('/s',"^a.*b") `,
+		},
+		{
+			name:  "type check",
+			query: new(query.Query).Load(base).Filter(query.TypeCheckPredicate{Path: "/o", Type: query.TypeObject}),
+			want:  `LOAD base CHOOSE ISOBJECT('/o') `,
+		},
+		{
+			name:  "any element",
+			query: new(query.Query).Load(base).Filter(query.AnyElementPredicate{Path: "/tags", Predicate: query.StrEqualityPredicate{Path: dataset.ElementPath("/tags"), Str: "x"}}),
+			want:  `LOAD base CHOOSE (ISARRAY('/tags') && ((SIZE('/tags') > 0 && '/tags/0' == "x") || (SIZE('/tags') > 1 && '/tags/1' == "x"))) `,
+		},
+		{
+			name:  "in",
+			query: new(query.Query).Load(base).Filter(query.InPredicate{Path: "/s", Strings: []string{"a", "b"}}),
+			want:  `LOAD base CHOOSE ('/s' == "a" || '/s' == "b") `,
+		},
+		{
+			name:  "string length",
+			query: new(query.Query).Load(base).Filter(query.StrLengthComparisonPredicate{Path: "/s", Number: 3, Smaller: true}),
+			want:  `LOAD base CHOOSE (ISSTRING('/s') && LEN('/s') < 3) `,
+		},
+		{
+			name:  "path comparison",
+			query: new(query.Query).Load(base).Filter(query.PathComparisonPredicate{Lhs: "/n", Rhs: "/m", Smaller: true, Equal: true}),
+			want:  `LOAD base CHOOSE (ISNUMBER('/n') && ISNUMBER('/m') && '/n' <= '/m') `,
+		},
+		{
+			name:  "path string equality",
+			query: new(query.Query).Load(base).Filter(query.PathStrEqualityPredicate{Lhs: "/s", Rhs: "/t"}),
+			want:  `LOAD base CHOOSE (ISSTRING('/s') && '/s' == '/t') `,
+		},
+		{
+			name:  "temporal range",
+			query: new(query.Query).Load(base).Filter(query.TemporalPredicate{Path: "/d", Format: dataset.FormatDate, From: &from, To: &to}),
+			want:  `LOAD base CHOOSE (ISSTRING('/d') && '/d' >= "2021-01-01" && '/d' < "2021-07-01") `,
+		},
+		{
+			name:  "minimum",
+			query: new(query.Query).Load(base).Aggregate(query.MinAggregation{Path: "/n", Type: query.TypeNumber}),
+			want:  `LOAD base CHOOSE ISNUMBER('/n')  AGG ('/min': MIN('/n'))`,
+		},
+		{
+			name:  "maximum",
+			query: new(query.Query).Load(base).Aggregate(query.MaxAggregation{Path: "/s", Type: query.TypeString}),
+			want:  `LOAD base CHOOSE ISSTRING('/s')  AGG ('/max': MAX('/s'))`,
+		},
+		{
+			name:  "average",
+			query: new(query.Query).Load(base).Aggregate(query.AvgAggregation{Path: "/n"}),
+			want:  `LOAD base AGG ('/avg': AVG('/n'))`,
+		},
+		{
+			name:  "distinct count",
+			query: new(query.Query).Load(base).Aggregate(query.DistinctCountAggregation{Path: "/s"}),
+			want: `LOAD base AGG ('/distinct': DISTINCT('/s')) STORE base_distinct
+LOAD base_distinct AS ('/distinct': SIZE('/distinct'))`,
+		},
+		{
+			name:  "multiple aggregations",
+			query: new(query.Query).Load(base).Aggregate(query.MultiAggregation{Aggs: []query.NamedAggregation{count, sum}}),
+			want:  `LOAD base AGG ('/count': COUNT(''), '/sum': SUM('/n'))`,
+		},
+		{
+			name:  "group by multiple keys",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}, {Path: "/t"}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `# Query on base can not be expressed in JODA: grouping by multiple keys`,
+		},
+		{
+			name:  "group by bins",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 10, Count: 3}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `LOAD base AGG ('': GROUP COUNT('') AS count BY (0 + FLOOR(('/n' - 0) / 10) * 10))`,
+		},
+		{
+			name:  "group by date buckets",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/d", Bucket: &query.DateBucket{Format: dataset.FormatDate, Unit: dataset.GranularityMonth}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `LOAD base AGG ('': GROUP COUNT('') AS count BY CONCAT(SUBSTR('/d', 0, 7), "-01T00:00:00Z"))`,
+		},
+		{
+			name:  "order and limit",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/s", Type: query.TypeString}).Limit(10),
+			want:  `# Query on base can not be expressed in JODA: ordering or limiting results`,
+		},
+		{
+			name:  "order groups",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}}, Agg: query.GlobalCountAggregation{}}).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(5),
+			want:  `# Query on base can not be expressed in JODA: ordering or limiting results`,
+		},
+		{
+			name:  "projection",
+			query: new(query.Query).Load(base).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/a/b", Target: "/b"}, {Source: "/n", Target: "/n"}}}),
+			want:  `LOAD base AS ('/b': '/a/b'), ('/n': '/n')`,
+		},
+		{
+			name:  "unwind",
+			query: new(query.Query).Load(base).Unwind("/tags"),
+			want:  `# Query on base can not be expressed in JODA: unwinding arrays`,
+		},
+		{
+			name:  "join",
+			query: new(query.Query).Load(base).Join(&query.Join{Dataset: users, Path: "/uid", ForeignPath: "/id", As: "/users"}),
+			want:  `# Query on base can not be expressed in JODA: joining datasets`,
+		},
+		{
+			name:  "query on an unstored set",
+			query: new(query.Query).Load(&dataset.DataSet{Name: "base_1"}).Filter(query.ExistsPredicate{Path: "/a"}).BasedOn(new(query.Query).Load(base).Unwind("/tags").Store("base_1")),
+			want:  `# Query on base_1 can not be expressed in JODA: loading the result of a query JODA can not express`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Joda{}.Translate(*test.query)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package joda
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// Validator verifies generated queries with a JODA server.
+// The server has to contain all base datasets.
+type Validator struct {
+	Connection *JodaConnection
+}
+
+// Executes the query in JODA and returns the size of the result set
+func (v Validator) ResultSize(q query.Query) (uint64, error) {
+	if unsupported := Unsupported(q); len(unsupported) > 0 {
+		return 0, fmt.Errorf("could not query JODA, the query contains %s", strings.Join(unsupported, ", "))
+	}
+	q_result, err := v.Connection.Query(Joda{}.Translate(q))
+	if err != nil {
+		return 0, err
+	}
+
+	if q_result.Error != "" {
+		return 0, fmt.Errorf("could not query JODA: %s", q_result.Error)
+	}
+
+	err = v.Connection.RemoveResult(*q_result)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(q_result.Size), nil
+}
+
+// Analyzes the set stored by the query
+func (v Validator) Analyze(q query.Query) (dataset.DataSet, error) {
+	return v.Connection.AnalyzeDataset(q.StoreName())
+}
+
+// Removes the set stored by the query
+func (v Validator) Cleanup(q query.Query) error {
+	// Unstored results are already removed after executing the query
+	if q.StoreName() == "" {
+		return nil
+	}
+	return v.Connection.RemoveSource(q.StoreName())
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
 )
 
@@ -39,7 +41,13 @@ func (Jq) Translate(query query.Query) (query_string string) {
 	agg := query.Aggregation()
 
 	// Start JQ commant
-	query_string += "jq -c '"
+	// Without input, "inputs" streams all documents, including the first one
+	query_string += "jq -n -c "
+	if join := query.GetJoin(); join != nil {
+		// The joined dataset is read into an array of documents
+		query_string += fmt.Sprintf("--slurpfile %s %s.json ", joined_variable, join.DatasetName())
+	}
+	query_string += "'"
 
 	// Define aggregation function
 	agg_func := ""
@@ -54,19 +62,43 @@ func (Jq) Translate(query query.Query) (query_string string) {
 
 	// Start piping "inputs" stream
 	inner_statement := "inputs"
+	if join := query.GetJoin(); join != nil {
+		// The joined documents are indexed by their join value before
+		inner_statement = fmt.Sprintf("%s | %s", translate_join_index(*join), inner_statement)
+	}
+	if path := query.UnwindPath(); path != "" {
+		// Each document is replaced by one document per array element
+		inner_statement += fmt.Sprintf(" | %s", translate_unwind(path))
+	}
+	if join := query.GetJoin(); join != nil {
+		// Each document is replaced by one document per matching joined document
+		inner_statement += fmt.Sprintf(" | %s", translate_join(*join))
+	}
 	var pred string
 	if filter != nil {
 		pred = translate_predicate(filter)
-		if agg != nil {
-			agg_pred := translate_aggregation_prerequisite_predicate(agg)
-			if agg_pred != "" {
-				if pred != "" {
-					pred = translate_and_predicate(pred, agg_pred)
-				} else {
-					pred = agg_pred
-				}
+	}
+	if projection := query.Projection(); projection != nil {
+		// The documents are filtered before projecting them
+		if pred != "" {
+			inner_statement += fmt.Sprintf(" | select(%s)", pred)
+			pred = ""
+		}
+		inner_statement += fmt.Sprintf(" | %s", translate_projection(*projection))
+	}
+	if agg != nil {
+		// Aggregations may only see values of their type.
+		// Minimum and maximum would compare values of different types, so they are restricted even without filter.
+		agg_pred := translate_aggregation_prerequisite_predicate(agg)
+		if agg_pred != "" && (pred != "" || is_typed_aggregation(agg)) {
+			if pred != "" {
+				pred = translate_and_predicate(pred, agg_pred)
+			} else {
+				pred = agg_pred
 			}
 		}
+	}
+	if pred != "" {
 		// Pipe stream to select
 		inner_statement += fmt.Sprintf(" | select(%s)", pred)
 	}
@@ -75,6 +107,9 @@ func (Jq) Translate(query query.Query) (query_string string) {
 		query_string += translate_group(agg)
 		// query = "agg(<stream>)"
 		query_string += fmt.Sprintf("agg(%s)", inner_statement)
+	} else if agg == nil && (len(query.SortKeys()) > 0 || query.ResultLimit() > 0) {
+		// query = "[<stream>] | <sort> | .[:limit] | .[]"
+		query_string += fmt.Sprintf("[%s]%s%s | .[]", inner_statement, translate_order(query.SortKeys(), ""), translate_limit(query.ResultLimit()))
 	} else {
 		// query = "<stream>"
 		query_string += inner_statement
@@ -88,8 +123,14 @@ func (Jq) Translate(query query.Query) (query_string string) {
 	if query.AggregationIsGrouped() {
 		// If additional group is required
 		// Start group and aggregate query
-		// query = jq -c '<stream>' | jq -s -c 'group_by(.key) | agg(<group>)'
-		query_string += fmt.Sprintf(" | jq -s -c '%s %s'", agg_func, translate_group(agg))
+		// query = jq -n -c '<stream>' | jq -s -c 'group_by(.key) | agg(<group>)'
+		// The array of groups is ordered and limited afterwards, groups with equal keys are ordered by their group value
+		group_string := translate_group(agg)
+		if keys := query.SortKeys(); len(keys) > 0 || query.ResultLimit() > 0 {
+			group_string += translate_order(keys, ".group")
+		}
+		group_string += translate_limit(query.ResultLimit())
+		query_string += fmt.Sprintf(" | jq -s -c '%s %s'", agg_func, group_string)
 	}
 
 	// STORE
@@ -125,6 +166,49 @@ func last_key(path string) string {
 	return ""
 }
 
+// Translates the unwinding of the array at the path into the iteration over the elements, which replace the array in each document.
+// Documents without array at the path are removed.
+func translate_unwind(path string) string {
+	keys := strings.Split(path, "/")[1:]
+	return fmt.Sprintf("select(%s | type == \"array\") | %s[] as $element | setpath([\"%s\"]; $element)", convert_path(path), convert_path(path), strings.Join(keys, "\", \""))
+}
+
+// The name of the variable holding the documents of the joined dataset
+const joined_variable = "joined"
+
+// Selects strings and numbers at the path, the only values which are joined
+func select_join_value(path string) string {
+	return fmt.Sprintf("select(%s | type == \"string\" or type == \"number\")", convert_path(path))
+}
+
+// Translates the join into an object of the joined documents by their JSON encoded join value.
+func translate_join_index(join query.Join) string {
+	return fmt.Sprintf("(reduce ($%s[] | %s) as $doc ({}; .[$doc | %s | tojson] += [$doc])) as $index", joined_variable, select_join_value(join.ForeignPath), convert_path(join.ForeignPath))
+}
+
+// Translates the join into the iteration over the matching joined documents, which are added to each document.
+// Documents without matching document are removed.
+func translate_join(join query.Join) string {
+	return fmt.Sprintf("%s | ($index[%s | tojson] // [])[] as $match | %s = $match", select_join_value(join.Path), convert_path(join.Path), convert_path(join.As))
+}
+
+// Translates a projection into the sum of single attribute objects.
+// Each attribute object is only created if all objects along the source path exist, otherwise an empty object is added.
+func translate_projection(projection query.Projection) string {
+	attributes := make([]string, len(projection.Attributes))
+	for i, attribute := range projection.Attributes {
+		keys := strings.Split(attribute.Source, "/")[1:]
+		var steps []string
+		for _, key := range keys[:len(keys)-1] {
+			steps = append(steps, fmt.Sprintf("objects | select(has(\"%s\")) | .\"%s\"", key, key))
+		}
+		last := keys[len(keys)-1]
+		steps = append(steps, fmt.Sprintf("objects | select(has(\"%s\")) | {\"%s\": .\"%s\"}", last, attribute.Name(), last))
+		attributes[i] = fmt.Sprintf("((%s) // {})", strings.Join(steps, " | "))
+	}
+	return strings.Join(attributes, " + ")
+}
+
 func translate_cmp_operator(smaller bool, equal bool) string {
 	var cmpstr = ">"
 	if smaller {
@@ -144,30 +228,118 @@ func escape_string(str string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(str, "\\", "\\\\"), "\"", "\\\"")
 }
 
+// Translates the values of an IN predicate to a comma separated list of literals
+func translate_values(predicate query.InPredicate) string {
+	var values []string
+	for _, str := range predicate.Strings {
+		values = append(values, fmt.Sprintf("\"%s\"", escape_string(str)))
+	}
+	for _, number := range predicate.Numbers {
+		values = append(values, fmt.Sprintf("%d", number))
+	}
+	return strings.Join(values, ", ")
+}
+
+// Translates a type check. Missing paths evaluate to null in jq, so null checks have to check the existence first.
+func translate_type_check(predicate query.TypeCheckPredicate) string {
+	switch predicate.Type {
+	case query.TypeNull:
+		return fmt.Sprintf("( %s | (type == \"object\" and has(\"%s\") and .[\"%s\"] == null) )", parent_path(predicate.Path), last_key(predicate.Path), last_key(predicate.Path))
+	case query.TypeInt:
+		return fmt.Sprintf("( %s | (type == \"number\" and . == floor) )", convert_path(predicate.Path))
+	case query.TypeBool:
+		return fmt.Sprintf("( %s | type == \"boolean\" )", convert_path(predicate.Path))
+	default:
+		return fmt.Sprintf("( %s | type == \"%s\" )", convert_path(predicate.Path), strings.ToLower(predicate.Type.String()))
+	}
+}
+
+// Translates the conversion of a timestamp of the given format (the input) to unix seconds
+func translate_timestamp(format dataset.TemporalFormat) string {
+	switch format {
+	case dataset.FormatDate:
+		return "strptime(\"%Y-%m-%d\") | mktime"
+	case dataset.FormatDateTime:
+		return "fromdateiso8601"
+	case dataset.FormatRFC3339:
+		// fromdateiso8601 only accepts UTC timestamps with second precision, so the fraction and offset are applied separately
+		return "capture(\"^(?<s>[0-9-]+T[0-9:]+)(?<f>[.][0-9]+)?(?<z>Z|[+-][0-9]{2}:[0-9]{2})$\") | (.s + \"Z\" | fromdateiso8601) + (\"0\" + (.f // \"\") | tonumber) - (if .z == \"Z\" then 0 else (if .z[0:1] == \"-\" then -1 else 1 end) * ((.z[1:3] | tonumber) * 3600 + (.z[4:6] | tonumber) * 60) end)"
+	case dataset.FormatEpochMillis:
+		return ". / 1000"
+	default:
+		return "."
+	}
+}
+
+// Timestamps are converted to unix seconds and compared with the bounds
+func translate_temporal(predicate query.TemporalPredicate) string {
+	conditions := []string{"type == \"string\""}
+	if predicate.Format.IsEpoch() {
+		conditions[0] = "type == \"number\""
+	}
+	var bounds []string
+	if predicate.From != nil {
+		bounds = append(bounds, fmt.Sprintf(". >= %d", predicate.From.Unix()))
+	}
+	if predicate.To != nil {
+		bounds = append(bounds, fmt.Sprintf(". < %d", predicate.To.Unix()))
+	}
+	if len(bounds) > 0 && predicate.Format == dataset.FormatEpochSeconds {
+		conditions = append(conditions, bounds...)
+	} else if len(bounds) > 0 {
+		conditions = append(conditions, fmt.Sprintf("(%s | %s)", translate_timestamp(predicate.Format), strings.Join(bounds, " and ")))
+	}
+	return fmt.Sprintf("( %s | (%s) )", convert_path(predicate.Path), strings.Join(conditions, " and "))
+}
+
 func translate_predicate(predicate query.Predicate) (query_string string) {
 	switch v := predicate.(type) {
 	case query.AndPredicate:
 		return translate_and_predicate(translate_predicate(v.Lhs), translate_predicate(v.Rhs))
 	case query.OrPredicate:
 		return fmt.Sprintf("( %s or %s )", translate_predicate(v.Lhs), translate_predicate(v.Rhs))
+	case query.NotPredicate:
+		return fmt.Sprintf("( %s | not )", translate_predicate(v.Predicate))
 	case query.IntEqualityPredicate:
 		return fmt.Sprintf("( %s == %d )", convert_path(v.Path), v.Number)
 	case query.FloatComparisonPredicate:
 		return fmt.Sprintf("( %s %s %f )", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.RangePredicate:
+		return fmt.Sprintf("( %s | (type == \"number\" and . %s %f and . %s %f) )", convert_path(v.Path), translate_cmp_operator(false, v.LowerInclusive), v.Lower, translate_cmp_operator(true, v.UpperInclusive), v.Upper)
 	case query.StrEqualityPredicate:
-		return fmt.Sprintf("( %s == %s )", convert_path(v.Path), v.Str)
+		return fmt.Sprintf("( %s == \"%s\" )", convert_path(v.Path), escape_string(v.Str))
+	case query.InPredicate:
+		return fmt.Sprintf("( %s | IN(%s) )", convert_path(v.Path), translate_values(v))
 	case query.StrPrefixPredicate:
 		return fmt.Sprintf("( %s | (. != null and startswith(\"%s\")) )", convert_path(v.Path), escape_string(v.Prefix))
+	case query.StrContainsPredicate:
+		return fmt.Sprintf("( %s | (type == \"string\" and contains(\"%s\")) )", convert_path(v.Path), escape_string(v.Substring))
+	case query.StrRegexPredicate:
+		return fmt.Sprintf("( %s | (type == \"string\" and test(\"%s\")) )", convert_path(v.Path), escape_string(v.Regex()))
 	case query.ExistsPredicate:
 		return fmt.Sprintf("( %s | has(\"%s\") )", parent_path(v.Path), last_key(v.Path))
-	case query.IsStringPredicate:
-		return fmt.Sprintf("( %s | type == \"string\" )", convert_path(v.Path))
+	case query.TypeCheckPredicate:
+		return translate_type_check(v)
 	case query.BoolEqualityPredicate:
 		return fmt.Sprintf("( %s == %t )", convert_path(v.Path), v.Value)
 	case query.ObjectSizeComparisonPredicate:
 		return fmt.Sprintf("( %s | ((type == \"object\") and (keys | length %s %d)) )", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
 	case query.ArraySizeComparisonPredicate:
 		return fmt.Sprintf("( %s | length %s %d )", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.StrLengthComparisonPredicate:
+		return fmt.Sprintf("( %s | ((type == \"string\") and (length %s %d)) )", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.TemporalPredicate:
+		return translate_temporal(v)
+	case query.PathComparisonPredicate:
+		isNumber := translate_and_predicate(translate_type_check(query.TypeCheckPredicate{Path: v.Lhs, Type: query.TypeNumber}), translate_type_check(query.TypeCheckPredicate{Path: v.Rhs, Type: query.TypeNumber}))
+		return translate_and_predicate(isNumber, fmt.Sprintf("( %s %s %s )", convert_path(v.Lhs), translate_cmp_operator(v.Smaller, v.Equal), convert_path(v.Rhs)))
+	case query.PathStrEqualityPredicate:
+		isString := translate_type_check(query.TypeCheckPredicate{Path: v.Lhs, Type: query.TypeString})
+		return translate_and_predicate(isString, fmt.Sprintf("( %s == %s )", convert_path(v.Lhs), convert_path(v.Rhs)))
+	case query.AnyElementPredicate:
+		// The sub-predicate is evaluated with each element as input, so its paths become relative to the element
+		element := translate_predicate(query.RebasePredicate(v.Predicate, dataset.ElementPath(v.Path), ""))
+		return fmt.Sprintf("( %s | (type == \"array\" and any(.[]; %s)) )", convert_path(v.Path), element)
 	default:
 		log.Printf("Error: Missing predicate type translation: %s", predicate.String())
 	}
@@ -175,38 +347,170 @@ func translate_predicate(predicate query.Predicate) (query_string string) {
 	return
 }
 
+// Checks whether the aggregation computes the minimum or maximum of values of a single type
+func is_typed_aggregation(agg query.Aggregation) bool {
+	switch v := agg.(type) {
+	case query.GroupedAggregation:
+		return is_typed_aggregation(v.Agg)
+	case query.MinAggregation, query.MaxAggregation:
+		return true
+	}
+	return false
+}
+
 func translate_aggregation_prerequisite_predicate(agg query.Aggregation) string {
 	switch v := agg.(type) {
 	case query.GroupedAggregation:
 		return translate_aggregation_prerequisite_predicate(v.Agg)
+	case query.MultiAggregation:
+		// Each aggregation skips the documents not fulfilling its own prerequisite
+		return ""
 	case query.SumAggregation:
 		return fmt.Sprintf("( %s | type == \"number\" )", convert_path(v.Path))
+	case query.MinAggregation:
+		return translate_type_check(query.TypeCheckPredicate{Path: v.Path, Type: v.Type})
+	case query.MaxAggregation:
+		return translate_type_check(query.TypeCheckPredicate{Path: v.Path, Type: v.Type})
+	case query.AvgAggregation:
+		return fmt.Sprintf("( %s | type == \"number\" )", convert_path(v.Path))
 	default:
 		// No prerequisite
 		return ""
 	}
 }
 
-func translate_aggregation(agg query.Aggregation) string {
+// Translates the reduction of an aggregation over the documents $x.
+// The reduction starts with the initial value, which is updated for each document and finally converted to the result, if finalize is not empty.
+func translate_reduction(agg query.Aggregation) (initial string, update string, finalize string) {
 	switch v := agg.(type) {
-	case query.GroupedAggregation:
-		return translate_aggregation(v.Agg)
 	case query.GlobalCountAggregation:
-		return "$x (0; . + 1)"
+		return "0", ". + 1", ""
 	case query.CountAggregation:
-		return fmt.Sprintf("$x (0; . + ($x | %s | 1))", convert_path(v.Path))
+		return "0", fmt.Sprintf(". + ($x | %s | 1)", convert_path(v.Path)), ""
 	case query.SumAggregation:
-		return fmt.Sprintf("$x (0; . + ($x | %s))", convert_path(v.Path))
+		return "0", fmt.Sprintf(". + ($x | %s)", convert_path(v.Path)), ""
+	case query.MinAggregation:
+		return "null", fmt.Sprintf("($x | %s) as $v | if . == null or $v < . then $v else . end", convert_path(v.Path)), ""
+	case query.MaxAggregation:
+		return "null", fmt.Sprintf("($x | %s) as $v | if . == null or $v > . then $v else . end", convert_path(v.Path)), ""
+	case query.AvgAggregation:
+		return "{sum: 0, count: 0}", fmt.Sprintf(".sum += ($x | %s) | .count += 1", convert_path(v.Path)), "if .count > 0 then .sum / .count else null end"
+	case query.DistinctCountAggregation:
+		// The values are collected in an array, unique compares them by value and type
+		return "[]", fmt.Sprintf("($x | %s) as $v | if $v != null then . + [$v] else . end", convert_path(v.Path)), "unique | length"
+	case query.MultiAggregation:
+		// All aggregations are reduced into the fields of one object, skipping the documents not fulfilling their prerequisite
+		var initials, updates, finalizers []string
+		for _, named := range v.Aggs {
+			initial, update, finalize := translate_reduction(named.Agg)
+			if agg_pred := translate_aggregation_prerequisite_predicate(named.Agg); agg_pred != "" {
+				update = fmt.Sprintf("if ($x | %s) then (%s) else . end", agg_pred, update)
+			}
+			initials = append(initials, fmt.Sprintf("\"%s\": %s", named.Name, initial))
+			updates = append(updates, fmt.Sprintf(".\"%s\" |= (%s)", named.Name, update))
+			if finalize != "" {
+				finalizers = append(finalizers, fmt.Sprintf(".\"%s\" |= (%s)", named.Name, finalize))
+			}
+		}
+		return fmt.Sprintf("{%s}", strings.Join(initials, ", ")), strings.Join(updates, " | "), strings.Join(finalizers, " | ")
 	default:
 		log.Printf("Error: Missing aggregation type translation: %s", agg.String())
+		return "null", ".", ""
+	}
+}
+
+func translate_aggregation(agg query.Aggregation) string {
+	if group, isgroup := agg.(query.GroupedAggregation); isgroup {
+		agg = group.Agg
+	}
+	initial, update, finalize := translate_reduction(agg)
+	if finalize != "" {
+		return fmt.Sprintf("$x (%s; %s) | %s", initial, update, finalize)
+	}
+	return fmt.Sprintf("$x (%s; %s)", initial, update)
+}
+
+// Translates the grouping keys of a grouped aggregation, multiple keys are grouped by the array of their values
+func translate_group_keys(group query.GroupedAggregation) string {
+	if len(group.Keys) == 1 {
+		return translate_group_key(group.Keys[0])
+	}
+	keys := make([]string, len(group.Keys))
+	for i, key := range group.Keys {
+		keys[i] = translate_group_key(key)
+	}
+	return fmt.Sprintf("[%s]", strings.Join(keys, ", "))
+}
+
+// Translates a single grouping key.
+// Timestamps are bucketed by converting the start of their bucket to an ISO-8601 string, numbers by computing the lower bound of their bin.
+// Other values are grouped as null.
+func translate_group_key(key query.GroupKey) string {
+	if key.Bins != nil {
+		return fmt.Sprintf("(%s | if type == \"number\" then (%v + ((. - %v) / %v | floor) * %v) else null end)", convert_path(key.Path), key.Bins.Min, key.Bins.Min, key.Bins.Width, key.Bins.Width)
+	}
+	if key.Bucket == nil {
+		return convert_path(key.Path)
+	}
+	var truncate string
+	switch key.Bucket.Unit {
+	case dataset.GranularityYear:
+		truncate = "strftime(\"%Y-01-01T00:00:00Z\")"
+	case dataset.GranularityMonth:
+		truncate = "strftime(\"%Y-%m-01T00:00:00Z\")"
+	default:
+		length := int64(key.Bucket.Unit.Duration() / time.Second)
+		truncate = fmt.Sprintf("(. / %d | floor * %d | todate)", length, length)
+	}
+	value_type := "string"
+	if key.Bucket.Format.IsEpoch() {
+		value_type = "number"
+	}
+	return fmt.Sprintf("(%s | if type == \"%s\" then (%s | %s) else null end)", convert_path(key.Path), value_type, translate_timestamp(key.Bucket.Format), truncate)
+}
+
+// Translates the order of an array by stable sorting it by each key, starting with the least significant key.
+// The array is first sorted by the tie value, if given, which orders elements with equal keys.
+// Descending sorts reverse the array before and after sorting, to keep the order of equal values.
+func translate_order(keys []query.SortKey, tie string) string {
+	var sorts []string
+	if tie != "" {
+		sorts = append(sorts, fmt.Sprintf("sort_by(%s)", tie))
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		value := fmt.Sprintf(".\"%s\"", keys[i].Aggregation)
+		if !keys[i].IsAggregation() {
+			value = convert_path(keys[i].Path)
+		}
+		if keys[i].Descending {
+			sorts = append(sorts, fmt.Sprintf("reverse | sort_by(%s) | reverse", value))
+		} else {
+			sorts = append(sorts, fmt.Sprintf("sort_by(%s)", value))
+		}
+	}
+	if len(sorts) == 0 {
 		return ""
 	}
+	return " | " + strings.Join(sorts, " | ")
+}
+
+// Translates the limit of an array, or an empty string if unlimited
+func translate_limit(limit uint64) string {
+	if limit == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" | .[:%d]", limit)
 }
 
 func translate_group(agg query.Aggregation) string {
 	switch v := agg.(type) {
 	case query.GroupedAggregation:
-		return fmt.Sprintf("group_by(%s) | map({group: .[0]%s,  %s: agg(.[])})", convert_path(v.Path), convert_path(v.Path), v.Name())
+		key := translate_group_keys(v)
+		if _, ismulti := v.Agg.(query.MultiAggregation); ismulti {
+			// The aggregation results in an object holding all aggregations
+			return fmt.Sprintf("group_by(%s) | map({group: (.[0] | %s)} + agg(.[]))", key, key)
+		}
+		return fmt.Sprintf("group_by(%s) | map({group: (.[0] | %s),  %s: agg(.[])})", key, key, v.Name())
 	default:
 		return ""
 	}
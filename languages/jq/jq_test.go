@@ -0,0 +1,267 @@
+package jq
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/evaluator"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// Decodes line-separated JSON documents
+func decode(t *testing.T, lines string) []interface{} {
+	t.Helper()
+	var docs []interface{}
+	decoder := json.NewDecoder(strings.NewReader(lines))
+	for decoder.More() {
+		var doc interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			t.Fatalf("could not decode documents: %v", err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// Executes the translated query with jq on the documents of the base dataset
+func run(t *testing.T, q query.Query, docs string) []interface{} {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "betze-jq")
+	if err != nil {
+		t.Fatalf("could not create directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, q.BaseName()+".json"), []byte(docs), 0644); err != nil {
+		t.Fatalf("could not write documents: %v", err)
+	}
+	cmd := exec.Command("bash", "-c", Jq{}.Translate(q))
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("could not execute %s: %v\n%s", Jq{}.Translate(q), err, out)
+	}
+	return decode(t, string(out))
+}
+
+// The systems have to return the same ordered and limited results, also if the sort keys are equal
+func TestOrderMatchesEvaluator(t *testing.T) {
+	if _, err := exec.LookPath("jq"); err != nil {
+		t.Skip("jq is not installed")
+	}
+	docs := `{"id":5,"g":"b","h":"y","n":2}
+{"id":3,"g":"a","h":"x","n":1}
+{"id":8,"g":"c","h":"x","n":2}
+{"id":1,"g":"b","h":"x","n":null}
+{"id":7,"h":"y","n":1}
+{"id":2,"g":"a","h":"y","n":2}
+{"id":6,"g":"c","h":"y"}
+{"id":4,"g":"b","h":"x","n":1}`
+	base := &dataset.DataSet{Name: "base"}
+	count := func(keys ...query.GroupKey) query.Aggregation {
+		return query.GroupedAggregation{Keys: keys, Agg: query.GlobalCountAggregation{}}
+	}
+	tests := []struct {
+		name  string
+		query *query.Query
+	}{
+		{
+			name:  "documents",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/g", Type: query.TypeString}, query.SortKey{Path: "/h", Type: query.TypeString}, query.SortKey{Path: "/id", Type: query.TypeNumber}).Limit(5),
+		},
+		{
+			name:  "groups",
+			query: new(query.Query).Load(base).Aggregate(count(query.GroupKey{Path: "/g"})).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(3),
+		},
+		{
+			name:  "groups by multiple keys",
+			query: new(query.Query).Load(base).Aggregate(count(query.GroupKey{Path: "/g"}, query.GroupKey{Path: "/h"})).OrderBy(query.SortKey{Aggregation: "count"}).Limit(4),
+		},
+		{
+			name:  "groups by bins",
+			query: new(query.Query).Load(base).Aggregate(count(query.GroupKey{Path: "/n", Bins: &query.NumericBins{Min: 1, Width: 1, Count: 2}})).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(2),
+		},
+		{
+			name:  "groups by bins with values at the upper bound",
+			query: new(query.Query).Load(base).Aggregate(count(query.GroupKey{Path: "/n", Bins: &query.NumericBins{Min: 1, Width: 1, Count: 1}})).OrderBy(query.SortKey{Aggregation: "count", Descending: true}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want, err := evaluator.Evaluate(*test.query, decode(t, docs))
+			if err != nil {
+				t.Fatalf("could not evaluate query: %v", err)
+			}
+			if test.query.AggregationIsGrouped() {
+				// The groups are returned as one array
+				want = []interface{}{want}
+			}
+			// The evaluated values are compared in their JSON representation
+			encoded, err := json.Marshal(want)
+			if err != nil {
+				t.Fatalf("could not encode results: %v", err)
+			}
+			var decoded interface{}
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatalf("could not decode results: %v", err)
+			}
+			if got := run(t, *test.query, docs); !reflect.DeepEqual(got, decoded) {
+				t.Errorf("got %v, want %v", got, decoded)
+			}
+		})
+	}
+}
+
+// The queries are translated to jq with every predicate, aggregation and query stage
+func TestTranslate(t *testing.T) {
+	base := &dataset.DataSet{Name: "base"}
+	users := &dataset.DataSet{Name: "users"}
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	count := query.NamedAggregation{Name: "count", Agg: query.GlobalCountAggregation{}}
+	sum := query.NamedAggregation{Name: "sum", Agg: query.SumAggregation{Path: "/n"}}
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{
+			name:  "negation",
+			query: new(query.Query).Load(base).Filter(query.NotPredicate{Predicate: query.ExistsPredicate{Path: "/a"}}),
+			want:  `jq -n -c 'inputs | select(( ( . | has("a") ) | not ))' base.json`,
+		},
+		{
+			name:  "string equality",
+			query: new(query.Query).Load(base).Filter(query.StrEqualityPredicate{Path: "/s", Str: "x"}),
+			want:  `jq -n -c 'inputs | select(( .s == "x" ))' base.json`,
+		},
+		{
+			name:  "range",
+			query: new(query.Query).Load(base).Filter(query.RangePredicate{Path: "/n", Lower: 1, Upper: 5, LowerInclusive: true}),
+			want:  `jq -n -c 'inputs | select(( .n | (type == "number" and . >= 1.000000 and . < 5.000000) ))' base.json`,
+		},
+		{
+			name:  "substring",
+			query: new(query.Query).Load(base).Filter(query.StrContainsPredicate{Path: "/s", Substring: "ab"}),
+			want:  `jq -n -c 'inputs | select(( .s | (type == "string" and contains("ab")) ))' base.json`,
+		},
+		{
+			name:  "regular expression",
+			query: new(query.Query).Load(base).Filter(query.StrRegexPredicate{Path: "/s", Prefix: "a", Infixes: []string{"b"}}),
+			want:  `jq -n -c 'inputs | select(( .s | (type == "string" and test("^a.*b")) ))' base.json`,
+		},
+		{
+			name:  "type check",
+			query: new(query.Query).Load(base).Filter(query.TypeCheckPredicate{Path: "/o", Type: query.TypeObject}),
+			want:  `jq -n -c 'inputs | select(( .o | type == "object" ))' base.json`,
+		},
+		{
+			name:  "any element",
+			query: new(query.Query).Load(base).Filter(query.AnyElementPredicate{Path: "/tags", Predicate: query.StrEqualityPredicate{Path: dataset.ElementPath("/tags"), Str: "x"}}),
+			want:  `jq -n -c 'inputs | select(( .tags | (type == "array" and any(.[]; ( . == "x" ))) ))' base.json`,
+		},
+		{
+			name:  "in",
+			query: new(query.Query).Load(base).Filter(query.InPredicate{Path: "/s", Strings: []string{"a", "b"}}),
+			want:  `jq -n -c 'inputs | select(( .s | IN("a", "b") ))' base.json`,
+		},
+		{
+			name:  "string length",
+			query: new(query.Query).Load(base).Filter(query.StrLengthComparisonPredicate{Path: "/s", Number: 3, Smaller: true}),
+			want:  `jq -n -c 'inputs | select(( .s | ((type == "string") and (length < 3)) ))' base.json`,
+		},
+		{
+			name:  "path comparison",
+			query: new(query.Query).Load(base).Filter(query.PathComparisonPredicate{Lhs: "/n", Rhs: "/m", Smaller: true, Equal: true}),
+			want:  `jq -n -c 'inputs | select(( ( ( .n | type == "number" ) and ( .m | type == "number" ) ) and ( .n <= .m ) ))' base.json`,
+		},
+		{
+			name:  "path string equality",
+			query: new(query.Query).Load(base).Filter(query.PathStrEqualityPredicate{Lhs: "/s", Rhs: "/t"}),
+			want:  `jq -n -c 'inputs | select(( ( .s | type == "string" ) and ( .s == .t ) ))' base.json`,
+		},
+		{
+			name:  "temporal range",
+			query: new(query.Query).Load(base).Filter(query.TemporalPredicate{Path: "/d", Format: dataset.FormatDate, From: &from, To: &to}),
+			want:  `jq -n -c 'inputs | select(( .d | (type == "string" and (strptime("%Y-%m-%d") | mktime | . >= 1609459200 and . < 1625097600)) ))' base.json`,
+		},
+		{
+			name:  "minimum",
+			query: new(query.Query).Load(base).Aggregate(query.MinAggregation{Path: "/n", Type: query.TypeNumber}),
+			want:  `jq -n -c 'def agg(s): reduce s as $x (null; ($x | .n) as $v | if . == null or $v < . then $v else . end); agg(inputs | select(( .n | type == "number" )))' base.json`,
+		},
+		{
+			name:  "maximum",
+			query: new(query.Query).Load(base).Aggregate(query.MaxAggregation{Path: "/s", Type: query.TypeString}),
+			want:  `jq -n -c 'def agg(s): reduce s as $x (null; ($x | .s) as $v | if . == null or $v > . then $v else . end); agg(inputs | select(( .s | type == "string" )))' base.json`,
+		},
+		{
+			name:  "average",
+			query: new(query.Query).Load(base).Aggregate(query.AvgAggregation{Path: "/n"}),
+			want:  `jq -n -c 'def agg(s): reduce s as $x ({sum: 0, count: 0}; .sum += ($x | .n) | .count += 1) | if .count > 0 then .sum / .count else null end; agg(inputs)' base.json`,
+		},
+		{
+			name:  "distinct count",
+			query: new(query.Query).Load(base).Aggregate(query.DistinctCountAggregation{Path: "/s"}),
+			want:  `jq -n -c 'def agg(s): reduce s as $x ([]; ($x | .s) as $v | if $v != null then . + [$v] else . end) | unique | length; agg(inputs)' base.json`,
+		},
+		{
+			name:  "multiple aggregations",
+			query: new(query.Query).Load(base).Aggregate(query.MultiAggregation{Aggs: []query.NamedAggregation{count, sum}}),
+			want:  `jq -n -c 'def agg(s): reduce s as $x ({"count": 0, "sum": 0}; ."count" |= (. + 1) | ."sum" |= (if ($x | ( .n | type == "number" )) then (. + ($x | .n)) else . end)); agg(inputs)' base.json`,
+		},
+		{
+			name:  "group by multiple keys",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}, {Path: "/t"}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `jq -n -c 'inputs' base.json | jq -s -c 'def agg(s): reduce s as $x (0; . + 1);  group_by([.s, .t]) | map({group: (.[0] | [.s, .t]),  count: agg(.[])})'`,
+		},
+		{
+			name:  "group by bins",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 10, Count: 3}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `jq -n -c 'inputs' base.json | jq -s -c 'def agg(s): reduce s as $x (0; . + 1);  group_by((.n | if type == "number" then (0 + ((. - 0) / 10 | floor) * 10) else null end)) | map({group: (.[0] | (.n | if type == "number" then (0 + ((. - 0) / 10 | floor) * 10) else null end)),  count: agg(.[])})'`,
+		},
+		{
+			name:  "group by date buckets",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/d", Bucket: &query.DateBucket{Format: dataset.FormatDate, Unit: dataset.GranularityMonth}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `jq -n -c 'inputs' base.json | jq -s -c 'def agg(s): reduce s as $x (0; . + 1);  group_by((.d | if type == "string" then (strptime("%Y-%m-%d") | mktime | strftime("%Y-%m-01T00:00:00Z")) else null end)) | map({group: (.[0] | (.d | if type == "string" then (strptime("%Y-%m-%d") | mktime | strftime("%Y-%m-01T00:00:00Z")) else null end)),  count: agg(.[])})'`,
+		},
+		{
+			name:  "order and limit",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/s", Type: query.TypeString}).Limit(10),
+			want:  `jq -n -c '[inputs] | sort_by(.s) | reverse | sort_by(.n) | reverse | .[:10] | .[]' base.json`,
+		},
+		{
+			name:  "order groups",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}}, Agg: query.GlobalCountAggregation{}}).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(5),
+			want:  `jq -n -c 'inputs' base.json | jq -s -c 'def agg(s): reduce s as $x (0; . + 1);  group_by(.s) | map({group: (.[0] | .s),  count: agg(.[])}) | sort_by(.group) | reverse | sort_by(."count") | reverse | .[:5]'`,
+		},
+		{
+			name:  "projection",
+			query: new(query.Query).Load(base).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/a/b", Target: "/b"}, {Source: "/n", Target: "/n"}}}),
+			want:  `jq -n -c 'inputs | ((objects | select(has("a")) | ."a" | objects | select(has("b")) | {"b": ."b"}) // {}) + ((objects | select(has("n")) | {"n": ."n"}) // {})' base.json`,
+		},
+		{
+			name:  "unwind",
+			query: new(query.Query).Load(base).Unwind("/tags"),
+			want:  `jq -n -c 'inputs | select(.tags | type == "array") | .tags[] as $element | setpath(["tags"]; $element)' base.json`,
+		},
+		{
+			name:  "join",
+			query: new(query.Query).Load(base).Join(&query.Join{Dataset: users, Path: "/uid", ForeignPath: "/id", As: "/users"}),
+			want:  `jq -n -c --slurpfile joined users.json '(reduce ($joined[] | select(.id | type == "string" or type == "number")) as $doc ({}; .[$doc | .id | tojson] += [$doc])) as $index | inputs | select(.uid | type == "string" or type == "number") | ($index[.uid | tojson] // [])[] as $match | .users = $match' base.json`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Jq{}.Translate(*test.query)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
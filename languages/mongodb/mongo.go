@@ -5,7 +5,9 @@ import (
 	"log"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
 )
 
@@ -44,16 +46,52 @@ func (MongoDB) Translate(query query.Query) (query_string string) {
 
 	var stages []string
 
+	// UNWIND
+	// $unwind treats other values than arrays as single element, so documents without array are removed before
+	if path := query.UnwindPath(); path != "" {
+		stages = append(stages, fmt.Sprintf("{ $match : {\"%s\" : { $type: \"array\" }} }", convert_path(path)))
+		stages = append(stages, fmt.Sprintf("{ $unwind: \"$%s\" }", convert_path(path)))
+	}
+
+	// JOIN
+	// $lookup matches missing values with null and arrays by their elements, so only strings and numbers are joined
+	// Each document is joined with each matching document by unwinding the matches
+	if join := query.GetJoin(); join != nil {
+		stages = append(stages, fmt.Sprintf("{ $match : {\"%s\" : { $type: [ \"string\", \"number\" ] }} }", convert_path(join.Path)))
+		stages = append(stages, fmt.Sprintf("{ $lookup: { from: \"%s\", localField: \"%s\", foreignField: \"%s\", as: \"%s\" } }", join.DatasetName(), convert_path(join.Path), convert_path(join.ForeignPath), convert_path(join.As)))
+		stages = append(stages, fmt.Sprintf("{ $unwind: \"$%s\" }", convert_path(join.As)))
+	}
+
 	// CHOOSE
 	if filter != nil {
 		filter_step := fmt.Sprintf("{ $match : %s }", translate_predicate(filter))
 		stages = append(stages, filter_step)
 	}
 
+	// TRANSFORM
+	if projection := query.Projection(); projection != nil {
+		stages = append(stages, translate_projection(*projection))
+	}
+
 	// AGGREGATE
 	if agg != nil {
 		agg_step := translate_aggregation(agg)
 		stages = append(stages, agg_step)
+		if post_step := translate_aggregation_postprocessing(agg); post_step != "" {
+			stages = append(stages, post_step)
+		}
+	}
+
+	// ORDER BY, LIMIT
+	// Groups with equal keys are ordered by their group
+	if keys := query.SortKeys(); len(keys) > 0 || query.ResultLimit() > 0 {
+		ties := translate_group_order(agg)
+		if len(keys) > 0 || len(ties) > 0 {
+			stages = append(stages, translate_sort(keys, ties))
+		}
+	}
+	if limit := query.ResultLimit(); limit > 0 {
+		stages = append(stages, fmt.Sprintf("{ $limit: %d }", limit))
 	}
 
 	// STORE
@@ -67,6 +105,10 @@ func (MongoDB) Translate(query query.Query) (query_string string) {
 	return
 }
 
+func escape_string(str string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(str, "\\", "\\\\"), "\"", "\\\"")
+}
+
 func convert_path(path string) string {
 	p := strings.ReplaceAll(path, "/", ".")
 	if len(p) > 0 {
@@ -83,6 +125,49 @@ func convert_path_replace_root(path string) string {
 	return ret
 }
 
+// Translates a projection into a $project stage.
+// Fields with missing source values are not created by MongoDB.
+func translate_projection(projection query.Projection) string {
+	fields := make([]string, len(projection.Attributes))
+	for i, attribute := range projection.Attributes {
+		fields[i] = fmt.Sprintf("\"%s\": \"$%s\"", escape_string(attribute.Name()), convert_path(attribute.Source))
+	}
+	return fmt.Sprintf("{ $project: { %s } }", strings.Join(fields, ", "))
+}
+
+// Returns the quoted list of BSON type names of the JSON type
+func translate_bson_types(t query.JSONType) string {
+	switch t {
+	case query.TypeNull:
+		return "\"null\""
+	case query.TypeBool:
+		return "\"bool\""
+	case query.TypeInt:
+		return "\"int\", \"long\""
+	case query.TypeNumber:
+		return "\"int\", \"long\", \"double\", \"decimal\""
+	case query.TypeString:
+		return "\"string\""
+	case query.TypeObject:
+		return "\"object\""
+	case query.TypeArray:
+		return "\"array\""
+	}
+	return ""
+}
+
+// Translates the values of an IN predicate to a comma separated list of literals
+func translate_values(predicate query.InPredicate) string {
+	var values []string
+	for _, str := range predicate.Strings {
+		values = append(values, fmt.Sprintf("\"%s\"", escape_string(str)))
+	}
+	for _, number := range predicate.Numbers {
+		values = append(values, fmt.Sprintf("%d", number))
+	}
+	return strings.Join(values, ", ")
+}
+
 func predicate_at_path(path string, predicate string) string {
 	return fmt.Sprintf("{\"%s\" : %s}", convert_path(path), predicate)
 }
@@ -113,24 +198,95 @@ func translate_and_predicate(lhs string, rhs string) string {
 	return fmt.Sprintf("{ $and: [ %s , %s ] }", lhs, rhs)
 }
 
+// Translates the conversion of the timestamp at the path to a date, values that can not be converted become null
+func translate_timestamp(path string, format dataset.TemporalFormat) string {
+	input := fmt.Sprintf("\"$%s\"", convert_path_replace_root(path))
+	if format == dataset.FormatEpochSeconds {
+		input = fmt.Sprintf("{ $multiply: [ %s, 1000 ] }", input)
+	}
+	return fmt.Sprintf("{ $convert: { input: %s, to: \"date\", onError: null, onNull: null } }", input)
+}
+
+// Timestamps are converted to dates and compared with the bounds
+func translate_temporal(predicate query.TemporalPredicate) string {
+	value_type := query.TypeString
+	if predicate.Format.IsEpoch() {
+		value_type = query.TypeNumber
+	}
+	date := translate_timestamp(predicate.Path, predicate.Format)
+	conditions := []string{fmt.Sprintf("{ $eq: [ { $type: %s }, \"date\" ] }", date)}
+	if predicate.From != nil {
+		conditions = append(conditions, fmt.Sprintf("{ $gte: [ %s, ISODate(\"%s\") ] }", date, predicate.From.UTC().Format(time.RFC3339)))
+	}
+	if predicate.To != nil {
+		conditions = append(conditions, fmt.Sprintf("{ $lt: [ %s, ISODate(\"%s\") ] }", date, predicate.To.UTC().Format(time.RFC3339)))
+	}
+	isTimestamp := translate_predicate(query.TypeCheckPredicate{Path: predicate.Path, Type: value_type})
+	return translate_and_predicate(isTimestamp, fmt.Sprintf("{ $expr: { $and: [ %s ] } }", strings.Join(conditions, ", ")))
+}
+
+// Translates the grouping id of a grouped aggregation.
+// Multiple keys are grouped by an array of their values.
+func translate_group_id(group query.GroupedAggregation) string {
+	if len(group.Keys) == 1 {
+		return translate_group_key(group.Keys[0])
+	}
+	keys := make([]string, len(group.Keys))
+	for i, key := range group.Keys {
+		keys[i] = translate_group_key(key)
+	}
+	return fmt.Sprintf("[ %s ]", strings.Join(keys, ", "))
+}
+
+// Translates a single grouping key.
+// Timestamps are bucketed by formatting the start of their bucket as ISO-8601 string, numbers are binned by computing the lower bound of their bin.
+func translate_group_key(key query.GroupKey) string {
+	if key.Bins != nil {
+		number := translate_typed_value(key.Path, query.TypeNumber)
+		return fmt.Sprintf("{ $add: [ %v, { $multiply: [ { $floor: { $divide: [ { $subtract: [ %s, %v ] }, %v ] } }, %v ] } ] }", key.Bins.Min, number, key.Bins.Min, key.Bins.Width, key.Bins.Width)
+	}
+	if key.Bucket == nil {
+		return fmt.Sprintf("'$%s'", convert_path(key.Path))
+	}
+	format := map[dataset.Granularity]string{
+		dataset.GranularityYear:  "%Y-01-01T00:00:00Z",
+		dataset.GranularityMonth: "%Y-%m-01T00:00:00Z",
+		dataset.GranularityDay:   "%Y-%m-%dT00:00:00Z",
+		dataset.GranularityHour:  "%Y-%m-%dT%H:00:00Z",
+	}[key.Bucket.Unit]
+	return fmt.Sprintf("{ $dateToString: { format: \"%s\", date: %s } }", format, translate_timestamp(key.Path, key.Bucket.Format))
+}
+
 func translate_predicate(predicate query.Predicate) string {
 	switch v := predicate.(type) {
 	case query.AndPredicate:
 		return translate_and_predicate(translate_predicate(v.Lhs), translate_predicate(v.Rhs))
 	case query.OrPredicate:
 		return fmt.Sprintf("{ $or: [ %s , %s ] }", translate_predicate(v.Lhs), translate_predicate(v.Rhs))
+	case query.NotPredicate:
+		// $nor also selects documents missing the paths
+		return fmt.Sprintf("{ $nor: [ %s ] }", translate_predicate(v.Predicate))
 	case query.IntEqualityPredicate:
 		return fmt.Sprintf("{\"%s\" : %d}", convert_path(v.Path), v.Number)
 	case query.FloatComparisonPredicate:
 		return predicate_at_path(v.Path, fmt.Sprintf("{%s: %f}", translate_cmp_function(v.Smaller, v.Equal), v.Number))
+	case query.RangePredicate:
+		return predicate_at_path(v.Path, fmt.Sprintf("{%s: %f, %s: %f}", translate_cmp_function(false, v.LowerInclusive), v.Lower, translate_cmp_function(true, v.UpperInclusive), v.Upper))
 	case query.StrEqualityPredicate:
-		return fmt.Sprintf("{\"%s\" : \"%s\"}", convert_path(v.Path), v.Str)
+		return fmt.Sprintf("{\"%s\" : \"%s\"}", convert_path(v.Path), escape_string(v.Str))
+	case query.InPredicate:
+		return predicate_at_path(v.Path, fmt.Sprintf("{ $in: [ %s ] }", translate_values(v)))
 	case query.StrPrefixPredicate:
 		return fmt.Sprintf("{\"%s\": /^%s.*/}", convert_path(v.Path), strings.ReplaceAll(regexp.QuoteMeta(v.Prefix), "/", "\\/"))
+	case query.StrContainsPredicate:
+		return predicate_at_path(v.Path, fmt.Sprintf("{ $regex: \"%s\" }", escape_string(regexp.QuoteMeta(v.Substring))))
+	case query.StrRegexPredicate:
+		return predicate_at_path(v.Path, fmt.Sprintf("{ $regex: \"%s\" }", escape_string(v.Regex())))
 	case query.ExistsPredicate:
 		return predicate_at_path(v.Path, "{ $exists: true }")
-	case query.IsStringPredicate:
-		return predicate_at_path(v.Path, "{ $type: \"string\" }")
+	case query.TypeCheckPredicate:
+		// The aggregation $type operator does not match array elements and distinguishes missing from null values
+		return fmt.Sprintf("{ $expr: %s }", translate_type_condition(fmt.Sprintf("\"$%s\"", convert_path(v.Path)), v.Type))
 	case query.BoolEqualityPredicate:
 		return fmt.Sprintf("{\"%s\" : %t}", convert_path(v.Path), v.Value)
 	case query.ObjectSizeComparisonPredicate:
@@ -141,6 +297,22 @@ func translate_predicate(predicate query.Predicate) string {
 		isArray := predicate_at_path(v.Path, "{$type : \"array\"}")
 		arrSize := fmt.Sprintf("{$expr:{%s:[{$size:\"$%s\"}, %d]}}", translate_cmp_function(v.Smaller, v.Equal), convert_path_replace_root(v.Path), v.Number)
 		return translate_and_predicate(isArray, arrSize)
+	case query.StrLengthComparisonPredicate:
+		isString := predicate_at_path(v.Path, "{$type : \"string\"}")
+		strLength := fmt.Sprintf("{$expr:{%s:[{$strLenCP:\"$%s\"}, %d]}}", translate_cmp_function(v.Smaller, v.Equal), convert_path_replace_root(v.Path), v.Number)
+		return translate_and_predicate(isString, strLength)
+	case query.TemporalPredicate:
+		return translate_temporal(v)
+	case query.PathComparisonPredicate:
+		isNumber := translate_and_predicate(translate_predicate(query.TypeCheckPredicate{Path: v.Lhs, Type: query.TypeNumber}), translate_predicate(query.TypeCheckPredicate{Path: v.Rhs, Type: query.TypeNumber}))
+		comparison := fmt.Sprintf("{ $expr: { %s: [ \"$%s\", \"$%s\" ] } }", translate_cmp_function(v.Smaller, v.Equal), convert_path(v.Lhs), convert_path(v.Rhs))
+		return translate_and_predicate(isNumber, comparison)
+	case query.PathStrEqualityPredicate:
+		isString := translate_predicate(query.TypeCheckPredicate{Path: v.Lhs, Type: query.TypeString})
+		comparison := fmt.Sprintf("{ $expr: { $eq: [ \"$%s\", \"$%s\" ] } }", convert_path(v.Lhs), convert_path(v.Rhs))
+		return translate_and_predicate(isString, comparison)
+	case query.AnyElementPredicate:
+		return predicate_at_path(v.Path, fmt.Sprintf("{ $elemMatch: %s }", translate_element_predicate(v)))
 	default:
 		log.Printf("Error: Missing predicate type translation: %s", predicate.String())
 		return ""
@@ -148,31 +320,161 @@ func translate_predicate(predicate query.Predicate) string {
 
 }
 
-func translate_ungroupedaggregation(agg query.Aggregation) string {
+// Translates the sub-predicate of an AnyElementPredicate to an $elemMatch condition.
+// Predicates on object elements use paths relative to the element, scalar elements are matched with query operators.
+func translate_element_predicate(predicate query.AnyElementPredicate) string {
+	element_path := dataset.ElementPath(predicate.Path)
+	switch v := predicate.Predicate.(type) {
+	case query.IntEqualityPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{ $eq: %d }", v.Number)
+		}
+	case query.FloatComparisonPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{%s: %f}", translate_cmp_function(v.Smaller, v.Equal), v.Number)
+		}
+	case query.RangePredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{%s: %f, %s: %f}", translate_cmp_function(false, v.LowerInclusive), v.Lower, translate_cmp_function(true, v.UpperInclusive), v.Upper)
+		}
+	case query.StrEqualityPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{ $eq: \"%s\" }", escape_string(v.Str))
+		}
+	case query.StrPrefixPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{ $regex: /^%s.*/ }", strings.ReplaceAll(regexp.QuoteMeta(v.Prefix), "/", "\\/"))
+		}
+	case query.StrContainsPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{ $regex: \"%s\" }", escape_string(regexp.QuoteMeta(v.Substring)))
+		}
+	case query.StrRegexPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{ $regex: \"%s\" }", escape_string(v.Regex()))
+		}
+	case query.BoolEqualityPredicate:
+		if v.Path == element_path {
+			return fmt.Sprintf("{ $eq: %t }", v.Value)
+		}
+	}
+	return translate_predicate(query.RebasePredicate(predicate.Predicate, element_path, ""))
+}
+
+// Translates the condition that the value has the JSON type.
+// Integers are all numbers without fractional part, including those stored as double.
+func translate_type_condition(value string, t query.JSONType) string {
+	if t == query.TypeInt {
+		// $trunc fails for other types, so it is only evaluated for numbers
+		return fmt.Sprintf("{ $cond: [ { $in: [ { $type: %s }, [ %s ] ] }, { $eq: [ { $trunc: %s }, %s ] }, false ] }", value, translate_bson_types(query.TypeNumber), value, value)
+	}
+	return fmt.Sprintf("{ $in: [ { $type: %s }, [ %s ] ] }", value, translate_bson_types(t))
+}
+
+// Translates the value at the path, values of other types are replaced by null and hence ignored by accumulators
+func translate_typed_value(path string, t query.JSONType) string {
+	value := fmt.Sprintf("\"$%s\"", convert_path_replace_root(path))
+	return fmt.Sprintf("{ $cond: [ %s, %s, null ] }", translate_type_condition(value, t), value)
+}
+
+// Translates the accumulator of an aggregation stored in the field of the given name
+func translate_ungroupedaggregation(name string, agg query.Aggregation) string {
 	switch v := agg.(type) {
 	case query.GlobalCountAggregation:
-		return fmt.Sprintf("%s: { $sum: 1 }", v.Name())
+		return fmt.Sprintf("%s: { $sum: 1 }", name)
 	case query.CountAggregation:
-		return fmt.Sprintf("%s: { $sum: {\"$cond\": [ { \"$ifNull\": [\"$%s\", false] }, 1, 0 ]} }", v.Name(), convert_path_replace_root(v.Path))
+		return fmt.Sprintf("%s: { $sum: {\"$cond\": [ { \"$ifNull\": [\"$%s\", false] }, 1, 0 ]} }", name, convert_path_replace_root(v.Path))
 	case query.SumAggregation:
-		return fmt.Sprintf("%s: { $sum: \"$%s\"}", v.Name(), convert_path_replace_root(v.Path))
+		return fmt.Sprintf("%s: { $sum: \"$%s\"}", name, convert_path_replace_root(v.Path))
+	case query.MinAggregation:
+		return fmt.Sprintf("%s: { $min: %s }", name, translate_typed_value(v.Path, v.Type))
+	case query.MaxAggregation:
+		return fmt.Sprintf("%s: { $max: %s }", name, translate_typed_value(v.Path, v.Type))
+	case query.AvgAggregation:
+		return fmt.Sprintf("%s: { $avg: \"$%s\"}", name, convert_path_replace_root(v.Path))
+	case query.DistinctCountAggregation:
+		// Null values are removed from the set, the size is computed in a following stage
+		return fmt.Sprintf("%s: { $addToSet: { $ifNull: [ \"$%s\", \"$$REMOVE\" ] } }", name, convert_path_replace_root(v.Path))
 	default:
 		log.Printf("Error: Missing aggregation type translation: %s", agg.String())
 		return ""
 	}
 }
 
+// Translates the stage computing the final aggregation values from the accumulated values, if the accumulators do not compute them
+func translate_aggregation_postprocessing(agg query.Aggregation) string {
+	if group, isgroup := agg.(query.GroupedAggregation); isgroup {
+		agg = group.Agg
+	}
+	var fields []string
+	for _, named := range query.NamedAggregations(agg) {
+		if _, ok := named.Agg.(query.DistinctCountAggregation); ok {
+			fields = append(fields, fmt.Sprintf("%s: { $size: \"$%s\" }", named.Name, named.Name))
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("{ $addFields: { %s } }", strings.Join(fields, ", "))
+}
+
+// Returns the fields, by which groups with equal keys are ordered.
+// The array of multiple keys is ordered by each key, as arrays would be ordered by their smallest element.
+func translate_group_order(agg query.Aggregation) []string {
+	group, isgroup := agg.(query.GroupedAggregation)
+	if !isgroup {
+		return nil
+	}
+	if len(group.Keys) == 1 {
+		return []string{"_id"}
+	}
+	fields := make([]string, len(group.Keys))
+	for i := range group.Keys {
+		fields[i] = fmt.Sprintf("_id.%d", i)
+	}
+	return fields
+}
+
+// Translates the order of the result, paths of documents and names of aggregations are both fields.
+// Results with equal keys are sorted ascending by the tie fields, that are not already sorted by.
+func translate_sort(keys []query.SortKey, ties []string) string {
+	fields := make([]string, len(keys), len(keys)+len(ties))
+	sorted := map[string]bool{}
+	for i, key := range keys {
+		field := key.Aggregation
+		if !key.IsAggregation() {
+			field = convert_path(key.Path)
+		}
+		sorted[field] = true
+		direction := 1
+		if key.Descending {
+			direction = -1
+		}
+		fields[i] = fmt.Sprintf("\"%s\": %d", field, direction)
+	}
+	for _, tie := range ties {
+		if !sorted[tie] {
+			fields = append(fields, fmt.Sprintf("\"%s\": 1", tie))
+		}
+	}
+	return fmt.Sprintf("{ $sort: { %s } }", strings.Join(fields, ", "))
+}
+
 func translate_aggregation(agg query.Aggregation) string {
 	var group_id = "null"
 	var agg_string = ""
 
 	var group, isgroup = agg.(query.GroupedAggregation)
 	if isgroup { // If grouped aggregation, translate sub-aggregations
-		group_id = fmt.Sprintf("'$%s'", convert_path(group.Path))
-		agg_string = translate_ungroupedaggregation(group.Agg)
-	} else {
-		agg_string = translate_ungroupedaggregation(agg)
+		group_id = translate_group_id(group)
+		agg = group.Agg
+	}
+	// All aggregations are accumulated in the same stage
+	var accumulators []string
+	for _, named := range query.NamedAggregations(agg) {
+		accumulators = append(accumulators, translate_ungroupedaggregation(named.Name, named.Agg))
 	}
+	agg_string = strings.Join(accumulators, ", ")
 
 	return fmt.Sprintf("{ $group: { _id: %s, %s } }", group_id, agg_string)
 }
@@ -0,0 +1,158 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The queries are translated to MongoDB with every predicate, aggregation and query stage
+func TestTranslate(t *testing.T) {
+	base := &dataset.DataSet{Name: "base"}
+	users := &dataset.DataSet{Name: "users"}
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	count := query.NamedAggregation{Name: "count", Agg: query.GlobalCountAggregation{}}
+	sum := query.NamedAggregation{Name: "sum", Agg: query.SumAggregation{Path: "/n"}}
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{
+			name:  "negation",
+			query: new(query.Query).Load(base).Filter(query.NotPredicate{Predicate: query.ExistsPredicate{Path: "/a"}}),
+			want:  `db.base.aggregate([{ $match : { $nor: [ {"a" : { $exists: true }} ] } }])`,
+		},
+		{
+			name:  "string equality",
+			query: new(query.Query).Load(base).Filter(query.StrEqualityPredicate{Path: "/s", Str: "x"}),
+			want:  `db.base.aggregate([{ $match : {"s" : "x"} }])`,
+		},
+		{
+			name:  "range",
+			query: new(query.Query).Load(base).Filter(query.RangePredicate{Path: "/n", Lower: 1, Upper: 5, LowerInclusive: true}),
+			want:  `db.base.aggregate([{ $match : {"n" : {$gte: 1.000000, $lt: 5.000000}} }])`,
+		},
+		{
+			name:  "substring",
+			query: new(query.Query).Load(base).Filter(query.StrContainsPredicate{Path: "/s", Substring: "ab"}),
+			want:  `db.base.aggregate([{ $match : {"s" : { $regex: "ab" }} }])`,
+		},
+		{
+			name:  "regular expression",
+			query: new(query.Query).Load(base).Filter(query.StrRegexPredicate{Path: "/s", Prefix: "a", Infixes: []string{"b"}}),
+			want:  `db.base.aggregate([{ $match : {"s" : { $regex: "^a.*b" }} }])`,
+		},
+		{
+			name:  "type check",
+			query: new(query.Query).Load(base).Filter(query.TypeCheckPredicate{Path: "/o", Type: query.TypeObject}),
+			want:  `db.base.aggregate([{ $match : { $expr: { $in: [ { $type: "$o" }, [ "object" ] ] } } }])`,
+		},
+		{
+			name:  "any element",
+			query: new(query.Query).Load(base).Filter(query.AnyElementPredicate{Path: "/tags", Predicate: query.StrEqualityPredicate{Path: dataset.ElementPath("/tags"), Str: "x"}}),
+			want:  `db.base.aggregate([{ $match : {"tags" : { $elemMatch: { $eq: "x" } }} }])`,
+		},
+		{
+			name:  "in",
+			query: new(query.Query).Load(base).Filter(query.InPredicate{Path: "/s", Strings: []string{"a", "b"}}),
+			want:  `db.base.aggregate([{ $match : {"s" : { $in: [ "a", "b" ] }} }])`,
+		},
+		{
+			name:  "string length",
+			query: new(query.Query).Load(base).Filter(query.StrLengthComparisonPredicate{Path: "/s", Number: 3, Smaller: true}),
+			want:  `db.base.aggregate([{ $match : { $and: [ {"s" : {$type : "string"}} , {$expr:{$lt:[{$strLenCP:"$s"}, 3]}} ] } }])`,
+		},
+		{
+			name:  "path comparison",
+			query: new(query.Query).Load(base).Filter(query.PathComparisonPredicate{Lhs: "/n", Rhs: "/m", Smaller: true, Equal: true}),
+			want:  `db.base.aggregate([{ $match : { $and: [ { $and: [ { $expr: { $in: [ { $type: "$n" }, [ "int", "long", "double", "decimal" ] ] } } , { $expr: { $in: [ { $type: "$m" }, [ "int", "long", "double", "decimal" ] ] } } ] } , { $expr: { $lte: [ "$n", "$m" ] } } ] } }])`,
+		},
+		{
+			name:  "path string equality",
+			query: new(query.Query).Load(base).Filter(query.PathStrEqualityPredicate{Lhs: "/s", Rhs: "/t"}),
+			want:  `db.base.aggregate([{ $match : { $and: [ { $expr: { $in: [ { $type: "$s" }, [ "string" ] ] } } , { $expr: { $eq: [ "$s", "$t" ] } } ] } }])`,
+		},
+		{
+			name:  "temporal range",
+			query: new(query.Query).Load(base).Filter(query.TemporalPredicate{Path: "/d", Format: dataset.FormatDate, From: &from, To: &to}),
+			want:  `db.base.aggregate([{ $match : { $and: [ { $expr: { $in: [ { $type: "$d" }, [ "string" ] ] } } , { $expr: { $and: [ { $eq: [ { $type: { $convert: { input: "$d", to: "date", onError: null, onNull: null } } }, "date" ] }, { $gte: [ { $convert: { input: "$d", to: "date", onError: null, onNull: null } }, ISODate("2021-01-01T00:00:00Z") ] }, { $lt: [ { $convert: { input: "$d", to: "date", onError: null, onNull: null } }, ISODate("2021-07-01T00:00:00Z") ] } ] } } ] } }])`,
+		},
+		{
+			name:  "minimum",
+			query: new(query.Query).Load(base).Aggregate(query.MinAggregation{Path: "/n", Type: query.TypeNumber}),
+			want:  `db.base.aggregate([{ $group: { _id: null, min: { $min: { $cond: [ { $in: [ { $type: "$n" }, [ "int", "long", "double", "decimal" ] ] }, "$n", null ] } } } }])`,
+		},
+		{
+			name:  "maximum",
+			query: new(query.Query).Load(base).Aggregate(query.MaxAggregation{Path: "/s", Type: query.TypeString}),
+			want:  `db.base.aggregate([{ $group: { _id: null, max: { $max: { $cond: [ { $in: [ { $type: "$s" }, [ "string" ] ] }, "$s", null ] } } } }])`,
+		},
+		{
+			name:  "average",
+			query: new(query.Query).Load(base).Aggregate(query.AvgAggregation{Path: "/n"}),
+			want:  `db.base.aggregate([{ $group: { _id: null, avg: { $avg: "$n"} } }])`,
+		},
+		{
+			name:  "distinct count",
+			query: new(query.Query).Load(base).Aggregate(query.DistinctCountAggregation{Path: "/s"}),
+			want:  `db.base.aggregate([{ $group: { _id: null, distinct: { $addToSet: { $ifNull: [ "$s", "$$REMOVE" ] } } } }, { $addFields: { distinct: { $size: "$distinct" } } }])`,
+		},
+		{
+			name:  "multiple aggregations",
+			query: new(query.Query).Load(base).Aggregate(query.MultiAggregation{Aggs: []query.NamedAggregation{count, sum}}),
+			want:  `db.base.aggregate([{ $group: { _id: null, count: { $sum: 1 }, sum: { $sum: "$n"} } }])`,
+		},
+		{
+			name:  "group by multiple keys",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}, {Path: "/t"}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `db.base.aggregate([{ $group: { _id: [ '$s', '$t' ], count: { $sum: 1 } } }])`,
+		},
+		{
+			name:  "group by bins",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 10, Count: 3}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `db.base.aggregate([{ $group: { _id: { $add: [ 0, { $multiply: [ { $floor: { $divide: [ { $subtract: [ { $cond: [ { $in: [ { $type: "$n" }, [ "int", "long", "double", "decimal" ] ] }, "$n", null ] }, 0 ] }, 10 ] } }, 10 ] } ] }, count: { $sum: 1 } } }])`,
+		},
+		{
+			name:  "group by date buckets",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/d", Bucket: &query.DateBucket{Format: dataset.FormatDate, Unit: dataset.GranularityMonth}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `db.base.aggregate([{ $group: { _id: { $dateToString: { format: "%Y-%m-01T00:00:00Z", date: { $convert: { input: "$d", to: "date", onError: null, onNull: null } } } }, count: { $sum: 1 } } }])`,
+		},
+		{
+			name:  "order and limit",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/s", Type: query.TypeString}).Limit(10),
+			want:  `db.base.aggregate([{ $sort: { "n": -1, "s": 1 } }, { $limit: 10 }])`,
+		},
+		{
+			name:  "order groups",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}}, Agg: query.GlobalCountAggregation{}}).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(5),
+			want:  `db.base.aggregate([{ $group: { _id: '$s', count: { $sum: 1 } } }, { $sort: { "count": -1, "_id": 1 } }, { $limit: 5 }])`,
+		},
+		{
+			name:  "projection",
+			query: new(query.Query).Load(base).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/a/b", Target: "/b"}, {Source: "/n", Target: "/n"}}}),
+			want:  `db.base.aggregate([{ $project: { "b": "$a.b", "n": "$n" } }])`,
+		},
+		{
+			name:  "unwind",
+			query: new(query.Query).Load(base).Unwind("/tags"),
+			want:  `db.base.aggregate([{ $match : {"tags" : { $type: "array" }} }, { $unwind: "$tags" }])`,
+		},
+		{
+			name:  "join",
+			query: new(query.Query).Load(base).Join(&query.Join{Dataset: users, Path: "/uid", ForeignPath: "/id", As: "/users"}),
+			want:  `db.base.aggregate([{ $match : {"uid" : { $type: [ "string", "number" ] }} }, { $lookup: { from: "users", localField: "uid", foreignField: "id", as: "users" } }, { $unwind: "$users" }])`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MongoDB{}.Translate(*test.query)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
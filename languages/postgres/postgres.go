@@ -3,8 +3,11 @@ package postgres
 import (
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
 )
 
@@ -48,21 +51,50 @@ func (Postgres) Translate(query query.Query) (query_string string) {
 	}
 
 	// LOAD
-	query_string += fmt.Sprintf(" FROM %s ", query.BaseName())
+	source := query.BaseName()
+
+	// UNWIND
+	// The documents are unwound in a subquery, in which the array is replaced by each of its elements
+	if path := query.UnwindPath(); path != "" {
+		source = fmt.Sprintf("(%s) AS %s", translate_unwind(path, source), query.BaseName())
+	}
+
+	// JOIN
+	// The documents are joined in a subquery, in which the joined document is added to each document
+	if join := query.GetJoin(); join != nil {
+		source = fmt.Sprintf("(%s) AS %s", translate_join(*join, source, query.BaseName()), query.BaseName())
+	}
+
+	// TRANSFORM
+	// The documents are filtered and then projected in a subquery, the remaining query works on the projected documents
+	if projection := query.Projection(); projection != nil {
+		subquery := fmt.Sprintf("SELECT %s AS doc FROM %s", translate_projection(*projection), source)
+		if filter != nil {
+			subquery += fmt.Sprintf(" WHERE %s", translate_predicate(filter))
+			filter = nil
+		}
+		source = fmt.Sprintf("(%s) AS %s", subquery, query.BaseName())
+	}
+	query_string += fmt.Sprintf(" FROM %s ", source)
 
 	// CHOOSE
+	var filter_string string
 	if filter != nil {
-		filter_string := translate_predicate(filter)
-		if agg != nil {
-			agg_pred := translate_aggregation_prerequisite_predicate(agg)
-			if agg_pred != "" {
-				if filter_string != "" {
-					filter_string = translate_and_predicate(filter_string, agg_pred)
-				} else {
-					filter_string = agg_pred
-				}
+		filter_string = translate_predicate(filter)
+	}
+	if agg != nil {
+		// Aggregations may only see values of their type.
+		// Minimum and maximum would compare values of different types, so they are restricted even without filter.
+		agg_pred := translate_aggregation_prerequisite_predicate(agg)
+		if agg_pred != "" && (filter_string != "" || is_typed_aggregation(agg)) {
+			if filter_string != "" {
+				filter_string = translate_and_predicate(filter_string, agg_pred)
+			} else {
+				filter_string = agg_pred
 			}
 		}
+	}
+	if filter_string != "" {
 		query_string += fmt.Sprintf(" WHERE %s ", filter_string)
 	}
 
@@ -70,6 +102,14 @@ func (Postgres) Translate(query query.Query) (query_string string) {
 		query_string += translate_group(agg)
 	}
 
+	// ORDER BY, LIMIT
+	if keys := query.SortKeys(); len(keys) > 0 || query.ResultLimit() > 0 {
+		query_string += translate_order(keys, agg)
+	}
+	if limit := query.ResultLimit(); limit > 0 {
+		query_string += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
 	// STORE
 	if len(query.StoreName()) > 0 {
 		query_string = fmt.Sprintf("CREATE TEMP TABLE %s AS %s; SELECT * FROM %s", query.StoreName(), query_string, query.StoreName())
@@ -79,12 +119,25 @@ func (Postgres) Translate(query query.Query) (query_string string) {
 }
 
 func convert_path(path string) string {
-	parts := strings.Split(path, "/")[1:]
+	var parts []string
+	for _, part := range strings.Split(path, "/")[1:] {
+		// Array elements are accessed with the wildcard array accessor
+		if part == dataset.ElementWildcard && len(parts) > 0 {
+			parts[len(parts)-1] += "[*]"
+		} else {
+			parts = append(parts, part)
+		}
+	}
 	p := strings.Join(parts, ".")
 
 	return fmt.Sprintf("$.%s", p)
 }
 
+// Converts a path to a jsonpath relative to the current item of a filter expression
+func convert_filter_path(path string) string {
+	return "@" + strings.TrimPrefix(convert_path(path), "$")
+}
+
 func convert_extract_path(path string) string {
 	parts := strings.Split(path, "/")[1:]
 	p := strings.Join(parts, ",")
@@ -92,6 +145,33 @@ func convert_extract_path(path string) string {
 	return fmt.Sprintf("{%s}", p)
 }
 
+// Translates the unwinding of the array at the path into a lateral join with its elements.
+// Documents without array at the path are joined with no elements.
+func translate_unwind(path string, source string) string {
+	array := fmt.Sprintf("doc #> '%s'", convert_extract_path(path))
+	elements := fmt.Sprintf("jsonb_array_elements(CASE WHEN jsonb_typeof(%s) = 'array' THEN %s ELSE '[]'::jsonb END)", array, array)
+	return fmt.Sprintf("SELECT jsonb_set(doc, '%s', element) AS doc FROM %s CROSS JOIN LATERAL %s AS element", convert_extract_path(path), source, elements)
+}
+
+// Translates the join into an inner join, which adds the joined document to the attribute of the join.
+// Only strings and numbers are joined, as jsonb also compares objects and arrays.
+func translate_join(join query.Join, source string, base_name string) string {
+	local := fmt.Sprintf("%s.doc #> '%s'", base_name, convert_extract_path(join.Path))
+	foreign := fmt.Sprintf("%s.doc #> '%s'", join.DatasetName(), convert_extract_path(join.ForeignPath))
+	return fmt.Sprintf("SELECT %s.doc || jsonb_build_object('%s', %s.doc) AS doc FROM %s JOIN %s ON %s = %s WHERE jsonb_typeof(%s) IN ('string', 'number')", base_name, join.Name(), join.DatasetName(), source, join.DatasetName(), local, foreign, local)
+}
+
+// Translates a projection into the concatenation of single attribute objects.
+// Attributes are only added if their source value exists.
+func translate_projection(projection query.Projection) string {
+	attributes := make([]string, len(projection.Attributes))
+	for i, attribute := range projection.Attributes {
+		value := fmt.Sprintf("doc #> '%s'", convert_extract_path(attribute.Source))
+		attributes[i] = fmt.Sprintf("CASE WHEN %s IS NOT NULL THEN jsonb_build_object('%s', %s) ELSE '{}'::jsonb END", value, strings.ReplaceAll(attribute.Name(), "'", "''"), value)
+	}
+	return fmt.Sprintf("(%s)", strings.Join(attributes, " || "))
+}
+
 func translate_cmp_operator(smaller bool, equal bool) string {
 	var cmpstr = ">"
 	if smaller {
@@ -103,8 +183,29 @@ func translate_cmp_operator(smaller bool, equal bool) string {
 	return cmpstr
 }
 
+// Escapes a string for a jsonpath string literal embedded in a SQL string literal
 func escape_string(str string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(str, "\\", "\\\\"), "\"", "\\\"")
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(str, "\\", "\\\\"), "\"", "\\\""), "'", "''")
+}
+
+// Returns the name of the JSON type as returned by the jsonpath type() method
+func translate_type_name(t query.JSONType) string {
+	if t == query.TypeBool {
+		return "boolean"
+	}
+	return strings.ToLower(t.String())
+}
+
+// Translates the values of an IN predicate to a comma separated list of jsonb literals
+func translate_values(predicate query.InPredicate) string {
+	var values []string
+	for _, str := range predicate.Strings {
+		values = append(values, fmt.Sprintf("'\"%s\"'", escape_string(str)))
+	}
+	for _, number := range predicate.Numbers {
+		values = append(values, fmt.Sprintf("'%d'", number))
+	}
+	return strings.Join(values, ", ")
 }
 
 func translate_and_predicate(lhs string, rhs string) string {
@@ -117,24 +218,54 @@ func translate_predicate(predicate query.Predicate) (query_string string) {
 		return translate_and_predicate(translate_predicate(v.Lhs), translate_predicate(v.Rhs))
 	case query.OrPredicate:
 		return fmt.Sprintf("( %s OR %s )", translate_predicate(v.Lhs), translate_predicate(v.Rhs))
+	case query.NotPredicate:
+		return fmt.Sprintf("( NOT %s )", translate_predicate(v.Predicate))
 	case query.IntEqualityPredicate:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ == %d)')", convert_path(v.Path), v.Number)
 	case query.FloatComparisonPredicate:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ %s %f)')", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.RangePredicate:
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ %s %f && @ %s %f)')", convert_path(v.Path), translate_cmp_operator(false, v.LowerInclusive), v.Lower, translate_cmp_operator(true, v.UpperInclusive), v.Upper)
 	case query.StrEqualityPredicate:
-		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ == %s)')", convert_path(v.Path), v.Str)
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ == \"%s\")')", convert_path(v.Path), escape_string(v.Str))
+	case query.InPredicate:
+		// Missing paths yield NULL, which has to be false for negations to agree with the other systems
+		return fmt.Sprintf("COALESCE((doc #> '%s') IN (%s), false)", convert_extract_path(v.Path), translate_values(v))
 	case query.StrPrefixPredicate:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ starts with \"%s\")')", convert_path(v.Path), escape_string(v.Prefix))
+	case query.StrContainsPredicate:
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ like_regex \"%s\")')", convert_path(v.Path), escape_string(regexp.QuoteMeta(v.Substring)))
+	case query.StrRegexPredicate:
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ like_regex \"%s\")')", convert_path(v.Path), escape_string(v.Regex()))
 	case query.ExistsPredicate:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s')", convert_path(v.Path))
-	case query.IsStringPredicate:
-		return fmt.Sprintf("jsonb_path_exists(doc,'%s.type() ? (@ == \"string\")')", convert_path(v.Path))
+	case query.TypeCheckPredicate:
+		// Strict mode does not unwrap arrays, silent mode ignores missing paths
+		if v.Type == query.TypeInt {
+			return fmt.Sprintf("jsonb_path_exists(doc,'strict %s ? (@.type() == \"number\" && @ == @.floor())','{}',true)", convert_path(v.Path))
+		}
+		return fmt.Sprintf("jsonb_path_exists(doc,'strict %s ? (@.type() == \"%s\")','{}',true)", convert_path(v.Path), translate_type_name(v.Type))
 	case query.BoolEqualityPredicate:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@ == %t)')", convert_path(v.Path), v.Value)
 	case query.ObjectSizeComparisonPredicate:
 		return fmt.Sprintf("(jsonb_path_exists(doc,'%s ? (@.type() == \"object\")') AND jsonb_path_exists(jsonb_path_query_array(doc, '%s.keyvalue().key'),'$.size() ? (@ %s %d)'))", convert_path(v.Path), convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
 	case query.ArraySizeComparisonPredicate:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s ? (@.type() == \"array\" && @.size() %s %d)') ", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.StrLengthComparisonPredicate:
+		isString := translate_predicate(query.TypeCheckPredicate{Path: v.Path, Type: query.TypeString})
+		return translate_and_predicate(isString, fmt.Sprintf("char_length(doc #>> '%s') %s %d", convert_extract_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number))
+	case query.TemporalPredicate:
+		return translate_temporal(v)
+	case query.PathComparisonPredicate:
+		// Both values are compared within one filter expression, strict mode does not unwrap arrays
+		lhs, rhs := convert_filter_path(v.Lhs), convert_filter_path(v.Rhs)
+		return fmt.Sprintf("jsonb_path_exists(doc,'strict $ ? (%s.type() == \"number\" && %s.type() == \"number\" && %s %s %s)','{}',true)", lhs, rhs, lhs, translate_cmp_operator(v.Smaller, v.Equal), rhs)
+	case query.PathStrEqualityPredicate:
+		lhs, rhs := convert_filter_path(v.Lhs), convert_filter_path(v.Rhs)
+		return fmt.Sprintf("jsonb_path_exists(doc,'strict $ ? (%s.type() == \"string\" && %s == %s)','{}',true)", lhs, lhs, rhs)
+	case query.AnyElementPredicate:
+		// The element paths of the sub-predicate select every element, lax mode would also treat non-array values as elements
+		return translate_and_predicate(translate_predicate(query.TypeCheckPredicate{Path: v.Path, Type: query.TypeArray}), translate_predicate(v.Predicate))
 	default:
 		log.Printf("Error: Missing predicate type translation: %s", predicate.String())
 	}
@@ -142,38 +273,210 @@ func translate_predicate(predicate query.Predicate) (query_string string) {
 	return
 }
 
+// Translates the conversion of the timestamp at the path to a timestamptz, values of other types become NULL.
+// Dates have no time zone and are interpreted in UTC like in the other systems, not in the session time zone.
+func translate_timestamp(path string, format dataset.TemporalFormat) string {
+	value_type := "string"
+	conversion := fmt.Sprintf("(doc #>> '%s')::timestamptz", convert_extract_path(path))
+	switch format {
+	case dataset.FormatDate:
+		conversion = fmt.Sprintf("((doc #>> '%s')::timestamp AT TIME ZONE 'UTC')", convert_extract_path(path))
+	case dataset.FormatEpochSeconds:
+		value_type = "number"
+		conversion = fmt.Sprintf("to_timestamp((doc #>> '%s')::float8)", convert_extract_path(path))
+	case dataset.FormatEpochMillis:
+		value_type = "number"
+		conversion = fmt.Sprintf("to_timestamp((doc #>> '%s')::float8 / 1000)", convert_extract_path(path))
+	}
+	return fmt.Sprintf("(CASE WHEN jsonb_typeof(doc #> '%s') = '%s' THEN %s END)", convert_extract_path(path), value_type, conversion)
+}
+
+// Translates a timestamp literal in UTC
+func translate_timestamp_literal(t time.Time) string {
+	return fmt.Sprintf("'%s'::timestamptz", t.UTC().Format(time.RFC3339))
+}
+
+// Timestamps are converted to timestamptz and compared with the bounds, missing timestamps evaluate to false
+func translate_temporal(predicate query.TemporalPredicate) string {
+	timestamp := translate_timestamp(predicate.Path, predicate.Format)
+	conditions := []string{fmt.Sprintf("%s IS NOT NULL", timestamp)}
+	if predicate.From != nil {
+		conditions = append(conditions, fmt.Sprintf("%s >= %s", timestamp, translate_timestamp_literal(*predicate.From)))
+	}
+	if predicate.To != nil {
+		conditions = append(conditions, fmt.Sprintf("%s < %s", timestamp, translate_timestamp_literal(*predicate.To)))
+	}
+	return fmt.Sprintf("COALESCE(%s, false)", strings.Join(conditions, " AND "))
+}
+
+// Translates the grouping keys of a grouped aggregation as list of expressions
+func translate_group_keys(group query.GroupedAggregation) []string {
+	keys := make([]string, len(group.Keys))
+	for i, key := range group.Keys {
+		keys[i] = translate_group_key(key)
+	}
+	return keys
+}
+
+// Translates a single grouping key.
+// Timestamps are truncated to the start of their bucket in UTC and formatted as ISO-8601 string, numbers are grouped by the lower bound of their bin.
+func translate_group_key(key query.GroupKey) string {
+	if key.Bins != nil {
+		number := fmt.Sprintf("(CASE WHEN jsonb_typeof(doc #> '%s') = 'number' THEN (doc #>> '%s')::float8 END)", convert_extract_path(key.Path), convert_extract_path(key.Path))
+		// width_bucket would group numbers outside of the bins into the overflow buckets
+		return fmt.Sprintf("(%v + floor((%s - %v) / %v) * %v)", key.Bins.Min, number, key.Bins.Min, key.Bins.Width, key.Bins.Width)
+	}
+	if key.Bucket == nil {
+		return fmt.Sprintf("doc #> '%s'", convert_extract_path(key.Path))
+	}
+	return fmt.Sprintf("to_char(date_trunc('%s', %s AT TIME ZONE 'UTC'), 'YYYY-MM-DD\"T\"HH24:MI:SS\"Z\"')", key.Bucket.Unit, translate_timestamp(key.Path, key.Bucket.Format))
+}
+
+// Checks whether the aggregation computes the minimum or maximum of values of a single type
+func is_typed_aggregation(agg query.Aggregation) bool {
+	switch v := agg.(type) {
+	case query.GroupedAggregation:
+		return is_typed_aggregation(v.Agg)
+	case query.MinAggregation, query.MaxAggregation:
+		return true
+	}
+	return false
+}
+
 func translate_aggregation_prerequisite_predicate(agg query.Aggregation) string {
 	switch v := agg.(type) {
 	case query.GroupedAggregation:
 		return translate_aggregation_prerequisite_predicate(v.Agg)
+	case query.MultiAggregation:
+		// Each aggregate filters its own rows
+		return ""
 	case query.SumAggregation:
 		return fmt.Sprintf("jsonb_path_exists(doc,'%s.type() ? (@ == \"number\")')", convert_path(v.Path))
+	case query.MinAggregation:
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s.type() ? (@ == \"%s\")')", convert_path(v.Path), translate_type_name(v.Type))
+	case query.MaxAggregation:
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s.type() ? (@ == \"%s\")')", convert_path(v.Path), translate_type_name(v.Type))
+	case query.AvgAggregation:
+		return fmt.Sprintf("jsonb_path_exists(doc,'%s.type() ? (@ == \"number\")')", convert_path(v.Path))
 	default:
 		// No prerequisite
 		return ""
 	}
 }
 
+// Translates the value at the path for comparisons, strings are compared by their bytes independent of the collation
+func translate_ordered_value(path string, t query.JSONType) string {
+	if t == query.TypeString {
+		return fmt.Sprintf("(doc #>> '%s') COLLATE \"C\"", convert_extract_path(path))
+	}
+	return fmt.Sprintf("(doc #>> '%s')::float", convert_extract_path(path))
+}
+
 func translate_aggregation(agg query.Aggregation) (query_string string) {
 	switch v := agg.(type) {
 	case query.GroupedAggregation:
-		return fmt.Sprintf("doc #> '%s' as group, %s", convert_extract_path(v.Path), translate_aggregation(v.Agg))
+		keys := translate_group_keys(v)
+		group := keys[0]
+		if len(keys) > 1 { // The values of multiple keys are returned as array
+			group = fmt.Sprintf("jsonb_build_array(%s)", strings.Join(keys, ", "))
+		}
+		return fmt.Sprintf("%s as group, %s", group, translate_aggregation(v.Agg))
+	case query.MultiAggregation:
+		// The type prerequisites only filter the rows of their aggregate, instead of all rows
+		aggs := make([]string, len(v.Aggs))
+		for i, named := range v.Aggs {
+			aggs[i] = translate_aggregation(named.Agg)
+			if agg_pred := translate_aggregation_prerequisite_predicate(named.Agg); agg_pred != "" {
+				aggs[i] += fmt.Sprintf(" FILTER (WHERE %s)", agg_pred)
+			}
+			aggs[i] += fmt.Sprintf(" AS \"%s\"", named.Name)
+		}
+		return strings.Join(aggs, ", ")
 	case query.GlobalCountAggregation:
 		return "COUNT(*)"
 	case query.CountAggregation:
 		return fmt.Sprintf("COUNT(doc #> '%s')", convert_extract_path(v.Path))
 	case query.SumAggregation:
 		return fmt.Sprintf("SUM((doc #>> '%s')::float)", convert_extract_path(v.Path))
+	case query.MinAggregation:
+		return fmt.Sprintf("MIN(%s)", translate_ordered_value(v.Path, v.Type))
+	case query.MaxAggregation:
+		return fmt.Sprintf("MAX(%s)", translate_ordered_value(v.Path, v.Type))
+	case query.AvgAggregation:
+		return fmt.Sprintf("AVG((doc #>> '%s')::float)", convert_extract_path(v.Path))
+	case query.DistinctCountAggregation:
+		return fmt.Sprintf("COUNT(DISTINCT NULLIF(doc #> '%s', 'null'::jsonb))", convert_extract_path(v.Path))
 	default:
 		log.Printf("Error: Missing aggregation type translation: %s", agg.String())
 	}
 	return
 }
 
+// Translates the order of the result, missing values are ordered first.
+// Aggregations are referred to by their position in the select list, as single aggregations are not named.
+func translate_order(keys []query.SortKey, agg query.Aggregation) string {
+	orders := make([]string, len(keys))
+	for i, key := range keys {
+		if key.IsAggregation() {
+			orders[i] = fmt.Sprintf("%d", translate_aggregation_position(agg, key.Aggregation))
+		} else {
+			orders[i] = translate_ordered_value(key.Path, key.Type)
+		}
+		if key.Descending {
+			orders[i] += " DESC NULLS LAST"
+		} else {
+			orders[i] += " ASC NULLS FIRST"
+		}
+	}
+	// Groups with equal keys are ordered by their grouping keys
+	if group, isgroup := agg.(query.GroupedAggregation); isgroup {
+		for _, key := range group.Keys {
+			orders = append(orders, translate_group_key_order(key)...)
+		}
+	}
+	if len(orders) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" ORDER BY %s", strings.Join(orders, ", "))
+}
+
+// Translates the ascending order of a grouping key with missing values first, like the order of the group values in the other systems.
+// The expressions contain the grouping key, so they may be used after grouping.
+// Numbers are ordered by their value, other values by their text, which orders strings by their bytes independent of the collation.
+func translate_group_key_order(key query.GroupKey) []string {
+	group_key := translate_group_key(key)
+	if key.Bins != nil {
+		return []string{fmt.Sprintf("%s ASC NULLS FIRST", group_key)}
+	}
+	if key.Bucket != nil {
+		return []string{fmt.Sprintf("%s COLLATE \"C\" ASC NULLS FIRST", group_key)}
+	}
+	return []string{
+		fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'number' THEN (%s)::float8 END) ASC NULLS FIRST", group_key, group_key),
+		fmt.Sprintf("((%s) #>> '{}') COLLATE \"C\" ASC NULLS FIRST", group_key),
+	}
+}
+
+// Returns the position of the named aggregation in the select list, which starts with the group of grouped aggregations
+func translate_aggregation_position(agg query.Aggregation, name string) int {
+	position := 1
+	if group, isgroup := agg.(query.GroupedAggregation); isgroup {
+		position++
+		agg = group.Agg
+	}
+	for i, named := range query.NamedAggregations(agg) {
+		if named.Name == name {
+			return position + i
+		}
+	}
+	log.Printf("Error: Missing aggregation to order by: %s", name)
+	return position
+}
+
 func translate_group(agg query.Aggregation) (query_string string) {
 	switch v := agg.(type) {
 	case query.GroupedAggregation:
-		return fmt.Sprintf(" GROUP BY doc #> '%s'", convert_extract_path(v.Path))
+		return fmt.Sprintf(" GROUP BY %s", strings.Join(translate_group_keys(v), ", "))
 	default:
 		return ""
 	}
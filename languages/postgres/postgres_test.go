@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The queries are translated to PostgreSQL with every predicate, aggregation and query stage
+func TestTranslate(t *testing.T) {
+	base := &dataset.DataSet{Name: "base"}
+	users := &dataset.DataSet{Name: "users"}
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	count := query.NamedAggregation{Name: "count", Agg: query.GlobalCountAggregation{}}
+	sum := query.NamedAggregation{Name: "sum", Agg: query.SumAggregation{Path: "/n"}}
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{
+			name:  "negation",
+			query: new(query.Query).Load(base).Filter(query.NotPredicate{Predicate: query.ExistsPredicate{Path: "/a"}}),
+			want:  `SELECT * FROM base  WHERE ( NOT jsonb_path_exists(doc,'$.a') ) `,
+		},
+		{
+			name:  "string equality",
+			query: new(query.Query).Load(base).Filter(query.StrEqualityPredicate{Path: "/s", Str: "x"}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'$.s ? (@ == "x")') `,
+		},
+		{
+			name:  "range",
+			query: new(query.Query).Load(base).Filter(query.RangePredicate{Path: "/n", Lower: 1, Upper: 5, LowerInclusive: true}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'$.n ? (@ >= 1.000000 && @ < 5.000000)') `,
+		},
+		{
+			name:  "substring",
+			query: new(query.Query).Load(base).Filter(query.StrContainsPredicate{Path: "/s", Substring: "ab"}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'$.s ? (@ like_regex "ab")') `,
+		},
+		{
+			name:  "regular expression",
+			query: new(query.Query).Load(base).Filter(query.StrRegexPredicate{Path: "/s", Prefix: "a", Infixes: []string{"b"}}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'$.s ? (@ like_regex "^a.*b")') `,
+		},
+		{
+			name:  "type check",
+			query: new(query.Query).Load(base).Filter(query.TypeCheckPredicate{Path: "/o", Type: query.TypeObject}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'strict $.o ? (@.type() == "object")','{}',true) `,
+		},
+		{
+			name:  "any element",
+			query: new(query.Query).Load(base).Filter(query.AnyElementPredicate{Path: "/tags", Predicate: query.StrEqualityPredicate{Path: dataset.ElementPath("/tags"), Str: "x"}}),
+			want:  `SELECT * FROM base  WHERE ( jsonb_path_exists(doc,'strict $.tags ? (@.type() == "array")','{}',true) AND jsonb_path_exists(doc,'$.tags[*] ? (@ == "x")') ) `,
+		},
+		{
+			name:  "in",
+			query: new(query.Query).Load(base).Filter(query.InPredicate{Path: "/s", Strings: []string{"a", "b"}}),
+			want:  `SELECT * FROM base  WHERE COALESCE((doc #> '{s}') IN ('"a"', '"b"'), false) `,
+		},
+		{
+			name:  "string length",
+			query: new(query.Query).Load(base).Filter(query.StrLengthComparisonPredicate{Path: "/s", Number: 3, Smaller: true}),
+			want:  `SELECT * FROM base  WHERE ( jsonb_path_exists(doc,'strict $.s ? (@.type() == "string")','{}',true) AND char_length(doc #>> '{s}') < 3 ) `,
+		},
+		{
+			name:  "path comparison",
+			query: new(query.Query).Load(base).Filter(query.PathComparisonPredicate{Lhs: "/n", Rhs: "/m", Smaller: true, Equal: true}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'strict $ ? (@.n.type() == "number" && @.m.type() == "number" && @.n <= @.m)','{}',true) `,
+		},
+		{
+			name:  "path string equality",
+			query: new(query.Query).Load(base).Filter(query.PathStrEqualityPredicate{Lhs: "/s", Rhs: "/t"}),
+			want:  `SELECT * FROM base  WHERE jsonb_path_exists(doc,'strict $ ? (@.s.type() == "string" && @.s == @.t)','{}',true) `,
+		},
+		{
+			name:  "temporal range",
+			query: new(query.Query).Load(base).Filter(query.TemporalPredicate{Path: "/d", Format: dataset.FormatDate, From: &from, To: &to}),
+			want:  `SELECT * FROM base  WHERE COALESCE((CASE WHEN jsonb_typeof(doc #> '{d}') = 'string' THEN ((doc #>> '{d}')::timestamp AT TIME ZONE 'UTC') END) IS NOT NULL AND (CASE WHEN jsonb_typeof(doc #> '{d}') = 'string' THEN ((doc #>> '{d}')::timestamp AT TIME ZONE 'UTC') END) >= '2021-01-01T00:00:00Z'::timestamptz AND (CASE WHEN jsonb_typeof(doc #> '{d}') = 'string' THEN ((doc #>> '{d}')::timestamp AT TIME ZONE 'UTC') END) < '2021-07-01T00:00:00Z'::timestamptz, false) `,
+		},
+		{
+			name:  "minimum",
+			query: new(query.Query).Load(base).Aggregate(query.MinAggregation{Path: "/n", Type: query.TypeNumber}),
+			want:  `SELECT MIN((doc #>> '{n}')::float) FROM base  WHERE jsonb_path_exists(doc,'$.n.type() ? (@ == "number")') `,
+		},
+		{
+			name:  "maximum",
+			query: new(query.Query).Load(base).Aggregate(query.MaxAggregation{Path: "/s", Type: query.TypeString}),
+			want:  `SELECT MAX((doc #>> '{s}') COLLATE "C") FROM base  WHERE jsonb_path_exists(doc,'$.s.type() ? (@ == "string")') `,
+		},
+		{
+			name:  "average",
+			query: new(query.Query).Load(base).Aggregate(query.AvgAggregation{Path: "/n"}),
+			want:  `SELECT AVG((doc #>> '{n}')::float) FROM base `,
+		},
+		{
+			name:  "distinct count",
+			query: new(query.Query).Load(base).Aggregate(query.DistinctCountAggregation{Path: "/s"}),
+			want:  `SELECT COUNT(DISTINCT NULLIF(doc #> '{s}', 'null'::jsonb)) FROM base `,
+		},
+		{
+			name:  "multiple aggregations",
+			query: new(query.Query).Load(base).Aggregate(query.MultiAggregation{Aggs: []query.NamedAggregation{count, sum}}),
+			want:  `SELECT COUNT(*) AS "count", SUM((doc #>> '{n}')::float) FILTER (WHERE jsonb_path_exists(doc,'$.n.type() ? (@ == "number")')) AS "sum" FROM base `,
+		},
+		{
+			name:  "group by multiple keys",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}, {Path: "/t"}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `SELECT jsonb_build_array(doc #> '{s}', doc #> '{t}') as group, COUNT(*) FROM base  GROUP BY doc #> '{s}', doc #> '{t}'`,
+		},
+		{
+			name:  "group by bins",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 10, Count: 3}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `SELECT (0 + floor(((CASE WHEN jsonb_typeof(doc #> '{n}') = 'number' THEN (doc #>> '{n}')::float8 END) - 0) / 10) * 10) as group, COUNT(*) FROM base  GROUP BY (0 + floor(((CASE WHEN jsonb_typeof(doc #> '{n}') = 'number' THEN (doc #>> '{n}')::float8 END) - 0) / 10) * 10)`,
+		},
+		{
+			name:  "group by date buckets",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/d", Bucket: &query.DateBucket{Format: dataset.FormatDate, Unit: dataset.GranularityMonth}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `SELECT to_char(date_trunc('month', (CASE WHEN jsonb_typeof(doc #> '{d}') = 'string' THEN ((doc #>> '{d}')::timestamp AT TIME ZONE 'UTC') END) AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:MI:SS"Z"') as group, COUNT(*) FROM base  GROUP BY to_char(date_trunc('month', (CASE WHEN jsonb_typeof(doc #> '{d}') = 'string' THEN ((doc #>> '{d}')::timestamp AT TIME ZONE 'UTC') END) AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`,
+		},
+		{
+			name:  "order and limit",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/s", Type: query.TypeString}).Limit(10),
+			want:  `SELECT * FROM base  ORDER BY (doc #>> '{n}')::float DESC NULLS LAST, (doc #>> '{s}') COLLATE "C" ASC NULLS FIRST LIMIT 10`,
+		},
+		{
+			name:  "order groups",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}}, Agg: query.GlobalCountAggregation{}}).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(5),
+			want:  `SELECT doc #> '{s}' as group, COUNT(*) FROM base  GROUP BY doc #> '{s}' ORDER BY 2 DESC NULLS LAST, (CASE WHEN jsonb_typeof(doc #> '{s}') = 'number' THEN (doc #> '{s}')::float8 END) ASC NULLS FIRST, ((doc #> '{s}') #>> '{}') COLLATE "C" ASC NULLS FIRST LIMIT 5`,
+		},
+		{
+			name:  "projection",
+			query: new(query.Query).Load(base).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/a/b", Target: "/b"}, {Source: "/n", Target: "/n"}}}),
+			want:  `SELECT * FROM (SELECT (CASE WHEN doc #> '{a,b}' IS NOT NULL THEN jsonb_build_object('b', doc #> '{a,b}') ELSE '{}'::jsonb END || CASE WHEN doc #> '{n}' IS NOT NULL THEN jsonb_build_object('n', doc #> '{n}') ELSE '{}'::jsonb END) AS doc FROM base) AS base `,
+		},
+		{
+			name:  "unwind",
+			query: new(query.Query).Load(base).Unwind("/tags"),
+			want:  `SELECT * FROM (SELECT jsonb_set(doc, '{tags}', element) AS doc FROM base CROSS JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(doc #> '{tags}') = 'array' THEN doc #> '{tags}' ELSE '[]'::jsonb END) AS element) AS base `,
+		},
+		{
+			name:  "join",
+			query: new(query.Query).Load(base).Join(&query.Join{Dataset: users, Path: "/uid", ForeignPath: "/id", As: "/users"}),
+			want:  `SELECT * FROM (SELECT base.doc || jsonb_build_object('users', users.doc) AS doc FROM base JOIN users ON base.doc #> '{uid}' = users.doc #> '{id}' WHERE jsonb_typeof(base.doc #> '{uid}') IN ('string', 'number')) AS base `,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Postgres{}.Translate(*test.query)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
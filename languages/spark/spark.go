@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/JODA-Explore/BETZE/dataset"
 	"github.com/JODA-Explore/BETZE/query"
 )
 
@@ -49,6 +51,27 @@ func (Spark) Translate(query query.Query) (query_string string) {
 	// LOAD
 	stages = append(stages, query.BaseName())
 
+	// UNWIND
+	if path := query.UnwindPath(); path != "" {
+		stages = append(stages, translate_unwind(path)...)
+	}
+
+	// JOIN
+	if join := query.GetJoin(); join != nil {
+		stages = append(stages, translate_join(*join))
+	}
+
+	// CHOOSE
+	if filter != nil {
+		filter_step := fmt.Sprintf("where(%s)", translate_predicate(filter))
+		stages = append(stages, filter_step)
+	}
+
+	// TRANSFORM
+	if projection := query.Projection(); projection != nil {
+		stages = append(stages, fmt.Sprintf("select(%s)", translate_projection(*projection)))
+	}
+
 	// AGGREGATE (Select)
 	if agg != nil {
 		agg_str := translate_aggregation(agg)
@@ -58,12 +81,6 @@ func (Spark) Translate(query query.Query) (query_string string) {
 		}
 	}
 
-	// CHOOSE
-	if filter != nil {
-		filter_step := fmt.Sprintf("where(%s)", translate_predicate(filter))
-		stages = append(stages, filter_step)
-	}
-
 	// AGGREGATE (GroupBy)
 	if agg != nil {
 		agg_step := translate_group(agg)
@@ -72,6 +89,20 @@ func (Spark) Translate(query query.Query) (query_string string) {
 		}
 	}
 
+	// ORDER BY, LIMIT
+	// Groups with equal keys are ordered by their group
+	if keys := query.SortKeys(); len(keys) > 0 || query.ResultLimit() > 0 {
+		orders := translate_order(keys)
+		if query.AggregationIsGrouped() {
+			stages = append(stages, fmt.Sprintf("orderBy(%s)", strings.Join(append(orders, "col(\"group\").asc"), ", ")))
+		} else if len(orders) > 0 {
+			stages = append(stages, fmt.Sprintf("orderBy(%s)", strings.Join(orders, ", ")))
+		}
+	}
+	if limit := query.ResultLimit(); limit > 0 {
+		stages = append(stages, fmt.Sprintf("limit(%d)", limit))
+	}
+
 	query_string += strings.Join(stages, ".")
 	query_string += ".show()"
 
@@ -82,7 +113,13 @@ func escape_string(str string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(str, "\\", "\\\\"), "\"", "\\\"")
 }
 
+// The name of the lambda variable holding the current array element
+const element_variable = "x"
+
 func convert_path(path string) string {
+	if dataset.IsElementPath(path) {
+		return convert_element_path(path)
+	}
 	p := strings.ReplaceAll(path, "/", ".")
 	if len(p) > 0 {
 		return fmt.Sprintf("col(\"%s\")", p[1:])
@@ -90,6 +127,17 @@ func convert_path(path string) string {
 	return ""
 }
 
+// Converts a path within array elements to an expression on the lambda variable of the innermost element
+func convert_element_path(path string) string {
+	wildcard := "/" + dataset.ElementWildcard
+	index := strings.LastIndex(path+"/", wildcard+"/")
+	p := element_variable
+	for _, key := range strings.Split(path[index+len(wildcard):], "/")[1:] {
+		p += fmt.Sprintf(".getField(\"%s\")", key)
+	}
+	return p
+}
+
 func convert_path_subelements(path string) string {
 	p := strings.ReplaceAll(path, "/", ".")
 	if len(p) > 0 {
@@ -98,6 +146,39 @@ func convert_path_subelements(path string) string {
 	return ""
 }
 
+// The name of the temporary column holding the unwound array element
+const unwind_column = "element"
+
+// Translates the unwinding of the array at the path into the explosion of the array column.
+// Nested arrays are exploded into a temporary column, which replaces the field of the parent struct afterwards.
+func translate_unwind(path string) []string {
+	keys := strings.Split(path, "/")[1:]
+	if len(keys) == 1 {
+		return []string{fmt.Sprintf("withColumn(\"%s\", explode(%s))", keys[0], convert_path(path))}
+	}
+	return []string{
+		fmt.Sprintf("withColumn(\"%s\", explode(%s))", unwind_column, convert_path(path)),
+		fmt.Sprintf("withColumn(\"%s\", col(\"%s\").withField(\"%s\", col(\"%s\")))", keys[0], keys[0], strings.Join(keys[1:], "."), unwind_column),
+		fmt.Sprintf("drop(\"%s\")", unwind_column),
+	}
+}
+
+// Translates the join into an inner join with the joined dataset.
+// The joined documents are nested into a single struct column first, so that their columns do not clash with the loaded columns.
+func translate_join(join query.Join) string {
+	joined := fmt.Sprintf("%s.select(struct(col(\"*\")).as(\"%s\"))", join.DatasetName(), escape_string(join.Name()))
+	return fmt.Sprintf("join(%s, %s === %s)", joined, convert_path(join.Path), convert_path(join.As+join.ForeignPath))
+}
+
+// Translates a projection into a list of renamed columns
+func translate_projection(projection query.Projection) string {
+	columns := make([]string, len(projection.Attributes))
+	for i, attribute := range projection.Attributes {
+		columns[i] = fmt.Sprintf("%s.as(\"%s\")", convert_path(attribute.Source), escape_string(attribute.Name()))
+	}
+	return strings.Join(columns, ", ")
+}
+
 func translate_cmp_operator(smaller bool, equal bool) string {
 	var cmpstr = ">"
 	if smaller {
@@ -109,35 +190,170 @@ func translate_cmp_operator(smaller bool, equal bool) string {
 	return cmpstr
 }
 
+// Converts a path to a SQL expression path
+func convert_expr_path(path string) string {
+	parts := strings.Split(path, "/")[1:]
+	for i, part := range parts {
+		parts[i] = fmt.Sprintf("`%s`", strings.ReplaceAll(part, "`", "``"))
+	}
+	return strings.Join(parts, ".")
+}
+
+// Translates a type check with the typeof function.
+// typeof returns the type of the column, hence null values have to be excluded.
+// Spark does not distinguish missing from null values, so null checks also select missing paths.
+func translate_type_check(predicate query.TypeCheckPredicate) string {
+	p := convert_expr_path(predicate.Path)
+	var cond string
+	switch predicate.Type {
+	case query.TypeNull:
+		return fmt.Sprintf("(%s.isNull)", convert_path(predicate.Path))
+	case query.TypeBool:
+		cond = fmt.Sprintf("typeof(%s) = 'boolean'", p)
+	case query.TypeInt:
+		// Integral numbers are inferred as double if other values of the column have a fractional part
+		cond = fmt.Sprintf("(typeof(%s) IN ('int', 'bigint') OR ((typeof(%s) = 'double' OR typeof(%s) LIKE 'decimal%%') AND %s = floor(%s)))", p, p, p, p, p)
+	case query.TypeNumber:
+		cond = fmt.Sprintf("(typeof(%s) IN ('int', 'bigint', 'double') OR typeof(%s) LIKE 'decimal%%')", p, p)
+	case query.TypeString:
+		cond = fmt.Sprintf("typeof(%s) = 'string'", p)
+	case query.TypeObject:
+		cond = fmt.Sprintf("typeof(%s) LIKE 'struct%%'", p)
+	case query.TypeArray:
+		cond = fmt.Sprintf("typeof(%s) LIKE 'array%%'", p)
+	}
+	return fmt.Sprintf("(expr(\"%s AND %s IS NOT NULL\"))", escape_string(cond), p)
+}
+
+// Translates the values of an IN predicate to a comma separated list of literals
+func translate_values(predicate query.InPredicate) string {
+	var values []string
+	for _, str := range predicate.Strings {
+		values = append(values, fmt.Sprintf("\"%s\"", escape_string(str)))
+	}
+	for _, number := range predicate.Numbers {
+		values = append(values, fmt.Sprintf("%d", number))
+	}
+	return strings.Join(values, ", ")
+}
+
 func translate_and_predicate(lhs string, rhs string) string {
 	return fmt.Sprintf("(%s && %s)", lhs, rhs)
 }
 
+// Translates the conversion of the timestamp at the path to a SQL timestamp expression.
+// Dates have no time zone and are interpreted in UTC like in the other systems, not in the session time zone.
+func translate_timestamp(path string, format dataset.TemporalFormat) string {
+	switch format {
+	case dataset.FormatDate:
+		return fmt.Sprintf("to_timestamp(concat(%s, 'T00:00:00Z'))", convert_expr_path(path))
+	case dataset.FormatEpochSeconds:
+		return fmt.Sprintf("timestamp_seconds(%s)", convert_expr_path(path))
+	case dataset.FormatEpochMillis:
+		return fmt.Sprintf("timestamp_millis(%s)", convert_expr_path(path))
+	default:
+		return fmt.Sprintf("to_timestamp(%s)", convert_expr_path(path))
+	}
+}
+
+// Timestamps are converted to SQL timestamps and compared with the bounds in UTC
+func translate_temporal(predicate query.TemporalPredicate) string {
+	value_type := query.TypeString
+	if predicate.Format.IsEpoch() {
+		value_type = query.TypeNumber
+	}
+	literal := func(t time.Time) string {
+		return fmt.Sprintf("to_timestamp('%s')", t.UTC().Format(time.RFC3339))
+	}
+	timestamp := translate_timestamp(predicate.Path, predicate.Format)
+	conditions := []string{fmt.Sprintf("%s IS NOT NULL", timestamp)}
+	if predicate.From != nil {
+		conditions = append(conditions, fmt.Sprintf("%s >= %s", timestamp, literal(*predicate.From)))
+	}
+	if predicate.To != nil {
+		conditions = append(conditions, fmt.Sprintf("%s < %s", timestamp, literal(*predicate.To)))
+	}
+	isTimestamp := translate_type_check(query.TypeCheckPredicate{Path: predicate.Path, Type: value_type})
+	return translate_and_predicate(isTimestamp, fmt.Sprintf("(expr(\"%s\"))", escape_string(strings.Join(conditions, " AND "))))
+}
+
+// Translates the grouping columns of a grouped aggregation.
+// The group is named, so that it can be ordered by, multiple keys are grouped by an array of their values.
+func translate_group_keys(group query.GroupedAggregation) string {
+	if len(group.Keys) == 1 {
+		return fmt.Sprintf("%s.as(\"group\")", translate_group_key(group.Keys[0]))
+	}
+	keys := make([]string, len(group.Keys))
+	for i, key := range group.Keys {
+		keys[i] = translate_group_key(key)
+	}
+	return fmt.Sprintf("array(%s).as(\"group\")", strings.Join(keys, ", "))
+}
+
+// Translates a single grouping column.
+// Timestamps are truncated to the start of their bucket in UTC and formatted as ISO-8601 string, numbers are grouped by the lower bound of their bin.
+// Spark truncates and formats timestamps in the session time zone, so they are shifted to show their UTC time in it first.
+func translate_group_key(key query.GroupKey) string {
+	if key.Bins != nil {
+		return fmt.Sprintf("(lit(%v) + floor((%s - %v) / %v) * %v)", key.Bins.Min, convert_path(key.Path), key.Bins.Min, key.Bins.Width, key.Bins.Width)
+	}
+	if key.Bucket == nil {
+		return convert_path(key.Path)
+	}
+	utc := fmt.Sprintf("to_utc_timestamp(%s, current_timezone())", translate_timestamp(key.Path, key.Bucket.Format))
+	return fmt.Sprintf("expr(\"%s\")", escape_string(fmt.Sprintf("date_format(date_trunc('%s', %s), \"yyyy-MM-dd'T'HH:mm:ss'Z'\")", key.Bucket.Unit, utc)))
+}
+
 func translate_predicate(predicate query.Predicate) string {
 	switch v := predicate.(type) {
 	case query.AndPredicate:
 		return translate_and_predicate(translate_predicate(v.Lhs), translate_predicate(v.Rhs))
 	case query.OrPredicate:
 		return fmt.Sprintf("(%s || %s)", translate_predicate(v.Lhs), translate_predicate(v.Rhs))
+	case query.NotPredicate:
+		// Comparisons with missing paths are null, which has to be selected by the negation
+		return fmt.Sprintf("not(coalesce(%s, lit(false)))", translate_predicate(v.Predicate))
 	case query.IntEqualityPredicate:
 		return fmt.Sprintf("(%s === %d)", convert_path(v.Path), v.Number)
 	case query.FloatComparisonPredicate:
 		return fmt.Sprintf("(%s %s %f)", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.RangePredicate:
+		p := convert_path(v.Path)
+		return fmt.Sprintf("(%s %s %f && %s %s %f)", p, translate_cmp_operator(false, v.LowerInclusive), v.Lower, p, translate_cmp_operator(true, v.UpperInclusive), v.Upper)
 	case query.StrEqualityPredicate:
-		return fmt.Sprintf("(%s === %s)", convert_path(v.Path), v.Str)
+		return fmt.Sprintf("(%s === \"%s\")", convert_path(v.Path), escape_string(v.Str))
+	case query.InPredicate:
+		return fmt.Sprintf("(%s.isin(%s))", convert_path(v.Path), translate_values(v))
 	case query.StrPrefixPredicate:
 		return fmt.Sprintf("(%s.startsWith(\"%s\"))", convert_path(v.Path), escape_string(v.Prefix))
+	case query.StrContainsPredicate:
+		return fmt.Sprintf("(%s.contains(\"%s\"))", convert_path(v.Path), escape_string(v.Substring))
+	case query.StrRegexPredicate:
+		return fmt.Sprintf("(%s.rlike(\"%s\"))", convert_path(v.Path), escape_string(v.Regex()))
 	case query.ExistsPredicate:
 		return fmt.Sprintf("(%s.isNotNull)", convert_path(v.Path))
-	case query.IsStringPredicate:
-		p := convert_path(v.Path)
-		return fmt.Sprintf("not(%s === \"true\" || %s === \"false\" || %s.isNull || %s.cast(\"int\").isNotNull)", p, p, p, p)
+	case query.TypeCheckPredicate:
+		return translate_type_check(v)
 	case query.BoolEqualityPredicate:
 		return fmt.Sprintf("(%s === %t)", convert_path(v.Path), v.Value)
 	case query.ObjectSizeComparisonPredicate:
 		return fmt.Sprintf("size(array(%s)) %s %d", convert_path_subelements(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
 	case query.ArraySizeComparisonPredicate:
 		return fmt.Sprintf("size(%s) %s %d", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.StrLengthComparisonPredicate:
+		return fmt.Sprintf("length(%s) %s %d", convert_path(v.Path), translate_cmp_operator(v.Smaller, v.Equal), v.Number)
+	case query.TemporalPredicate:
+		return translate_temporal(v)
+	case query.PathComparisonPredicate:
+		// Spark casts mixed types implicitly, so both values have to be numbers
+		isNumber := translate_and_predicate(translate_type_check(query.TypeCheckPredicate{Path: v.Lhs, Type: query.TypeNumber}), translate_type_check(query.TypeCheckPredicate{Path: v.Rhs, Type: query.TypeNumber}))
+		return translate_and_predicate(isNumber, fmt.Sprintf("(%s %s %s)", convert_path(v.Lhs), translate_cmp_operator(v.Smaller, v.Equal), convert_path(v.Rhs)))
+	case query.PathStrEqualityPredicate:
+		isString := translate_and_predicate(translate_type_check(query.TypeCheckPredicate{Path: v.Lhs, Type: query.TypeString}), translate_type_check(query.TypeCheckPredicate{Path: v.Rhs, Type: query.TypeString}))
+		return translate_and_predicate(isString, fmt.Sprintf("(%s === %s)", convert_path(v.Lhs), convert_path(v.Rhs)))
+	case query.AnyElementPredicate:
+		// Element paths of the sub-predicate refer to the lambda variable
+		return fmt.Sprintf("exists(%s, %s => %s)", convert_path(v.Path), element_variable, translate_predicate(v.Predicate))
 	default:
 		log.Printf("Error: Missing predicate type translation: %s", predicate.String())
 		return ""
@@ -148,20 +364,60 @@ func translate_predicate(predicate query.Predicate) string {
 func translate_aggregation(agg query.Aggregation) (query_string string) {
 	switch v := agg.(type) {
 	case query.GlobalCountAggregation:
-		return "count()"
+		return "count(lit(1))"
 	case query.CountAggregation:
 		return fmt.Sprintf("count(%s)", convert_path(v.Path))
 	case query.SumAggregation:
 		return fmt.Sprintf("sum(%s)", convert_path(v.Path))
+	case query.MinAggregation:
+		return fmt.Sprintf("min(%s)", translate_typed_value(v.Path, v.Type))
+	case query.MaxAggregation:
+		return fmt.Sprintf("max(%s)", translate_typed_value(v.Path, v.Type))
+	case query.AvgAggregation:
+		return fmt.Sprintf("avg(%s)", convert_path(v.Path))
+	case query.DistinctCountAggregation:
+		return fmt.Sprintf("countDistinct(%s)", convert_path(v.Path))
+	case query.MultiAggregation:
+		aggs := make([]string, len(v.Aggs))
+		for i, named := range v.Aggs {
+			aggs[i] = fmt.Sprintf("%s.as(\"%s\")", translate_aggregation(named.Agg), escape_string(named.Name))
+		}
+		return strings.Join(aggs, ", ")
 	default:
 		return
 	}
 }
 
+// Translates the value at the path if it has the given type, otherwise null, which is ignored by aggregations
+func translate_typed_value(path string, t query.JSONType) string {
+	return fmt.Sprintf("when(%s, %s)", translate_type_check(query.TypeCheckPredicate{Path: path, Type: t}), convert_path(path))
+}
+
+// Translates the order of the result, missing values are ordered first in ascending and last in descending order
+func translate_order(keys []query.SortKey) []string {
+	orders := make([]string, len(keys))
+	for i, key := range keys {
+		column := fmt.Sprintf("col(\"%s\")", escape_string(key.Aggregation))
+		if !key.IsAggregation() {
+			column = convert_path(key.Path)
+		}
+		if key.Descending {
+			orders[i] = column + ".desc"
+		} else {
+			orders[i] = column + ".asc"
+		}
+	}
+	return orders
+}
+
 func translate_group(agg query.Aggregation) (query_string string) {
 	var group, isgroup = agg.(query.GroupedAggregation)
 	if isgroup { // If grouped aggregation, translate sub-aggregations
-		return fmt.Sprintf("groupBy(%s).%s", convert_path(group.Path), translate_aggregation(group.Agg))
+		if _, ismulti := group.Agg.(query.MultiAggregation); ismulti {
+			return fmt.Sprintf("groupBy(%s).agg(%s)", translate_group_keys(group), translate_aggregation(group.Agg))
+		}
+		// The aggregation is named, so that the groups can be ordered by it
+		return fmt.Sprintf("groupBy(%s).agg(%s.as(\"%s\"))", translate_group_keys(group), translate_aggregation(group.Agg), escape_string(group.Name()))
 	}
 	return
 }
@@ -0,0 +1,158 @@
+package spark
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+	"github.com/JODA-Explore/BETZE/query"
+)
+
+// The queries are translated to Spark with every predicate, aggregation and query stage
+func TestTranslate(t *testing.T) {
+	base := &dataset.DataSet{Name: "base"}
+	users := &dataset.DataSet{Name: "users"}
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	count := query.NamedAggregation{Name: "count", Agg: query.GlobalCountAggregation{}}
+	sum := query.NamedAggregation{Name: "sum", Agg: query.SumAggregation{Path: "/n"}}
+	tests := []struct {
+		name  string
+		query *query.Query
+		want  string
+	}{
+		{
+			name:  "negation",
+			query: new(query.Query).Load(base).Filter(query.NotPredicate{Predicate: query.ExistsPredicate{Path: "/a"}}),
+			want:  `base.where(not(coalesce((col("a").isNotNull), lit(false)))).show()`,
+		},
+		{
+			name:  "string equality",
+			query: new(query.Query).Load(base).Filter(query.StrEqualityPredicate{Path: "/s", Str: "x"}),
+			want:  `base.where((col("s") === "x")).show()`,
+		},
+		{
+			name:  "range",
+			query: new(query.Query).Load(base).Filter(query.RangePredicate{Path: "/n", Lower: 1, Upper: 5, LowerInclusive: true}),
+			want:  `base.where((col("n") >= 1.000000 && col("n") < 5.000000)).show()`,
+		},
+		{
+			name:  "substring",
+			query: new(query.Query).Load(base).Filter(query.StrContainsPredicate{Path: "/s", Substring: "ab"}),
+			want:  `base.where((col("s").contains("ab"))).show()`,
+		},
+		{
+			name:  "regular expression",
+			query: new(query.Query).Load(base).Filter(query.StrRegexPredicate{Path: "/s", Prefix: "a", Infixes: []string{"b"}}),
+			want:  `base.where((col("s").rlike("^a.*b"))).show()`,
+		},
+		{
+			name:  "type check",
+			query: new(query.Query).Load(base).Filter(query.TypeCheckPredicate{Path: "/o", Type: query.TypeObject}),
+			want:  "base.where((expr(\"typeof(`o`) LIKE 'struct%' AND `o` IS NOT NULL\"))).show()",
+		},
+		{
+			name:  "any element",
+			query: new(query.Query).Load(base).Filter(query.AnyElementPredicate{Path: "/tags", Predicate: query.StrEqualityPredicate{Path: dataset.ElementPath("/tags"), Str: "x"}}),
+			want:  `base.where(exists(col("tags"), x => (x === "x"))).show()`,
+		},
+		{
+			name:  "in",
+			query: new(query.Query).Load(base).Filter(query.InPredicate{Path: "/s", Strings: []string{"a", "b"}}),
+			want:  `base.where((col("s").isin("a", "b"))).show()`,
+		},
+		{
+			name:  "string length",
+			query: new(query.Query).Load(base).Filter(query.StrLengthComparisonPredicate{Path: "/s", Number: 3, Smaller: true}),
+			want:  `base.where(length(col("s")) < 3).show()`,
+		},
+		{
+			name:  "path comparison",
+			query: new(query.Query).Load(base).Filter(query.PathComparisonPredicate{Lhs: "/n", Rhs: "/m", Smaller: true, Equal: true}),
+			want:  "base.where((((expr(\"(typeof(`n`) IN ('int', 'bigint', 'double') OR typeof(`n`) LIKE 'decimal%') AND `n` IS NOT NULL\")) && (expr(\"(typeof(`m`) IN ('int', 'bigint', 'double') OR typeof(`m`) LIKE 'decimal%') AND `m` IS NOT NULL\"))) && (col(\"n\") <= col(\"m\")))).show()",
+		},
+		{
+			name:  "path string equality",
+			query: new(query.Query).Load(base).Filter(query.PathStrEqualityPredicate{Lhs: "/s", Rhs: "/t"}),
+			want:  "base.where((((expr(\"typeof(`s`) = 'string' AND `s` IS NOT NULL\")) && (expr(\"typeof(`t`) = 'string' AND `t` IS NOT NULL\"))) && (col(\"s\") === col(\"t\")))).show()",
+		},
+		{
+			name:  "temporal range",
+			query: new(query.Query).Load(base).Filter(query.TemporalPredicate{Path: "/d", Format: dataset.FormatDate, From: &from, To: &to}),
+			want:  "base.where(((expr(\"typeof(`d`) = 'string' AND `d` IS NOT NULL\")) && (expr(\"to_timestamp(concat(`d`, 'T00:00:00Z')) IS NOT NULL AND to_timestamp(concat(`d`, 'T00:00:00Z')) >= to_timestamp('2021-01-01T00:00:00Z') AND to_timestamp(concat(`d`, 'T00:00:00Z')) < to_timestamp('2021-07-01T00:00:00Z')\")))).show()",
+		},
+		{
+			name:  "minimum",
+			query: new(query.Query).Load(base).Aggregate(query.MinAggregation{Path: "/n", Type: query.TypeNumber}),
+			want:  "base.select(min(when((expr(\"(typeof(`n`) IN ('int', 'bigint', 'double') OR typeof(`n`) LIKE 'decimal%') AND `n` IS NOT NULL\")), col(\"n\")))).show()",
+		},
+		{
+			name:  "maximum",
+			query: new(query.Query).Load(base).Aggregate(query.MaxAggregation{Path: "/s", Type: query.TypeString}),
+			want:  "base.select(max(when((expr(\"typeof(`s`) = 'string' AND `s` IS NOT NULL\")), col(\"s\")))).show()",
+		},
+		{
+			name:  "average",
+			query: new(query.Query).Load(base).Aggregate(query.AvgAggregation{Path: "/n"}),
+			want:  `base.select(avg(col("n"))).show()`,
+		},
+		{
+			name:  "distinct count",
+			query: new(query.Query).Load(base).Aggregate(query.DistinctCountAggregation{Path: "/s"}),
+			want:  `base.select(countDistinct(col("s"))).show()`,
+		},
+		{
+			name:  "multiple aggregations",
+			query: new(query.Query).Load(base).Aggregate(query.MultiAggregation{Aggs: []query.NamedAggregation{count, sum}}),
+			want:  `base.select(count(lit(1)).as("count"), sum(col("n")).as("sum")).show()`,
+		},
+		{
+			name:  "group by multiple keys",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}, {Path: "/t"}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `base.groupBy(array(col("s"), col("t")).as("group")).agg(count(lit(1)).as("count")).show()`,
+		},
+		{
+			name:  "group by bins",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/n", Bins: &query.NumericBins{Min: 0, Width: 10, Count: 3}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  `base.groupBy((lit(0) + floor((col("n") - 0) / 10) * 10).as("group")).agg(count(lit(1)).as("count")).show()`,
+		},
+		{
+			name:  "group by date buckets",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/d", Bucket: &query.DateBucket{Format: dataset.FormatDate, Unit: dataset.GranularityMonth}}}, Agg: query.GlobalCountAggregation{}}),
+			want:  "base.groupBy(expr(\"date_format(date_trunc('month', to_utc_timestamp(to_timestamp(concat(`d`, 'T00:00:00Z')), current_timezone())), \\\"yyyy-MM-dd'T'HH:mm:ss'Z'\\\")\").as(\"group\")).agg(count(lit(1)).as(\"count\")).show()",
+		},
+		{
+			name:  "order and limit",
+			query: new(query.Query).Load(base).OrderBy(query.SortKey{Path: "/n", Type: query.TypeNumber, Descending: true}, query.SortKey{Path: "/s", Type: query.TypeString}).Limit(10),
+			want:  `base.orderBy(col("n").desc, col("s").asc).limit(10).show()`,
+		},
+		{
+			name:  "order groups",
+			query: new(query.Query).Load(base).Aggregate(query.GroupedAggregation{Keys: []query.GroupKey{{Path: "/s"}}, Agg: query.GlobalCountAggregation{}}).OrderBy(query.SortKey{Aggregation: "count", Descending: true}).Limit(5),
+			want:  `base.groupBy(col("s").as("group")).agg(count(lit(1)).as("count")).orderBy(col("count").desc, col("group").asc).limit(5).show()`,
+		},
+		{
+			name:  "projection",
+			query: new(query.Query).Load(base).Transform(&query.Projection{Attributes: []query.ProjectedAttribute{{Source: "/a/b", Target: "/b"}, {Source: "/n", Target: "/n"}}}),
+			want:  `base.select(col("a.b").as("b"), col("n").as("n")).show()`,
+		},
+		{
+			name:  "unwind",
+			query: new(query.Query).Load(base).Unwind("/tags"),
+			want:  `base.withColumn("tags", explode(col("tags"))).show()`,
+		},
+		{
+			name:  "join",
+			query: new(query.Query).Load(base).Join(&query.Join{Dataset: users, Path: "/uid", ForeignPath: "/id", As: "/users"}),
+			want:  `base.join(users.select(struct(col("*")).as("users")), col("uid") === col("users.id")).show()`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Spark{}.Translate(*test.query)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package query
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+)
 
 // A Aggregation represents operations performed during the aggregation phase
 type Aggregation interface {
@@ -15,20 +20,77 @@ type Aggregation interface {
  */
 
 type GroupedAggregation struct {
-	// The path to aggregate
-	Path string
+	// The keys to group by, documents with equal values for all keys form a group
+	Keys []GroupKey
 	// Subaggregation to use
 	Agg Aggregation
 }
 
 func (q GroupedAggregation) String() string {
-	return fmt.Sprintf("%s GROUP BY '%s'", q.Agg.String(), q.Path)
+	keys := make([]string, len(q.Keys))
+	for i, key := range q.Keys {
+		keys[i] = key.String()
+	}
+	return fmt.Sprintf("%s GROUP BY %s", q.Agg.String(), strings.Join(keys, ", "))
 }
 
 func (q GroupedAggregation) Name() string {
 	return q.Agg.Name()
 }
 
+// Path returns the path of the first grouping key, the only one before grouping by multiple keys was supported
+func (q GroupedAggregation) Path() string {
+	if len(q.Keys) == 0 {
+		return ""
+	}
+	return q.Keys[0].Path
+}
+
+// GroupKey is a single value the documents are grouped by
+type GroupKey struct {
+	// The path to group by
+	Path string `json:"path"`
+	// Optional bucketing of the timestamps at the path, the values are grouped as they are if nil
+	Bucket *DateBucket `json:"bucket,omitempty"`
+	// Optional binning of the numbers at the path, the values are grouped as they are if nil
+	Bins *NumericBins `json:"bins,omitempty"`
+}
+
+func (k GroupKey) String() string {
+	if k.Bins != nil {
+		return fmt.Sprintf("BIN('%s', %v, %v)", k.Path, k.Bins.Min, k.Bins.Width)
+	}
+	if k.Bucket != nil {
+		return fmt.Sprintf("%s('%s')", strings.ToUpper(string(k.Bucket.Unit)), k.Path)
+	}
+	return fmt.Sprintf("'%s'", k.Path)
+}
+
+// DateBucket groups timestamps by the unit of time they fall into
+type DateBucket struct {
+	// The representation of the timestamps at the grouped path
+	Format dataset.TemporalFormat
+	// The unit the timestamps are truncated to
+	Unit dataset.Granularity
+}
+
+// NumericBins groups numbers into bins of equal width, starting at Min.
+// A number belongs to the bin i = floor((number - Min) / Width) and is grouped by the lower bound Min + i * Width of its bin.
+// Numbers outside of the Count bins are not clamped, they are grouped by the lower bound of their own bin.
+type NumericBins struct {
+	// The lower bound of the first bin
+	Min float64 `json:"min"`
+	// The width of each bin
+	Width float64 `json:"width"`
+	// The number of bins covering all numbers at the path, from Min to Min + Count * Width (exclusive)
+	Count int `json:"count"`
+}
+
+// Bound returns the lower bound of the bin i
+func (b NumericBins) Bound(i int) float64 {
+	return b.Min + float64(i)*b.Width
+}
+
 /*
 * COUNT
  */
@@ -75,3 +137,124 @@ func (q SumAggregation) String() string {
 func (q SumAggregation) Name() string {
 	return "sum"
 }
+
+/*
+* MIN
+ */
+
+type MinAggregation struct {
+	// The path to aggregate
+	Path string
+	// The type of the compared values, either TypeNumber or TypeString. Values of other types are ignored.
+	Type JSONType
+}
+
+func (q MinAggregation) String() string {
+	if q.Type == TypeString {
+		return fmt.Sprintf("MIN(STRING('%s'))", q.Path)
+	}
+	return fmt.Sprintf("MIN('%s')", q.Path)
+}
+
+func (q MinAggregation) Name() string {
+	return "min"
+}
+
+/*
+* MAX
+ */
+
+type MaxAggregation struct {
+	// The path to aggregate
+	Path string
+	// The type of the compared values, either TypeNumber or TypeString. Values of other types are ignored.
+	Type JSONType
+}
+
+func (q MaxAggregation) String() string {
+	if q.Type == TypeString {
+		return fmt.Sprintf("MAX(STRING('%s'))", q.Path)
+	}
+	return fmt.Sprintf("MAX('%s')", q.Path)
+}
+
+func (q MaxAggregation) Name() string {
+	return "max"
+}
+
+/*
+* AVG
+ */
+
+type AvgAggregation struct {
+	// The path to aggregate
+	Path string
+}
+
+func (q AvgAggregation) String() string {
+	return fmt.Sprintf("AVG('%s')", q.Path)
+}
+
+func (q AvgAggregation) Name() string {
+	return "avg"
+}
+
+/*
+* DISTINCT
+ */
+
+// DistinctCountAggregation counts the distinct values at the path, null values are not counted
+type DistinctCountAggregation struct {
+	// The path to aggregate
+	Path string
+}
+
+func (q DistinctCountAggregation) String() string {
+	return fmt.Sprintf("COUNT(DISTINCT '%s')", q.Path)
+}
+
+func (q DistinctCountAggregation) Name() string {
+	return "distinct"
+}
+
+/*
+* MULTIPLE
+ */
+
+// MultiAggregation computes several aggregations over the same documents, or the same groups if used within a GroupedAggregation.
+// Each aggregation is stored in the attribute of its name, hence the names have to be unique.
+type MultiAggregation struct {
+	Aggs []NamedAggregation
+}
+
+// NamedAggregation is an aggregation stored in the attribute of the given name
+type NamedAggregation struct {
+	// The target name of the attribute
+	Name string
+	// The aggregation, neither grouped nor multiple
+	Agg Aggregation
+}
+
+func (q MultiAggregation) String() string {
+	aggs := make([]string, len(q.Aggs))
+	for i, agg := range q.Aggs {
+		aggs[i] = fmt.Sprintf("%s AS %s", agg.Agg.String(), agg.Name)
+	}
+	return strings.Join(aggs, ", ")
+}
+
+func (q MultiAggregation) Name() string {
+	names := make([]string, len(q.Aggs))
+	for i, agg := range q.Aggs {
+		names[i] = agg.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// NamedAggregations returns the aggregations computed by an ungrouped aggregation together with their attribute names
+func NamedAggregations(agg Aggregation) []NamedAggregation {
+	if multi, ok := agg.(MultiAggregation); ok {
+		return multi.Aggs
+	}
+	return []NamedAggregation{{Name: agg.Name(), Agg: agg}}
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+)
+
+// Join nests the documents of another dataset into the loaded documents with equal values at the join paths.
+// Each loaded document is joined with each matching document, documents without matching document are removed.
+// Only strings and numbers are joined.
+type Join struct {
+	// The dataset to join with
+	Dataset *dataset.DataSet
+	// The path of the join value in the loaded documents
+	Path string
+	// The path of the join value in the joined documents
+	ForeignPath string
+	// The top-level path of the joined document in the resulting documents
+	As string
+}
+
+// Name returns the name of the attribute holding the joined document
+func (j Join) Name() string {
+	return strings.TrimPrefix(j.As, "/")
+}
+
+// DatasetName returns the name of the joined dataset
+func (j Join) DatasetName() string {
+	if j.Dataset != nil {
+		return j.Dataset.Name
+	}
+	return ""
+}
+
+func (j Join) String() string {
+	return fmt.Sprintf("%s ON '%s' == '%s' AS '%s'", j.DatasetName(), j.Path, j.ForeignPath, j.As)
+}
+
+// JoinDataSet returns the estimated statistics of joining the dataset with the joined dataset.
+// The paths of the joined dataset are moved below the attribute of the joined document, all paths keep the statistics of their original documents.
+func (j Join) JoinDataSet(d dataset.DataSet) dataset.DataSet {
+	paths := make(map[string]*dataset.DataPath)
+	for path, data_path := range d.Paths {
+		paths[path] = data_path
+	}
+	var size uint64
+	if j.Dataset != nil {
+		for path, data_path := range j.Dataset.Paths {
+			joined_path := *data_path
+			joined_path.Path = j.As + path
+			paths[joined_path.Path] = &joined_path
+		}
+		local, local_ok := d.Paths[j.Path]
+		foreign, foreign_ok := j.Dataset.Paths[j.ForeignPath]
+		if local_ok && foreign_ok && local != nil && foreign != nil {
+			size, _ = EstimateJoinSize(*local, *foreign)
+		}
+	}
+	return dataset.DataSet{
+		Name:          d.Name,
+		Count:         nil,
+		ExpectedCount: size,
+		Paths:         paths,
+		DerivedFrom:   d.DerivedFrom,
+	}
+}
+
+// EstimateJoinSize estimates the number of document pairs, one of each path, with equal strings or integers at the paths.
+// The values of both paths are assumed to be independent.
+// If the paths share no type with known distribution, false is returned.
+func EstimateJoinSize(local dataset.DataPath, foreign dataset.DataPath) (uint64, bool) {
+	size := 0.0
+	joinable := false
+	if local.HasStringCount() && foreign.HasStringCount() {
+		if fraction, ok := local.Stringtype.EqualityFraction(foreign.Stringtype); ok {
+			size += fraction * float64(*local.Stringtype.Count) * float64(*foreign.Stringtype.Count)
+			joinable = true
+		}
+	}
+	if local.HasIntCount() && foreign.HasIntCount() {
+		if fraction, ok := local.Inttype.EqualityFraction(foreign.Inttype); ok {
+			size += fraction * float64(*local.Inttype.Count) * float64(*foreign.Inttype.Count)
+			joinable = true
+		}
+	}
+	return uint64(size), joinable
+}
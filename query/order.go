@@ -0,0 +1,32 @@
+package query
+
+import "fmt"
+
+// SortKey orders the results of a query by a single value.
+// Missing and null values are ordered before all other values.
+type SortKey struct {
+	// The path of the documents to sort by, if the query is not aggregated
+	Path string `json:"path,omitempty"`
+	// The type of the values at the path, the path contains no other values except null
+	Type JSONType `json:"type,omitempty"`
+	// The name of the aggregation to sort the groups by, if the query is aggregated
+	Aggregation string `json:"aggregation,omitempty"`
+	// Whether to sort descending instead of ascending
+	Descending bool `json:"descending,omitempty"`
+}
+
+// IsAggregation checks whether the key orders by an aggregation instead of a path
+func (k SortKey) IsAggregation() bool {
+	return k.Aggregation != ""
+}
+
+func (k SortKey) String() string {
+	direction := "ASC"
+	if k.Descending {
+		direction = "DESC"
+	}
+	if k.IsAggregation() {
+		return fmt.Sprintf("%s %s", k.Aggregation, direction)
+	}
+	return fmt.Sprintf("'%s' %s", k.Path, direction)
+}
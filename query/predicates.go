@@ -3,7 +3,9 @@ package query
 import (
 	"fmt"
 	"math"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/JODA-Explore/BETZE/dataset"
 )
@@ -52,6 +54,21 @@ func (p OrPredicate) Selectivity(d dataset.DataSet) float64 {
 	return math.Min(lhs+rhs, 1.0)
 }
 
+// NotPredicate negates a predicate.
+// Documents missing the paths of the negated predicate are selected.
+type NotPredicate struct {
+	Predicate Predicate
+}
+
+func (q NotPredicate) String() string {
+	return fmt.Sprintf("NOT(%s)", q.Predicate.String())
+}
+
+// Selectivity implements Predicate.Selectivity by inverting the selectivity of the sub-predicate
+func (p NotPredicate) Selectivity(d dataset.DataSet) float64 {
+	return 1.0 - p.Predicate.Selectivity(d)
+}
+
 // Predicate evaluating the existence of the given path
 type ExistsPredicate struct {
 	Path string
@@ -74,26 +91,114 @@ func (p ExistsPredicate) Selectivity(d dataset.DataSet) float64 {
 	return float64(*dataPath.Count) / float64(d.GetSize())
 }
 
-// Predicate evaluating the type of the given path
-type IsStringPredicate struct {
+// JSONType is the type of a JSON value
+type JSONType int
+
+const (
+	TypeNull JSONType = iota
+	TypeBool
+	// Integral numbers
+	TypeInt
+	// All numbers, including integers
+	TypeNumber
+	TypeString
+	TypeObject
+	TypeArray
+)
+
+var jsonTypeNames = []string{"Null", "Bool", "Int", "Number", "String", "Object", "Array"}
+
+// AllJSONTypes returns all types in the order of their declaration
+func AllJSONTypes() []JSONType {
+	return []JSONType{TypeNull, TypeBool, TypeInt, TypeNumber, TypeString, TypeObject, TypeArray}
+}
+
+func (t JSONType) String() string {
+	if t < 0 || int(t) >= len(jsonTypeNames) {
+		return fmt.Sprintf("JSONType(%d)", int(t))
+	}
+	return jsonTypeNames[t]
+}
+
+// MarshalText implements encoding.TextMarshaler, the type is stored by name
+func (t JSONType) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(jsonTypeNames) {
+		return nil, fmt.Errorf("unknown JSON type %d", int(t))
+	}
+	return []byte(jsonTypeNames[t]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (t *JSONType) UnmarshalText(text []byte) error {
+	for i, name := range jsonTypeNames {
+		if strings.EqualFold(name, string(text)) {
+			*t = JSONType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown JSON type '%s'", string(text))
+}
+
+// Count returns the number of values of the type at the data path, or nil if it is not known.
+// The second return value is false if the type does not exist at the path.
+func (t JSONType) Count(p dataset.DataPath) (*uint64, bool) {
+	switch t {
+	case TypeNull:
+		if p.Nulltype != nil {
+			return p.Nulltype.Count, true
+		}
+	case TypeBool:
+		if p.Booltype != nil {
+			return p.Booltype.Count, true
+		}
+	case TypeInt:
+		if p.Inttype != nil {
+			return p.Inttype.Count, true
+		}
+	case TypeNumber:
+		if p.Floattype != nil {
+			return p.Floattype.Count, true
+		}
+	case TypeString:
+		if p.Stringtype != nil {
+			return p.Stringtype.Count, true
+		}
+	case TypeObject:
+		if p.Objecttype != nil {
+			return p.Objecttype.Count, true
+		}
+	case TypeArray:
+		if p.Arraytype != nil {
+			return p.Arraytype.Count, true
+		}
+	}
+	return nil, false
+}
+
+// TypeCheckPredicate checks if the value at the given path has the given type.
+// Missing paths are not of any type, in particular they are not null.
+type TypeCheckPredicate struct {
 	Path string
+	Type JSONType
 }
 
-func (q IsStringPredicate) String() string {
-	return fmt.Sprintf("ISSTRING('%s')", q.Path)
+func (q TypeCheckPredicate) String() string {
+	return fmt.Sprintf("IS%s('%s')", strings.ToUpper(q.Type.String()), q.Path)
 }
 
-func (p IsStringPredicate) Selectivity(d dataset.DataSet) float64 {
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPath with matching type and path exists, 0 is returned
+// Otherwise the fraction of documents having a value of the type at the path is returned.
+func (p TypeCheckPredicate) Selectivity(d dataset.DataSet) float64 {
 	dataPath := d.Paths[p.Path]
-	if dataPath == nil || dataPath.Stringtype == nil {
+	if dataPath == nil {
 		return 0.0
 	}
-	strType := dataPath.Stringtype
-	if strType.Count != nil {
-		return getTypeSelectivity(d, strType.Count)
+	count, ok := p.Type.Count(*dataPath)
+	if !ok {
+		return 0.0
 	}
-
-	return float64(*dataPath.Count) / float64(d.GetSize())
+	return getTypeSelectivity(d, count)
 }
 
 // IntEqualityPredicate evaluates the Number equality operation between a path and a given number
@@ -109,6 +214,8 @@ func (q IntEqualityPredicate) String() string {
 // Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
 // If no DataPath with matching type and path exists, 0 is returned
 // If a data path exists, but has no count, 0.01 is assumed and returned (predicate selects 1% of all documents)
+// If the most common values or a histogram are known, they are used to estimate the selectivity.
+// If the number of distinct values is known, a uniform distribution among them is assumed.
 // If a count exists, equality assumes that exactly one element is chosen, hence a selectivity of 1/count is returned.
 // If min and max exists, a uniform distribution is assumed if the value is within the bounds and a selectivity of (1/(max-min)) is returned.
 func (p IntEqualityPredicate) Selectivity(d dataset.DataSet) float64 {
@@ -127,6 +234,12 @@ func (p IntEqualityPredicate) Selectivity(d dataset.DataSet) float64 {
 	if intType.Count == nil {
 		return 0.01 * typeSelectivity
 	}
+	if fraction, ok := intType.ValueFraction(p.Number); ok {
+		return fraction * typeSelectivity
+	}
+	if intType.Unique != nil && *intType.Unique > 0 {
+		return (1.0 / float64(*intType.Unique)) * typeSelectivity
+	}
 	if intType.Min != nil && intType.Max != nil {
 		return (1.0 / float64((*intType.Max-*intType.Min)+1)) * typeSelectivity
 	}
@@ -155,6 +268,7 @@ func (q FloatComparisonPredicate) String() string {
 // Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
 // If no DataPath with matching type and path exists, 0 is returned
 // If a data path exists, but has no count, 0.33333 is assumed and returned (predicate selects 1/3 of all documents)
+// If a histogram exists, the fraction of numbers within the compared range is estimated with it.
 // If min and max exists, a uniform distribution is assumed if the value is within the bounds and a selectivity of (1/(max-min)) is returned.
 func (p FloatComparisonPredicate) Selectivity(d dataset.DataSet) float64 {
 	dataPath := d.Paths[p.Path]
@@ -177,6 +291,14 @@ func (p FloatComparisonPredicate) Selectivity(d dataset.DataSet) float64 {
 		return 1.0 * typeSelectivity
 
 	}
+	if floatType.Histogram != nil {
+		// The histogram contains all numbers, including integers
+		numSelectivity := getTypeSelectivity(d, floatType.Count)
+		if p.Smaller {
+			return floatType.Histogram.FractionBelow(p.Number, p.Equal) * numSelectivity
+		}
+		return (1.0 - floatType.Histogram.FractionBelow(p.Number, !p.Equal)) * numSelectivity
+	}
 	if floatType.Min != nil && floatType.Max != nil {
 		// TODO Equal?
 		abs := (float64(p.Number-*floatType.Min) + 1.0) / (float64(*floatType.Max-*floatType.Min) + 1.0)
@@ -188,6 +310,61 @@ func (p FloatComparisonPredicate) Selectivity(d dataset.DataSet) float64 {
 	return (1.0 / 3.0) * typeSelectivity
 }
 
+// RangePredicate checks if a path contains a number between a lower and an upper bound
+type RangePredicate struct {
+	Path           string
+	Lower          float64
+	Upper          float64
+	LowerInclusive bool
+	UpperInclusive bool
+}
+
+func (q RangePredicate) String() string {
+	var lowerstr = "<"
+	if q.LowerInclusive {
+		lowerstr += "="
+	}
+	var upperstr = "<"
+	if q.UpperInclusive {
+		upperstr += "="
+	}
+	return fmt.Sprintf("%f %s '%s' %s %f", q.Lower, lowerstr, q.Path, upperstr, q.Upper)
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPath with matching type and path exists, or the range is empty, 0 is returned
+// If a histogram exists, the fraction of numbers within the range is estimated with it.
+// If min and max exists, a uniform distribution is assumed and the overlap of the range with [min, max] is returned.
+// Otherwise 0.33333 is assumed and returned (predicate selects 1/3 of all documents)
+func (p RangePredicate) Selectivity(d dataset.DataSet) float64 {
+	dataPath := d.Paths[p.Path]
+	if dataPath == nil || dataPath.Floattype == nil {
+		return 0.0
+	}
+	floatType := dataPath.Floattype
+	// The float type contains all numbers, including integers
+	typeSelectivity := getTypeSelectivity(d, floatType.Count)
+	if p.Lower > p.Upper || (p.Lower == p.Upper && !(p.LowerInclusive && p.UpperInclusive)) {
+		return 0.0
+	}
+	if floatType.Histogram != nil {
+		fraction := floatType.Histogram.FractionBelow(p.Upper, p.UpperInclusive) - floatType.Histogram.FractionBelow(p.Lower, !p.LowerInclusive)
+		return math.Max(fraction, 0.0) * typeSelectivity
+	}
+	if floatType.Min != nil && floatType.Max != nil {
+		if p.Upper < *floatType.Min || p.Lower > *floatType.Max {
+			return 0.0
+		}
+		if *floatType.Min == *floatType.Max {
+			return 1.0 * typeSelectivity
+		}
+		lower := math.Max(p.Lower, *floatType.Min)
+		upper := math.Min(p.Upper, *floatType.Max)
+		return ((upper - lower) / (*floatType.Max - *floatType.Min)) * typeSelectivity
+	}
+	return (1.0 / 3.0) * typeSelectivity
+}
+
 // StrEqualityPredicate evaluates the String equality operation between a path and a given string
 type StrEqualityPredicate struct {
 	Path string
@@ -201,8 +378,9 @@ func (q StrEqualityPredicate) String() string {
 // Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
 // If no DataPath with matching type and path exists, 0 is returned
 // If a data path exists, but has no count, 0.01 is assumed and returned (predicate selects 1% of all documents)
+// If the most common values are known, their frequency is used to estimate the selectivity.
+// If the number of distinct values is known, a uniform distribution among them is assumed.
 // If a count exists, equality assumes that exactly one element is chosen, hence a selectivity of 1/count is returned.
-// If min and max exists, a uniform distribution is assumed if the value is within the bounds and a selectivity of (1/(max-min)) is returned.
 func (p StrEqualityPredicate) Selectivity(d dataset.DataSet) float64 {
 	dataPath := d.Paths[p.Path]
 	if dataPath == nil || dataPath.Stringtype == nil {
@@ -219,9 +397,46 @@ func (p StrEqualityPredicate) Selectivity(d dataset.DataSet) float64 {
 	if strType.Count == nil {
 		return 0.01 * typeSelectivity
 	}
+	if fraction, ok := strType.ValueFraction(p.Str); ok {
+		return fraction * typeSelectivity
+	}
+	if strType.Unique != nil && *strType.Unique > 0 {
+		return (1.0 / float64(*strType.Unique)) * typeSelectivity
+	}
 	return (1.0 / float64(*strType.Count)) * typeSelectivity
 }
 
+// InPredicate checks if the value at the given path equals one of the given values.
+// Either a list of strings or a list of integers is given.
+type InPredicate struct {
+	Path    string
+	Strings []string
+	Numbers []int64
+}
+
+func (q InPredicate) String() string {
+	values := make([]string, 0, len(q.Strings)+len(q.Numbers))
+	for _, str := range q.Strings {
+		values = append(values, fmt.Sprintf("\"%s\"", str))
+	}
+	for _, number := range q.Numbers {
+		values = append(values, fmt.Sprintf("%d", number))
+	}
+	return fmt.Sprintf("IN('%s', [%s])", q.Path, strings.Join(values, ", "))
+}
+
+// Selectivity implements Predicate.Selectivity by adding the selectivities of the equality predicates of all values
+func (p InPredicate) Selectivity(d dataset.DataSet) float64 {
+	selectivity := 0.0
+	for _, str := range p.Strings {
+		selectivity += StrEqualityPredicate{Path: p.Path, Str: str}.Selectivity(d)
+	}
+	for _, number := range p.Numbers {
+		selectivity += IntEqualityPredicate{Path: p.Path, Number: number}.Selectivity(d)
+	}
+	return math.Min(selectivity, 1.0)
+}
+
 // StrPrefixPredicate checks if a given path contains a string with the given prefix
 type StrPrefixPredicate struct {
 	Path   string
@@ -264,6 +479,89 @@ func (p StrPrefixPredicate) Selectivity(d dataset.DataSet) float64 {
 	return (1.0 / float64(*strType.Count)) * typeSelectivity
 }
 
+// StrContainsPredicate checks if a given path contains a string with the given substring
+type StrContainsPredicate struct {
+	Path      string
+	Substring string
+}
+
+func (q StrContainsPredicate) String() string {
+	return fmt.Sprintf("CONTAINS('%s',\"%s\")", q.Path, q.Substring)
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPath with matching type and path exists, 0 is returned
+// If a data path exists, but has no count, 0.01 is assumed and returned (predicate selects 1% of all documents)
+// If n-gram statistics exist, the fraction of strings containing the n-grams of the substring is returned.
+// Otherwise 0.1 is assumed and returned (predicate selects 10% of all strings)
+func (p StrContainsPredicate) Selectivity(d dataset.DataSet) float64 {
+	dataPath := d.Paths[p.Path]
+	if dataPath == nil || dataPath.Stringtype == nil {
+		return 0.0
+	}
+	strType := dataPath.Stringtype
+	typeSelectivity := getTypeSelectivity(d, strType.Count)
+	if strType.Count == nil {
+		return 0.01 * typeSelectivity
+	}
+	if fraction, ok := strType.SubstringFraction(p.Substring); ok {
+		return fraction * typeSelectivity
+	}
+	return 0.1 * typeSelectivity
+}
+
+// StrRegexPredicate checks if a given path contains a string matching a constrained regular expression.
+// The expression consists of an optional prefix followed by substrings in the given order.
+// All parts are matched literally, so the expression behaves the same in all supported languages.
+type StrRegexPredicate struct {
+	Path    string
+	Prefix  string
+	Infixes []string
+}
+
+// Regex returns the regular expression of the predicate
+func (q StrRegexPredicate) Regex() string {
+	var parts []string
+	for _, infix := range q.Infixes {
+		parts = append(parts, regexp.QuoteMeta(infix))
+	}
+	regex := strings.Join(parts, ".*")
+	if len(q.Prefix) > 0 {
+		if len(regex) > 0 {
+			regex = ".*" + regex
+		}
+		regex = "^" + regexp.QuoteMeta(q.Prefix) + regex
+	}
+	return regex
+}
+
+func (q StrRegexPredicate) String() string {
+	return fmt.Sprintf("REGEX('%s',\"%s\")", q.Path, q.Regex())
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// The prefix and all substrings are assumed to be independent.
+// The prefix is estimated like a StrPrefixPredicate and each substring like a StrContainsPredicate.
+func (p StrRegexPredicate) Selectivity(d dataset.DataSet) float64 {
+	dataPath := d.Paths[p.Path]
+	if dataPath == nil || dataPath.Stringtype == nil {
+		return 0.0
+	}
+	strType := dataPath.Stringtype
+	selectivity := getTypeSelectivity(d, strType.Count)
+	if len(p.Prefix) > 0 {
+		selectivity = StrPrefixPredicate{Path: p.Path, Prefix: p.Prefix}.Selectivity(d)
+	}
+	for _, infix := range p.Infixes {
+		if fraction, ok := strType.SubstringFraction(infix); ok {
+			selectivity *= fraction
+		} else {
+			selectivity *= 0.1
+		}
+	}
+	return selectivity
+}
+
 // BoolEqualityPredicate evaluates the boolean equality operation between a path and a boolean
 type BoolEqualityPredicate struct {
 	Path  string
@@ -417,3 +715,278 @@ func (p ArraySizeComparisonPredicate) Selectivity(d dataset.DataSet) float64 {
 	}
 	return (1.0 / 3.0) * typeSelectivity
 }
+
+// StrLengthComparisonPredicate evaluates the Number comparison (<,>,<=,>=) operation between the number of characters of a string path and a given number
+type StrLengthComparisonPredicate struct {
+	Path    string
+	Number  uint64
+	Smaller bool
+	Equal   bool
+}
+
+func (q StrLengthComparisonPredicate) String() string {
+	var cmpstr = ">"
+	if q.Smaller {
+		cmpstr = "<"
+	}
+	if q.Equal {
+		cmpstr += "="
+	}
+	return fmt.Sprintf("LEN('%s') %s %d", q.Path, cmpstr, q.Number)
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPath with matching type and path exists, 0 is returned
+// If the minimum and maximum length are known, the fraction of strings within the compared range is estimated with them and the average length.
+// Otherwise 0.33333 of the strings are assumed to be selected.
+func (p StrLengthComparisonPredicate) Selectivity(d dataset.DataSet) float64 {
+	dataPath := d.Paths[p.Path]
+	if dataPath == nil || dataPath.Stringtype == nil {
+		return 0.0
+	}
+	strType := dataPath.Stringtype
+	typeSelectivity := getTypeSelectivity(d, strType.Count)
+	// Lengths are integers, the length n covers (n-0.5, n+0.5]
+	bound := float64(p.Number) - 0.5
+	if p.Smaller == p.Equal {
+		bound = float64(p.Number) + 0.5
+	}
+	below, ok := strType.LengthFractionBelow(bound)
+	if !ok {
+		return (1.0 / 3.0) * typeSelectivity
+	}
+	if p.Smaller {
+		return below * typeSelectivity
+	}
+	return (1.0 - below) * typeSelectivity
+}
+
+// TemporalPredicate checks if the timestamp at the given path lies within a time range.
+// The range starts at From (inclusive) and ends before To (exclusive), a missing bound is unbounded.
+// This expresses "before", "since" (e.g. the last N days) and "between" comparisons.
+type TemporalPredicate struct {
+	Path string
+	// The representation of the timestamps at the path
+	Format dataset.TemporalFormat
+	From   *time.Time
+	To     *time.Time
+}
+
+func (q TemporalPredicate) String() string {
+	switch {
+	case q.From != nil && q.To != nil:
+		return fmt.Sprintf("'%s' BETWEEN %s AND %s", q.Path, q.From.UTC().Format(time.RFC3339), q.To.UTC().Format(time.RFC3339))
+	case q.To != nil:
+		return fmt.Sprintf("'%s' BEFORE %s", q.Path, q.To.UTC().Format(time.RFC3339))
+	case q.From != nil:
+		return fmt.Sprintf("'%s' SINCE %s", q.Path, q.From.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("ISTIMESTAMP('%s')", q.Path)
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPath with timestamps of the format exists, 0 is returned
+// If the distribution of the timestamps is known, the fraction of timestamps within the range is estimated with it.
+// Otherwise 0.33333 of the timestamps are assumed to be selected.
+func (p TemporalPredicate) Selectivity(d dataset.DataSet) float64 {
+	dataPath := d.Paths[p.Path]
+	if dataPath == nil || dataPath.Temporaltype == nil || dataPath.Temporaltype.Format != p.Format {
+		return 0.0
+	}
+	typeSelectivity := getTypeSelectivity(d, dataPath.Temporaltype.Count)
+	lower, upper := 0.0, 1.0
+	var ok bool
+	if p.From != nil {
+		if lower, ok = dataPath.TemporalFractionBefore(*p.From); !ok {
+			return (1.0 / 3.0) * typeSelectivity
+		}
+	}
+	if p.To != nil {
+		if upper, ok = dataPath.TemporalFractionBefore(*p.To); !ok {
+			return (1.0 / 3.0) * typeSelectivity
+		}
+	}
+	return math.Max(upper-lower, 0.0) * typeSelectivity
+}
+
+// PathComparisonPredicate evaluates the Number comparison (<,>,<=,>=) operation between the values of two paths
+type PathComparisonPredicate struct {
+	Lhs     string
+	Rhs     string
+	Smaller bool
+	Equal   bool
+}
+
+func (q PathComparisonPredicate) String() string {
+	var cmpstr = ">"
+	if q.Smaller {
+		cmpstr = "<"
+	}
+	if q.Equal {
+		cmpstr += "="
+	}
+	return fmt.Sprintf("'%s' %s '%s'", q.Lhs, cmpstr, q.Rhs)
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPaths with numbers exist for both paths, 0 is returned
+// The values of both paths are assumed to be independent, so the type selectivities are multiplied.
+// If the distributions of both paths are known, the fraction of value pairs satisfying the comparison is estimated with them.
+// Otherwise 0.5 of the value pairs are assumed to be selected.
+func (p PathComparisonPredicate) Selectivity(d dataset.DataSet) float64 {
+	lhsPath := d.Paths[p.Lhs]
+	rhsPath := d.Paths[p.Rhs]
+	if lhsPath == nil || lhsPath.Floattype == nil || rhsPath == nil || rhsPath.Floattype == nil {
+		return 0.0
+	}
+	typeSelectivity := getTypeSelectivity(d, lhsPath.Floattype.Count) * getTypeSelectivity(d, rhsPath.Floattype.Count)
+	if p.Smaller {
+		if fraction, ok := lhsPath.Floattype.ComparisonFraction(rhsPath.Floattype, p.Equal); ok {
+			return fraction * typeSelectivity
+		}
+	} else {
+		if fraction, ok := rhsPath.Floattype.ComparisonFraction(lhsPath.Floattype, p.Equal); ok {
+			return fraction * typeSelectivity
+		}
+	}
+	return 0.5 * typeSelectivity
+}
+
+// PathStrEqualityPredicate evaluates the String equality operation between the values of two paths
+type PathStrEqualityPredicate struct {
+	Lhs string
+	Rhs string
+}
+
+func (q PathStrEqualityPredicate) String() string {
+	return fmt.Sprintf("'%s' == '%s'", q.Lhs, q.Rhs)
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPaths with strings exist for both paths, 0 is returned
+// The values of both paths are assumed to be independent, so the type selectivities are multiplied.
+// If the most common values or the number of distinct values are known, the fraction of equal value pairs is estimated with them.
+// Otherwise 0.01 of the value pairs are assumed to be equal.
+func (p PathStrEqualityPredicate) Selectivity(d dataset.DataSet) float64 {
+	lhsPath := d.Paths[p.Lhs]
+	rhsPath := d.Paths[p.Rhs]
+	if lhsPath == nil || lhsPath.Stringtype == nil || rhsPath == nil || rhsPath.Stringtype == nil {
+		return 0.0
+	}
+	typeSelectivity := getTypeSelectivity(d, lhsPath.Stringtype.Count) * getTypeSelectivity(d, rhsPath.Stringtype.Count)
+	if fraction, ok := lhsPath.Stringtype.EqualityFraction(rhsPath.Stringtype); ok {
+		return fraction * typeSelectivity
+	}
+	return 0.01 * typeSelectivity
+}
+
+// AnyElementPredicate checks if any element of the array at the given path satisfies the sub-predicate.
+// The paths of the sub-predicate start with the element path of the array (e.g. "/tags/*" or "/tags/*/name").
+type AnyElementPredicate struct {
+	Path      string
+	Predicate Predicate
+}
+
+func (q AnyElementPredicate) String() string {
+	return fmt.Sprintf("ANY('%s', %s)", q.Path, q.Predicate.String())
+}
+
+// Selectivity implements Predicate.Selectivity by estimating the selectivity given the data set.
+// If no DataPath with array type and element statistics exists, 0 is returned.
+// Otherwise the elements are assumed to satisfy the sub-predicate independently of each other,
+// so an array of average length n is selected with probability 1-(1-s)^n, where s is the selectivity of the sub-predicate on all elements.
+func (p AnyElementPredicate) Selectivity(d dataset.DataSet) float64 {
+	dataPath := d.Paths[p.Path]
+	if dataPath == nil || dataPath.Arraytype == nil {
+		return 0.0
+	}
+	elements, ok := d.ElementDataSet(p.Path)
+	if !ok {
+		return 0.0
+	}
+	arrayType := dataPath.Arraytype
+	typeSelectivity := getTypeSelectivity(d, arrayType.Count)
+	length := 1.0
+	if arrayType.Count != nil && *arrayType.Count > 0 {
+		length = float64(elements.GetSize()) / float64(*arrayType.Count)
+	}
+	elementSelectivity := p.Predicate.Selectivity(elements)
+	return typeSelectivity * (1.0 - math.Pow(1.0-elementSelectivity, length))
+}
+
+// RebasePredicate returns a copy of the predicate, in which the path prefix from is replaced with to in all paths.
+// Paths not starting with from are kept.
+func RebasePredicate(predicate Predicate, from string, to string) Predicate {
+	rebase := func(path string) string {
+		if path == from || strings.HasPrefix(path, from+"/") {
+			return to + strings.TrimPrefix(path, from)
+		}
+		return path
+	}
+	switch v := predicate.(type) {
+	case AndPredicate:
+		return AndPredicate{Lhs: RebasePredicate(v.Lhs, from, to), Rhs: RebasePredicate(v.Rhs, from, to)}
+	case OrPredicate:
+		return OrPredicate{Lhs: RebasePredicate(v.Lhs, from, to), Rhs: RebasePredicate(v.Rhs, from, to)}
+	case NotPredicate:
+		return NotPredicate{Predicate: RebasePredicate(v.Predicate, from, to)}
+	case AnyElementPredicate:
+		v.Path = rebase(v.Path)
+		v.Predicate = RebasePredicate(v.Predicate, from, to)
+		return v
+	case ExistsPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case TypeCheckPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case IntEqualityPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case FloatComparisonPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case RangePredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case StrEqualityPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case InPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case StrPrefixPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case StrContainsPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case StrRegexPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case BoolEqualityPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case ObjectSizeComparisonPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case ArraySizeComparisonPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case StrLengthComparisonPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case TemporalPredicate:
+		v.Path = rebase(v.Path)
+		return v
+	case PathComparisonPredicate:
+		v.Lhs = rebase(v.Lhs)
+		v.Rhs = rebase(v.Rhs)
+		return v
+	case PathStrEqualityPredicate:
+		v.Lhs = rebase(v.Lhs)
+		v.Rhs = rebase(v.Rhs)
+		return v
+	}
+	return predicate
+}
@@ -0,0 +1,99 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JODA-Explore/BETZE/dataset"
+)
+
+// Projection transforms each document into a new object holding the values of selected paths.
+// Paths missing in a document are missing in the projected document as well.
+type Projection struct {
+	// The attributes of the projected documents
+	Attributes []ProjectedAttribute
+}
+
+// ProjectedAttribute copies the value at a path of the document into a top-level attribute of the projected document
+type ProjectedAttribute struct {
+	// The path to copy
+	Source string `json:"source"`
+	// The top-level path of the attribute in the projected document
+	Target string `json:"target"`
+}
+
+// Name returns the name of the target attribute
+func (a ProjectedAttribute) Name() string {
+	return strings.TrimPrefix(a.Target, "/")
+}
+
+func (p Projection) String() string {
+	attributes := make([]string, len(p.Attributes))
+	for i, attribute := range p.Attributes {
+		attributes[i] = fmt.Sprintf("'%s' AS '%s'", attribute.Source, attribute.Target)
+	}
+	return strings.Join(attributes, ", ")
+}
+
+// Source returns the path in the original document of a path in the projected document.
+// If the path is not projected, false is returned.
+func (p Projection) Source(path string) (string, bool) {
+	for _, attribute := range p.Attributes {
+		if path == attribute.Target || strings.HasPrefix(path, attribute.Target+"/") {
+			return attribute.Source + strings.TrimPrefix(path, attribute.Target), true
+		}
+	}
+	return "", false
+}
+
+// SourcePredicate rebases a predicate on projected documents to the original documents
+func (p Projection) SourcePredicate(predicate Predicate) Predicate {
+	if predicate == nil {
+		return nil
+	}
+	// The targets are top-level attributes not existing in the original documents, unless they are projected unchanged.
+	// So a rebased path can not be rebased again by another attribute.
+	for _, attribute := range p.Attributes {
+		predicate = RebasePredicate(predicate, attribute.Target, attribute.Source)
+	}
+	return predicate
+}
+
+// Then returns the projection of the original documents, which is equal to applying the projection and then the next projection
+func (p Projection) Then(next Projection) Projection {
+	composed := Projection{}
+	for _, attribute := range next.Attributes {
+		if source, ok := p.Source(attribute.Source); ok {
+			composed.Attributes = append(composed.Attributes, ProjectedAttribute{Source: source, Target: attribute.Target})
+		}
+	}
+	return composed
+}
+
+// ProjectPaths returns the statistics of the projected documents, derived from the statistics of the original documents
+func (p Projection) ProjectPaths(paths map[string]*dataset.DataPath) map[string]*dataset.DataPath {
+	projected := make(map[string]*dataset.DataPath)
+	for path, data_path := range paths {
+		for _, attribute := range p.Attributes {
+			if path == attribute.Source || strings.HasPrefix(path, attribute.Source+"/") {
+				target := attribute.Target + strings.TrimPrefix(path, attribute.Source)
+				target_path := *data_path
+				target_path.Path = target
+				projected[target] = &target_path
+			}
+		}
+	}
+	// The root only contains the projected attributes
+	if root, ok := paths[""]; ok && root != nil {
+		members := uint64(len(p.Attributes))
+		min_members := uint64(0)
+		projected_root := *root
+		projected_root.Objecttype = &dataset.ObjectType{
+			Count:      root.Count,
+			MinMembers: &min_members,
+			MaxMembers: &members,
+		}
+		projected[""] = &projected_root
+	}
+	return projected
+}
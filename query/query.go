@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/JODA-Explore/BETZE/dataset"
 )
@@ -12,10 +13,20 @@ type Query struct {
 	baseDataset *dataset.DataSet
 	// The name/ID of the dataset to be created by executing the query
 	storeName string
+	// The path of the array to unwind before filtering, empty if the documents are not unwound
+	unwind string
+	// The dataset to join before filtering, nil if no dataset is joined
+	join *Join
 	// The predicate for filtering
 	predicate Predicate
+	// The projection of the filtered documents, nil if the whole documents are kept
+	projection *Projection
 	// The aggregaton function to use
 	aggregation Aggregation
+	// The keys to order the result by, in order of precedence
+	sortKeys []SortKey
+	// The maximum number of results, 0 if unlimited
+	limit uint64
 	// Base query (if exists)
 	basequery *Query
 }
@@ -49,6 +60,29 @@ func (q *Query) Load(dataSet *dataset.DataSet) *Query {
 	return q
 }
 
+// Unwinds the array at the path, so that each loaded document is replaced by one document per array element (e.g.: $unwind; explode(x);)
+// The array is replaced by the element in each document. Documents without array at the path are removed.
+func (q *Query) Unwind(path string) *Query {
+	q.unwind = path
+	return q
+}
+
+// Gets the path of the unwound array, empty if the documents are not unwound
+func (q *Query) UnwindPath() string {
+	return q.unwind
+}
+
+// Joins the documents of another dataset into the loaded documents (e.g.: JOIN x ON y; $lookup;)
+func (q *Query) Join(join *Join) *Query {
+	q.join = join
+	return q
+}
+
+// Gets the join of the query, nil if no dataset is joined
+func (q *Query) GetJoin() *Join {
+	return q.join
+}
+
 // Filters the loaded dataset by a predicate (e.g.: WHERE x; CHOOSE x; FILTER x;)
 func (q *Query) Filter(predicate Predicate) *Query {
 	q.predicate = predicate
@@ -61,6 +95,17 @@ func (q *Query) Store(name string) *Query {
 	return q
 }
 
+// Projects the filtered documents to new documents (e.g.: SELECT x; AS x; TRANSFORM x;)
+func (q *Query) Transform(projection *Projection) *Query {
+	q.projection = projection
+	return q
+}
+
+// Gets the projection of the query, nil if the whole documents are kept
+func (q *Query) Projection() *Projection {
+	return q.projection
+}
+
 // Sets the aggreation of the query
 func (q *Query) Aggregate(agg Aggregation) *Query {
 	q.aggregation = agg
@@ -72,6 +117,28 @@ func (q *Query) Aggregation() Aggregation {
 	return q.aggregation
 }
 
+// Orders the query result by the given keys (e.g.: ORDER BY x; SORT x;)
+func (q *Query) OrderBy(keys ...SortKey) *Query {
+	q.sortKeys = keys
+	return q
+}
+
+// Gets the keys to order the query result by
+func (q *Query) SortKeys() []SortKey {
+	return q.sortKeys
+}
+
+// Limits the query result to the first n documents or groups (e.g.: LIMIT n;)
+func (q *Query) Limit(n uint64) *Query {
+	q.limit = n
+	return q
+}
+
+// Gets the maximum number of results, 0 if unlimited
+func (q *Query) ResultLimit() uint64 {
+	return q.limit
+}
+
 func (q *Query) AggregationIsGrouped() bool {
 	if q.aggregation == nil {
 		return false
@@ -100,18 +167,38 @@ func (q Query) MergeQuery() Query {
 		return q
 	}
 	newbase := q.basequery.MergeQuery()
+	predicate, projection := newbase.rebase(q.predicate, q.projection)
 
+	// Only the first query of a chain can unwind an array or join a dataset, as both happen before filtering
 	return Query{
 		baseDataset: newbase.baseDataset,
 		storeName:   q.storeName,
+		unwind:      newbase.unwind,
+		join:        newbase.join,
 		predicate: AndPredicate{
 			Lhs: newbase.predicate,
-			Rhs: q.predicate,
+			Rhs: predicate,
 		},
+		projection:  projection,
 		aggregation: q.aggregation,
+		sortKeys:    q.sortKeys,
+		limit:       q.limit,
 	}
 }
 
+// Rebases the predicate and projection of a query on the result of this query to the base dataset of this query.
+// The predicate is rebased to the original paths and the projection is applied after the projection of this query.
+func (q *Query) rebase(predicate Predicate, projection *Projection) (Predicate, *Projection) {
+	if q.projection == nil {
+		return predicate, projection
+	}
+	composed := *q.projection
+	if projection != nil {
+		composed = q.projection.Then(*projection)
+	}
+	return q.projection.SourcePredicate(predicate), &composed
+}
+
 // Translates the query to a human readable format
 func (q *Query) String() string {
 	if q == nil {
@@ -122,63 +209,107 @@ func (q *Query) String() string {
 	if filter != nil {
 		filterStr = filter.String()
 	}
+	joinStr := ""
+	if q.join != nil {
+		joinStr = q.join.String()
+	}
+	transformStr := ""
+	if q.projection != nil {
+		transformStr = q.projection.String()
+	}
 	aggStr := ""
 	if q.aggregation != nil {
 		aggStr = (q.aggregation).String()
 	}
-	return fmt.Sprintf("LOAD: %s\nFILTER: %s\nTRANSFORM: %s\nAGGREGATE: %s\nSTORE: %s\n", q.BaseName(), filterStr, "", aggStr, q.StoreName())
+	orderStr := make([]string, len(q.sortKeys))
+	for i, key := range q.sortKeys {
+		orderStr[i] = key.String()
+	}
+	limitStr := ""
+	if q.limit > 0 {
+		limitStr = fmt.Sprintf("%d", q.limit)
+	}
+	return fmt.Sprintf("LOAD: %s\nUNWIND: %s\nJOIN: %s\nFILTER: %s\nTRANSFORM: %s\nAGGREGATE: %s\nORDER BY: %s\nLIMIT: %s\nSTORE: %s\n", q.BaseName(), q.unwind, joinStr, filterStr, transformStr, aggStr, strings.Join(orderStr, ", "), limitStr, q.StoreName())
 }
 
 // Checks if a query only copies a dataset without changing it
 func (q Query) IsCopy() bool {
-	return q.predicate == nil && q.aggregation == nil
+	return q.unwind == "" && q.join == nil && q.predicate == nil && q.projection == nil && q.aggregation == nil && q.limit == 0
 }
 
-// Uses the selectivity estimation to create a new mock dataset based on the query result
+// Uses the selectivity estimation to create a new mock dataset based on the query result.
+// Like the aggregation, the order and limit only change the result of the query and not the created dataset.
+// If the documents are projected, the dataset only contains the projected paths.
 func (q *Query) GenerateDataset() dataset.DataSet {
-	size := float64(q.baseDataset.GetSize())
+	base := q.InputDataset()
+	size := float64(base.GetSize())
 	if q.predicate != nil {
-		size *= q.predicate.Selectivity(*q.baseDataset)
+		size *= q.predicate.Selectivity(base)
+	}
+	paths := base.Paths
+	if q.projection != nil {
+		paths = q.projection.ProjectPaths(paths)
 	}
 	return dataset.DataSet{
 		Name:          q.StoreName(),
 		Count:         nil,
 		ExpectedCount: uint64(size),
-		Paths:         q.baseDataset.Paths,
+		Paths:         paths,
 		DerivedFrom:   q.baseDataset,
 	}
 }
 
-// Creates a copy of the query without any aggregation
+// Returns the estimated dataset the predicate is evaluated on, which is the base dataset with the array unwound and the dataset joined
+func (q *Query) InputDataset() dataset.DataSet {
+	input := *q.baseDataset
+	if q.unwind != "" {
+		if unwound, ok := input.UnwoundDataSet(q.unwind); ok {
+			input = unwound
+		}
+	}
+	if q.join != nil {
+		input = q.join.JoinDataSet(input)
+	}
+	return input
+}
+
+// Creates a copy of the query without any aggregation, order or limit
 func (q Query) CopyWithoutAggregation() Query {
 	return Query{
 		baseDataset: q.baseDataset,
 		storeName:   q.storeName,
+		unwind:      q.unwind,
+		join:        q.join,
 		predicate:   q.predicate,
+		projection:  q.projection,
 		basequery:   q.basequery,
 	}
 }
 
-/*
-	// Transforms the filter result into a new expression, (e.g.: SELECT x; AS x; TRANSFORM x;)
-	transform() Query
-	// Aggregates the query result  (e.g.: SELECT SUM() ; AGG x;)
-	aggregate() Query
-*/
-
 func RemoveIntermediateSets(queries []Query) []Query {
 	predicates := make(map[string]Predicate)
+	unwinds := make(map[string]string)
+	joins := make(map[string]*Join)
+	projections := make(map[string]*Projection)
 	baseSets := make(map[string]*dataset.DataSet)
 	for i := range queries {
 		q := &queries[i]
 		basePred, ok := predicates[q.BaseName()]
 		if ok {
-			// Merge predicate
-			q.Filter(AndPredicate{Lhs: basePred, Rhs: q.FilterPredicate()})
+			// Merge predicate and projection
+			base := Query{projection: projections[q.BaseName()]}
+			predicate, projection := base.rebase(q.FilterPredicate(), q.Projection())
+			q.Filter(AndPredicate{Lhs: basePred, Rhs: predicate})
+			q.Transform(projection)
+			q.Unwind(unwinds[q.BaseName()])
+			q.Join(joins[q.BaseName()])
 			// Set load to parent
 			q.Load(baseSets[q.BaseName()])
 		}
 		predicates[q.StoreName()] = q.FilterPredicate()
+		unwinds[q.StoreName()] = q.UnwindPath()
+		joins[q.StoreName()] = q.GetJoin()
+		projections[q.StoreName()] = q.Projection()
 		baseSets[q.StoreName()] = q.Base()
 		//Reset store
 		q.Store("")